@@ -4,10 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
+
+	"github.com/Stromberg/gel/num"
 )
 
 // Pos is a position marker within a file set. Use the FileSet's PosInfo
@@ -31,6 +35,17 @@ type Int struct {
 func (l *Int) Pos() Pos { return l.InputPos }
 func (l *Int) End() Pos { return l.InputPos + Pos(len(l.Input)) }
 
+// BigInt represents an integer literal in parsed twik code that does not
+// fit in an int64.
+type BigInt struct {
+	Input    string
+	InputPos Pos
+	Value    *big.Int
+}
+
+func (l *BigInt) Pos() Pos { return l.InputPos }
+func (l *BigInt) End() Pos { return l.InputPos + Pos(len(l.Input)) }
+
 // Float represents a float literal in parsed twik code.
 type Float struct {
 	Input    string
@@ -41,6 +56,16 @@ type Float struct {
 func (l *Float) Pos() Pos { return l.InputPos }
 func (l *Float) End() Pos { return l.InputPos + Pos(len(l.Input)) }
 
+// Decimal represents a decimal literal like 12.50M in parsed twik code.
+type Decimal struct {
+	Input    string
+	InputPos Pos
+	Value    num.Decimal
+}
+
+func (l *Decimal) Pos() Pos { return l.InputPos }
+func (l *Decimal) End() Pos { return l.InputPos + Pos(len(l.Input)) }
+
 // String represents a string literal in parsed twik code.
 type String struct {
 	Input    string
@@ -51,6 +76,16 @@ type String struct {
 func (l *String) Pos() Pos { return l.InputPos }
 func (l *String) End() Pos { return l.InputPos + Pos(len(l.Input)) }
 
+// Keyword represents a :name keyword literal in parsed twik code.
+type Keyword struct {
+	Input    string
+	InputPos Pos
+	Name     string
+}
+
+func (l *Keyword) Pos() Pos { return l.InputPos }
+func (l *Keyword) End() Pos { return l.InputPos + Pos(len(l.Input)) }
+
 // Symbol represents a symbol in parsed twik code.
 type Symbol struct {
 	Name    string
@@ -90,6 +125,16 @@ type DictList struct {
 func (s *DictList) Pos() Pos { return s.LParens }
 func (s *DictList) End() Pos { return s.RParens + 1 }
 
+// SetList represents the elements of a #{...} set literal from parsed twik code.
+type SetList struct {
+	LParens Pos
+	RParens Pos
+	Nodes   []Node
+}
+
+func (s *SetList) Pos() Pos { return s.LParens }
+func (s *SetList) End() Pos { return s.RParens + 1 }
+
 // Root represents the root of parsed twik code.
 type Root struct {
 	First Pos
@@ -115,8 +160,7 @@ func Parse(fset *FileSet, name string, code []byte) (Node, error) {
 // Positioning information for the parsed code will be stored in
 // fset under the given name.
 func ParseString(fset *FileSet, name string, code string) (Node, error) {
-	base := fset.nextBase()
-	fset.files = append(fset.files, file{name: name, code: code, base: base})
+	base := fset.addFile(name, code)
 
 	p := parser{fset: fset, code: code, base: base}
 	root := Root{First: p.pos(0)}
@@ -155,6 +199,16 @@ func isRightClose(r rune) bool {
 	return r == ')' || r == ']' || r == '}'
 }
 
+// isExponent reports whether the number input has a decimal exponent,
+// like 1e21, which makes it a float.
+func isExponent(input string) bool {
+	input = strings.TrimPrefix(input, "-")
+	if strings.HasPrefix(input, "0x") || strings.HasPrefix(input, "0X") {
+		return false
+	}
+	return strings.ContainsAny(input, "eE")
+}
+
 var errClosedParen = errors.New("unexpected )")
 var errOpenedParen = errors.New("missing )")
 var errClosedBracket = errors.New("unexpected ]")
@@ -274,6 +328,30 @@ func (p *parser) next() (Node, error) {
 		return list, nil
 	}
 
+	if r == '#' && strings.HasPrefix(p.code[p.i:], "{") {
+		p.i++
+		var nodes []Node
+		for {
+			node, err := p.next()
+			if err == errClosedBrace {
+				break
+			}
+			if err == io.EOF {
+				return nil, errOpenedBrace
+			}
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+		list := &SetList{
+			LParens: p.pos(start),
+			RParens: p.pos(p.i - 1),
+			Nodes:   nodes,
+		}
+		return list, nil
+	}
+
 	if r == '-' && p.i < len(p.code) {
 		r, size = utf8.DecodeRuneInString(p.code[p.i:])
 		if r >= '0' && r <= '9' {
@@ -295,7 +373,14 @@ func (p *parser) next() (Node, error) {
 			p.i += size
 		}
 		input := p.code[start:p.i]
-		if dot {
+		if strings.HasSuffix(input, "M") {
+			value, err := num.ParseDecimal(input[:len(input)-1])
+			if err != nil {
+				return nil, p.ierrorf(start, "invalid decimal literal: %s", input)
+			}
+			return &Decimal{Input: input, InputPos: p.pos(start), Value: value}, nil
+		}
+		if dot || isExponent(input) {
 			value, err := strconv.ParseFloat(input, 64)
 			if err != nil {
 				return nil, p.ierrorf(start, "invalid float literal: %s", input)
@@ -304,12 +389,19 @@ func (p *parser) next() (Node, error) {
 		} else {
 			value, err := strconv.ParseInt(input, 0, 64)
 			if err != nil {
+				if value, ok := new(big.Int).SetString(input, 0); ok {
+					return &BigInt{Input: input, InputPos: p.pos(start), Value: value}, nil
+				}
 				return nil, p.ierrorf(start, "invalid int literal: %s", input)
 			}
 			return &Int{Input: input, InputPos: p.pos(start), Value: value}, nil
 		}
 	}
 
+	if r == '`' || r == '~' || (r == '\'' && !p.isChar()) {
+		return p.quote(start, r)
+	}
+
 	if r == '\'' {
 		var c rune
 		if p.i < len(p.code) {
@@ -345,7 +437,7 @@ func (p *parser) next() (Node, error) {
 			if r == '"' && !escaped {
 				break
 			}
-			escaped = r == '\\'
+			escaped = !escaped && r == '\\'
 		}
 		input := p.code[start:p.i]
 		value, err := strconv.Unquote(input)
@@ -368,8 +460,7 @@ func (p *parser) next() (Node, error) {
 			}
 		}
 		input := p.code[start:p.i]
-		value := input[1:]
-		return &String{Input: input, InputPos: p.pos(start), Value: value}, nil
+		return &Keyword{Input: input, InputPos: p.pos(start), Name: input[1:]}, nil
 	}
 
 	// symbol
@@ -387,13 +478,64 @@ func (p *parser) next() (Node, error) {
 	return symbol, nil
 }
 
+// isChar reports whether the single quote just consumed starts a char literal
+// like 'a' or '\n' rather than quoting the following form.
+func (p *parser) isChar() bool {
+	if p.i == len(p.code) {
+		return true
+	}
+	c, size := utf8.DecodeRuneInString(p.code[p.i:])
+	if c == '\\' || c == '\'' {
+		return true
+	}
+	i := p.i + size
+	if i == len(p.code) {
+		return false
+	}
+	c, _ = utf8.DecodeRuneInString(p.code[i:])
+	return c == '\''
+}
+
+var quoteNames = map[rune]string{
+	'\'': "quote",
+	'`':  "quasiquote",
+	'~':  "unquote",
+}
+
+// quote reads the form following a reader macro and returns it
+// wrapped in the corresponding list, so that 'x becomes (quote x),
+// `x becomes (quasiquote x), ~x becomes (unquote x) and
+// ~@x becomes (unquote-splicing x).
+func (p *parser) quote(start int, r rune) (Node, error) {
+	name := quoteNames[r]
+	if r == '~' && p.i < len(p.code) && p.code[p.i] == '@' {
+		name = "unquote-splicing"
+		p.i++
+	}
+	reader := p.code[start:p.i]
+	node, err := p.next()
+	if err == io.EOF || (err != nil && err != errOpenedParen && err != errOpenedBracket && err != errOpenedBrace) {
+		return nil, p.ierrorf(start, "missing form after %s", reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &List{
+		LParens: p.pos(start),
+		RParens: node.End() - 1,
+		Nodes:   []Node{&Symbol{Name: name, NamePos: p.pos(start)}, node},
+	}, nil
+}
+
 // NewFileSet returns a new FileSet.
 func NewFileSet() *FileSet {
 	return &FileSet{}
 }
 
 // FileSet holds positioning information for parsed twik code.
+// It is safe for concurrent use.
 type FileSet struct {
+	mu    sync.RWMutex
 	files []file
 }
 
@@ -403,18 +545,24 @@ type file struct {
 	base Pos
 }
 
-func (fset *FileSet) nextBase() Pos {
-	if len(fset.files) == 0 {
-		return 1
-	} else {
+// addFile adds a file with code to fset and returns its base.
+func (fset *FileSet) addFile(name string, code string) Pos {
+	fset.mu.Lock()
+	defer fset.mu.Unlock()
+	base := Pos(1)
+	if len(fset.files) > 0 {
 		last := fset.files[len(fset.files)-1]
-		return last.base + Pos(len(last.code)) + 1
+		base = last.base + Pos(len(last.code)) + 1
 	}
+	fset.files = append(fset.files, file{name: name, code: code, base: base})
+	return base
 }
 
 // PosInfo returns the line and column for pos, and the name the
 // file containing that position was parsed with.
 func (fset *FileSet) PosInfo(pos Pos) *PosInfo {
+	fset.mu.RLock()
+	defer fset.mu.RUnlock()
 	pinfo := &PosInfo{}
 	for _, f := range fset.files {
 		if pos <= f.base+Pos(len(f.code)) {
@@ -438,10 +586,16 @@ func (fset *FileSet) PosInfo(pos Pos) *PosInfo {
 func (fset *FileSet) Code(node Node) string {
 	pos := node.Pos()
 	l := node.End()
+	fset.mu.RLock()
+	defer fset.mu.RUnlock()
 	for _, f := range fset.files {
 		if pos <= f.base+Pos(len(f.code)) {
 			offset := int(pos - f.base)
-			return f.code[offset : offset+int(l-pos)]
+			end := offset + int(l-pos)
+			if end > len(f.code) {
+				end = len(f.code)
+			}
+			return f.code[offset:end]
 		}
 	}
 	return ""
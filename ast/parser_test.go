@@ -2,9 +2,11 @@ package ast_test
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/num"
 	"github.com/kr/pretty"
 	. "gopkg.in/check.v1"
 )
@@ -69,6 +71,12 @@ var parserTests = []struct {
 		`0n10`,
 		errorf(".*: invalid int literal: 0n10"),
 	},
+	{
+		`9223372036854775808`,
+		[]ast.Node{
+			&ast.BigInt{Input: "9223372036854775808", InputPos: 1, Value: new(big.Int).Lsh(big.NewInt(1), 63)},
+		},
+	},
 	{
 		`'a'`,
 		[]ast.Node{
@@ -89,12 +97,72 @@ var parserTests = []struct {
 		`''`,
 		errorf(".*: invalid single quote"),
 	},
+	{
+		`'a`,
+		[]ast.Node{
+			&ast.List{LParens: 1, RParens: 2, Nodes: []ast.Node{
+				&ast.Symbol{Name: "quote", NamePos: 1},
+				&ast.Symbol{Name: "a", NamePos: 2},
+			}},
+		},
+	},
+	{
+		"`(a ~b ~@c)",
+		[]ast.Node{
+			&ast.List{LParens: 1, RParens: 11, Nodes: []ast.Node{
+				&ast.Symbol{Name: "quasiquote", NamePos: 1},
+				&ast.List{LParens: 2, RParens: 11, Nodes: []ast.Node{
+					&ast.Symbol{Name: "a", NamePos: 3},
+					&ast.List{LParens: 5, RParens: 6, Nodes: []ast.Node{
+						&ast.Symbol{Name: "unquote", NamePos: 5},
+						&ast.Symbol{Name: "b", NamePos: 6},
+					}},
+					&ast.List{LParens: 8, RParens: 10, Nodes: []ast.Node{
+						&ast.Symbol{Name: "unquote-splicing", NamePos: 8},
+						&ast.Symbol{Name: "c", NamePos: 10},
+					}},
+				}},
+			}},
+		},
+	},
+	{
+		"(~)",
+		errorf(".*: missing form after ~"),
+	},
 	{
 		` 1.0 `,
 		[]ast.Node{
 			&ast.Float{Input: "1.0", InputPos: 2, Value: 1},
 		},
 	},
+	{
+		`1e21`,
+		[]ast.Node{
+			&ast.Float{Input: "1e21", InputPos: 1, Value: 1e21},
+		},
+	},
+	{
+		`-2.5E-3`,
+		[]ast.Node{
+			&ast.Float{Input: "-2.5E-3", InputPos: 1, Value: -2.5e-3},
+		},
+	},
+	{
+		`0x1e`,
+		[]ast.Node{
+			&ast.Int{Input: "0x1e", InputPos: 1, Value: 30},
+		},
+	},
+	{
+		`12.50M`,
+		[]ast.Node{
+			&ast.Decimal{Input: "12.50M", InputPos: 1, Value: num.NewDecimal(big.NewInt(1250), 2)},
+		},
+	},
+	{
+		`1.2.3M`,
+		errorf(".*: invalid decimal literal: 1.2.3M"),
+	},
 	{
 		`()`,
 		[]ast.Node{
@@ -143,6 +211,13 @@ var parserTests = []struct {
 			&ast.String{Input: `"foo\"bar"`, InputPos: 1, Value: "foo\"bar"},
 		},
 	},
+	{
+		`"foo\\" "bar"`,
+		[]ast.Node{
+			&ast.String{Input: `"foo\\"`, InputPos: 1, Value: "foo\\"},
+			&ast.String{Input: `"bar"`, InputPos: 9, Value: "bar"},
+		},
+	},
 	{
 		` "foo" `,
 		[]ast.Node{
@@ -152,19 +227,19 @@ var parserTests = []struct {
 	{
 		`:foo`,
 		[]ast.Node{
-			&ast.String{Input: `:foo`, InputPos: 1, Value: "foo"},
+			&ast.Keyword{Input: `:foo`, InputPos: 1, Name: "foo"},
 		},
 	},
 	{
 		`:foo-qw`,
 		[]ast.Node{
-			&ast.String{Input: `:foo-qw`, InputPos: 1, Value: "foo-qw"},
+			&ast.Keyword{Input: `:foo-qw`, InputPos: 1, Name: "foo-qw"},
 		},
 	},
 	{
 		` :foo-qw `,
 		[]ast.Node{
-			&ast.String{Input: `:foo-qw`, InputPos: 2, Value: "foo-qw"},
+			&ast.Keyword{Input: `:foo-qw`, InputPos: 2, Name: "foo-qw"},
 		},
 	},
 	{
@@ -173,7 +248,7 @@ var parserTests = []struct {
 			&ast.List{
 				LParens: 1,
 				Nodes: []ast.Node{
-					&ast.String{Input: `:foo-qw`, InputPos: 2, Value: "foo-qw"},
+					&ast.Keyword{Input: `:foo-qw`, InputPos: 2, Name: "foo-qw"},
 				},
 				RParens: 9,
 			},
@@ -254,6 +329,23 @@ var parserTests = []struct {
 			},
 		},
 	},
+	{
+		`#{1 #}`,
+		[]ast.Node{
+			&ast.SetList{
+				LParens: 1,
+				Nodes: []ast.Node{
+					&ast.Int{Input: "1", InputPos: 3, Value: 1},
+					&ast.Symbol{Name: "#", NamePos: 5},
+				},
+				RParens: 6,
+			},
+		},
+	},
+	{
+		"#{1 2",
+		errorf(`twik source:1:6: missing }`),
+	},
 	{
 		"(a\nb\nc",
 		errorf(`twik source:3:2: missing \)`),
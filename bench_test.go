@@ -22,16 +22,31 @@ func BenchmarkEval0(b *testing.B) {
 	}
 }
 
+func BenchmarkNewScope(b *testing.B) {
+	fset := gel.NewFileSet()
+	for i := 0; i < b.N; i++ {
+		_, _ = gel.NewScope(fset)
+	}
+}
+
+func BenchmarkGelEval0(b *testing.B) {
+	g, _ := gel.New("0")
+	env := gel.NewEnv()
+	for i := 0; i < b.N; i++ {
+		_, _ = g.Eval(env)
+	}
+}
+
 func BenchmarkParseFib(b *testing.B) {
 	fset := gel.NewFileSet()
 	for i := 0; i < b.N; i++ {
-		_, _ = gel.ParseString(fset, "", "(func fib (n) (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2))))))")
+		_, _ = gel.ParseString(fset, "", "(func fib [n] (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2))))))")
 	}
 }
 
 func BenchmarkEvalFib10(b *testing.B) {
 	fset := gel.NewFileSet()
-	node, _ := gel.ParseString(fset, "", "(func fib (n) (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2)))))) (fib 10)")
+	node, _ := gel.ParseString(fset, "", "(func fib [n] (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2)))))) (fib 10)")
 	for i := 0; i < b.N; i++ {
 		scope, _ := gel.NewScope(fset)
 		_, _ = scope.Eval(node)
@@ -40,13 +55,33 @@ func BenchmarkEvalFib10(b *testing.B) {
 
 func BenchmarkEvalFib10ExistingScope(b *testing.B) {
 	fset := gel.NewFileSet()
-	node, _ := gel.ParseString(fset, "", "(func fib (n) (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2)))))) (fib 10)")
+	node, _ := gel.ParseString(fset, "", "(func fib [n] (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2)))))) (fib 10)")
 	scope, _ := gel.NewScope(fset)
 	for i := 0; i < b.N; i++ {
 		_, _ = scope.Eval(node)
 	}
 }
 
+func BenchmarkEvalFib10Compiled(b *testing.B) {
+	fset := gel.NewFileSet()
+	node, _ := gel.ParseString(fset, "", "(func fib [n] (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2)))))) (fib 10)")
+	program, _ := gel.Compile(fset, node)
+	for i := 0; i < b.N; i++ {
+		scope, _ := gel.NewScope(fset)
+		_, _ = program.Eval(scope)
+	}
+}
+
+func BenchmarkEvalFib20Compiled(b *testing.B) {
+	fset := gel.NewFileSet()
+	node, _ := gel.ParseString(fset, "", "(func fib [n] (if (== n 0) 0 (if (== n 1) 1 (+ (fib (- n 1)) (fib (- n 2)))))) (fib 20)")
+	program, _ := gel.Compile(fset, node)
+	scope, _ := gel.NewScope(fset)
+	for i := 0; i < b.N; i++ {
+		_, _ = program.Eval(scope.Branch())
+	}
+}
+
 func BenchmarkParseMacroEval(b *testing.B) {
 	fset := gel.NewFileSet()
 	node, _ := gel.ParseString(fset, "", "(repeatedly 100 (# true))")
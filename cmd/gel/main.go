@@ -16,7 +16,7 @@ func main() {
 		}
 		res, err := g.Eval(gel.NewEnv())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "error: %+v\n", err)
 			os.Exit(1)
 		}
 		fmt.Fprintf(os.Stderr, "%v\n", res)
@@ -0,0 +1,520 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/persistent"
+	"github.com/Stromberg/gel/utils"
+)
+
+// code is a compiled node. It evaluates the node in the given scope.
+type code func(s *Scope) (interface{}, error)
+
+// Program is a parsed expression compiled into a tree of Go closures.
+// Symbols bound by function parameters are resolved to slots at compile time
+// and special forms are resolved once instead of on every evaluation.
+type Program struct {
+	fset *ast.FileSet
+	node ast.Node
+	code code
+}
+
+// Compile compiles node, parsed into fset, into a Program.
+// Special forms are resolved against the modules in module.DefaultRepo.
+func Compile(fset *ast.FileSet, node ast.Node) (*Program, error) {
+	return CompileWithRepo(fset, node, module.DefaultRepo)
+}
+
+// CompileWithRepo compiles node, parsed into fset, into a Program.
+// Special forms are resolved against the modules in repo.
+func CompileWithRepo(fset *ast.FileSet, node ast.Node, repo *module.Repo) (*Program, error) {
+	prelude, err := preludeScope(repo)
+	if err != nil {
+		return nil, err
+	}
+	return newCompiler(fset, prelude).program(node), nil
+}
+
+// Compile compiles node into a Program.
+// Special forms are resolved against the symbols visible in s.
+func (s *Scope) Compile(node ast.Node) (*Program, error) {
+	return newCompiler(s.fset, s).program(node), nil
+}
+
+// Eval evaluates the program in the s scope and returns the resulting value.
+// Persistent lists and dicts in the value are returned as []interface{} and
+// map[interface{}]interface{}.
+func (p *Program) Eval(s *Scope) (value interface{}, err error) {
+	value, err = p.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	return plain(value), nil
+}
+
+func (p *Program) eval(s *Scope) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newCompiler(p.fset, s).panicAt(s, p.node, r)
+		}
+	}()
+
+	return p.code(s)
+}
+
+// compiler holds the state needed while compiling nodes into code.
+// Global symbols are resolved in scope. name is the name of the
+// function being compiled, for the call stacks of errors.
+type compiler struct {
+	fset  *ast.FileSet
+	scope *Scope
+	env   *cenv
+	name  string
+}
+
+// cenv is the compile time view of a runtime Scope. Every cenv
+// corresponds to exactly one Scope in the chain at runtime.
+type cenv struct {
+	parent  *cenv
+	frame   *frame
+	dynamic map[string]bool
+}
+
+// frame describes the slots of a function call scope.
+type frame struct {
+	names []string
+}
+
+func (f *frame) index(name string) int {
+	for i, n := range f.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func newCompiler(fset *ast.FileSet, scope *Scope) *compiler {
+	return &compiler{fset: fset, scope: scope, env: &cenv{}}
+}
+
+func (c *compiler) program(node ast.Node) *Program {
+	return &Program{fset: c.fset, node: node, code: c.compile(node)}
+}
+
+// branch returns a compiler for code that runs in s.Branch().
+func (c *compiler) branch() *compiler {
+	return &compiler{fset: c.fset, scope: c.scope, env: &cenv{parent: c.env}, name: c.name}
+}
+
+// function returns a compiler for the body of a function with the given parameters.
+func (c *compiler) function(name string, params []string) *compiler {
+	if name == "" {
+		name = "anonymous function"
+	}
+	return &compiler{fset: c.fset, scope: c.scope, env: &cenv{parent: c.env, frame: &frame{names: params}}, name: name}
+}
+
+// declare records that name is created at runtime in the current scope,
+// shadowing any slot with the same name for the code compiled after it.
+func (c *compiler) declare(name string) {
+	if c.env.dynamic == nil {
+		c.env.dynamic = make(map[string]bool)
+	}
+	c.env.dynamic[name] = true
+}
+
+// resolve finds the slot of name. It returns ok false if name must be
+// looked up by name at runtime.
+func (c *compiler) resolve(name string) (depth, index int, ok bool) {
+	for env := c.env; env != nil; env = env.parent {
+		if env.dynamic[name] {
+			return 0, 0, false
+		}
+		if env.frame != nil {
+			if i := env.frame.index(name); i >= 0 {
+				return depth, i, true
+			}
+		}
+		depth++
+	}
+	return 0, 0, false
+}
+
+// lookup returns the compile time value of a global symbol.
+func (c *compiler) lookup(name string) (interface{}, bool) {
+	if _, _, ok := c.resolve(name); ok {
+		return nil, false
+	}
+	for env := c.env; env != nil; env = env.parent {
+		if env.dynamic[name] {
+			return nil, false
+		}
+	}
+	v, err := c.scope.Get(name)
+	return v, err == nil
+}
+
+func (c *compiler) errorAt(node ast.Node, err error) error {
+	return frameErrorAt(c.fset, c.name, node, err)
+}
+
+func errorAt(fset *ast.FileSet, node ast.Node, err error) error {
+	return frameErrorAt(fset, "", node, err)
+}
+
+// frameErrorAt returns err as an *Error at node in function name.
+func frameErrorAt(fset *ast.FileSet, name string, node ast.Node, err error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	pinfo := fset.PosInfo(node.Pos())
+	return &Error{Err: err, PosInfo: pinfo, Stack: []Frame{{name, pinfo}}}
+}
+
+// callErrorAt returns the error of a call at node. An *Error comes from
+// a gel function that was called, the call is added to the stack of a copy
+// of it, as the error may be cached by compileForm or shared by goroutines.
+// Once the stack is full the frame after its innermost half is elided, so
+// that the copy costs at most MaxStack frames.
+func (c *compiler) callErrorAt(node ast.Node, err error) error {
+	e, ok := err.(*Error)
+	if !ok {
+		return c.errorAt(node, err)
+	}
+	copied := *e
+	frame := Frame{c.name, c.fset.PosInfo(node.Pos())}
+	if len(e.Stack) < MaxStack {
+		copied.Stack = make([]Frame, len(e.Stack), len(e.Stack)+1)
+		copy(copied.Stack, e.Stack)
+		copied.Stack = append(copied.Stack, frame)
+		return &copied
+	}
+	copied.Stack = make([]Frame, MaxStack)
+	copy(copied.Stack, e.Stack[:MaxStack/2])
+	copy(copied.Stack[MaxStack/2:], e.Stack[MaxStack/2+1:])
+	copied.Stack[MaxStack-1] = frame
+	copied.Elided++
+	return &copied
+}
+
+func constant(v interface{}) code {
+	return func(s *Scope) (interface{}, error) {
+		return v, nil
+	}
+}
+
+func (c *compiler) compile(node ast.Node) code {
+	switch node := node.(type) {
+	case *ast.Symbol:
+		return c.compileSymbol(node)
+	case *ast.Int:
+		return constant(node.Value)
+	case *ast.BigInt:
+		return constant(node.Value)
+	case *ast.Float:
+		return constant(node.Value)
+	case *ast.Decimal:
+		return constant(node.Value)
+	case *ast.String:
+		return constant(node.Value)
+	case *ast.Keyword:
+		return constant(Keyword(node.Name))
+	case *ast.List:
+		if len(node.Nodes) == 0 {
+			return constant(emptyList)
+		}
+		return c.compileCall(node)
+	case *ast.ListList:
+		// List and dict literals are persistent, so that they can be
+		// shared and updated with assoc, conj and dissoc.
+		if len(node.Nodes) == 0 {
+			return constant(persistent.EmptyVector)
+		}
+		args := c.compileAll(node.Nodes)
+		return func(s *Scope) (interface{}, error) {
+			vargs, err := evalAll(s, args)
+			if err != nil {
+				return nil, err
+			}
+			return persistent.NewVector(vargs...), nil
+		}
+	case *ast.DictList:
+		if len(node.Nodes) == 0 {
+			return constant(persistent.EmptyMap)
+		}
+		if len(node.Nodes)%2 != 0 {
+			err := c.errorAt(node, errors.New("dict requires an even number of arguments"))
+			return func(s *Scope) (interface{}, error) {
+				return nil, err
+			}
+		}
+		args := c.compileAll(node.Nodes)
+		return func(s *Scope) (interface{}, error) {
+			vargs, err := evalAll(s, args)
+			if err != nil {
+				return nil, err
+			}
+			return persistent.NewMap(vargs...)
+		}
+	case *ast.SetList:
+		args := c.compileAll(node.Nodes)
+		return func(s *Scope) (interface{}, error) {
+			vargs, err := evalAll(s, args)
+			if err != nil {
+				return nil, err
+			}
+			return persistent.NewSet(vargs...)
+		}
+	case *valueNode:
+		return constant(node.value)
+	case *ast.Root:
+		nodes := node.Nodes
+		codes := c.compileAll(nodes)
+		return func(s *Scope) (value interface{}, err error) {
+			for i, code := range codes {
+				value, err = code(s)
+				if err != nil {
+					return nil, c.errorAt(nodes[i], err)
+				}
+			}
+			return value, nil
+		}
+	}
+	err := fmt.Errorf("support for %#v not yet implemeted", node)
+	return func(s *Scope) (interface{}, error) {
+		return nil, err
+	}
+}
+
+func (c *compiler) compileAll(nodes []ast.Node) []code {
+	codes := make([]code, len(nodes))
+	for i, node := range nodes {
+		codes[i] = c.compile(node)
+	}
+	return codes
+}
+
+// compileBody compiles a sequence of nodes returning the value of the last one.
+func (c *compiler) compileBody(nodes []ast.Node) code {
+	codes := c.compileAll(nodes)
+	if len(codes) == 1 {
+		return codes[0]
+	}
+	return func(s *Scope) (value interface{}, err error) {
+		for _, code := range codes {
+			value, err = code(s)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	}
+}
+
+func evalAll(s *Scope, codes []code) ([]interface{}, error) {
+	vargs := make([]interface{}, len(codes))
+	for i, code := range codes {
+		value, err := code(s)
+		if err != nil {
+			return nil, err
+		}
+		vargs[i] = value
+	}
+	return vargs, nil
+}
+
+func (c *compiler) compileSymbol(node *ast.Symbol) code {
+	name := node.Name
+	if depth, index, ok := c.resolve(name); ok {
+		switch depth {
+		case 0:
+			return func(s *Scope) (interface{}, error) {
+				if s.rlockScopes() {
+					defer s.runlockScopes(true)
+				}
+				return s.slots[index], nil
+			}
+		case 1:
+			return func(s *Scope) (interface{}, error) {
+				if s.rlockScopes() {
+					defer s.runlockScopes(true)
+				}
+				return s.parent.slots[index], nil
+			}
+		}
+		return func(s *Scope) (interface{}, error) {
+			for i := 0; i < depth; i++ {
+				s = s.parent
+			}
+			if s.rlockScopes() {
+				defer s.runlockScopes(true)
+			}
+			return s.slots[index], nil
+		}
+	}
+	return func(s *Scope) (interface{}, error) {
+		value, err := s.Get(name)
+		if err != nil {
+			return nil, c.errorAt(node, err)
+		}
+		return value, nil
+	}
+}
+
+// compileSet compiles an assignment of the value computed by v to name.
+func (c *compiler) compileSet(name string, v code) code {
+	if depth, index, ok := c.resolve(name); ok {
+		return func(s *Scope) (interface{}, error) {
+			value, err := v(s)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < depth; i++ {
+				s = s.parent
+			}
+			locked := s.lockScopes()
+			s.slots[index] = value
+			s.unlockScopes(locked)
+			return nil, nil
+		}
+	}
+	return func(s *Scope) (interface{}, error) {
+		value, err := v(s)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.Set(name, value)
+	}
+}
+
+func (c *compiler) compileCall(node *ast.List) code {
+	head := node.Nodes[0]
+	args := node.Nodes[1:]
+
+	if symbol, ok := head.(*ast.Symbol); ok {
+		if fn, ok := c.lookup(symbol.Name); ok {
+			if form, ok := fn.(func(*compiler, []ast.Node) (code, error)); ok {
+				return c.compileHostableForm(node, symbol.Name, form)
+			}
+		}
+	}
+
+	fnCode := c.compile(head)
+	argCodes := c.compileAll(args)
+	var expansion atomic.Value
+	return func(s *Scope) (value interface{}, err error) {
+		if err := s.step(); err != nil {
+			return nil, c.errorAt(head, err)
+		}
+
+		fn, err := fnCode(s)
+		if err != nil {
+			return nil, c.errorAt(head, err)
+		}
+
+		switch fn := fn.(type) {
+		case func(*compiler, []ast.Node) (code, error):
+			// A special form that was not known at compile time.
+			return newCompiler(c.fset, s).compileForm(node, fn)(s)
+		case *Macro:
+			value, err = c.expandAt(s, node, fn, &expansion)
+			if err != nil {
+				return nil, c.errorAt(head, err)
+			}
+			return value, nil
+		case func(*Scope, []ast.Node) (interface{}, error):
+			value, err = fn(s, args)
+			if err != nil {
+				return nil, c.errorAt(head, err)
+			}
+			return value, nil
+		}
+
+		vargs, err := evalAll(s, argCodes)
+		if err != nil {
+			return nil, c.errorAt(head, err)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				err = c.panicAt(s, node, r)
+			}
+		}()
+
+		value, err = utils.Call(fn, vargs...)
+		if err != nil {
+			return nil, c.callErrorAt(head, err)
+		}
+		return value, nil
+	}
+}
+
+// panicAt returns the error for a panic recovered at node.
+// The Go stack is only kept when debugging.
+func (c *compiler) panicAt(s *Scope, node ast.Node, r interface{}) error {
+	e := c.errorAt(node, fmt.Errorf("%v", r)).(*Error)
+	if s.state != nil && s.state.debug {
+		e.GoStack = string(debug.Stack())
+	}
+	return e
+}
+
+// compileHostableForm compiles a call to the special form name, found at
+// compile time. The Env of an evaluation may define name, the call is then
+// compiled again against the runtime scope, as the variable takes
+// precedence over the form.
+func (c *compiler) compileHostableForm(node *ast.List, name string, form func(*compiler, []ast.Node) (code, error)) code {
+	formCode := c.compileForm(node, form)
+	return func(s *Scope) (interface{}, error) {
+		if s.state != nil && s.state.hostNames[name] {
+			cc := newCompiler(c.fset, s)
+			cc.name = c.name
+			return cc.compileCall(node)(s)
+		}
+		return formCode(s)
+	}
+}
+
+// compileForm compiles a call to a special form. Errors found while compiling
+// are reported when the form is evaluated.
+func (c *compiler) compileForm(node *ast.List, form func(*compiler, []ast.Node) (code, error)) code {
+	head := node.Nodes[0]
+	formCode, err := form(c, node.Nodes[1:])
+	if err != nil {
+		err = c.errorAt(head, err)
+		return func(s *Scope) (interface{}, error) {
+			return nil, err
+		}
+	}
+	return func(s *Scope) (interface{}, error) {
+		if err := s.step(); err != nil {
+			return nil, c.errorAt(head, err)
+		}
+		value, err := formCode(s)
+		if err != nil {
+			return nil, c.errorAt(head, err)
+		}
+		return value, nil
+	}
+}
+
+// scopeFunc returns a special form that evaluates its arguments like a
+// function call and passes them to fn together with the current scope.
+func scopeFunc(fn func(s *Scope, args ...interface{}) (interface{}, error)) func(*compiler, []ast.Node) (code, error) {
+	return func(c *compiler, args []ast.Node) (code, error) {
+		codes := c.compileAll(args)
+		return func(s *Scope) (interface{}, error) {
+			vargs, err := evalAll(s, codes)
+			if err != nil {
+				return nil, err
+			}
+			return fn(s, vargs...)
+		}, nil
+	}
+}
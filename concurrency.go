@@ -0,0 +1,438 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/utils"
+)
+
+// The scopes of an evaluation are only locked while goroutines started
+// during it are running, so evaluations that do not use go pay no more
+// than an atomic load. Scopes without an evaluation state, like the
+// prelude, are never locked.
+
+// lockScopes locks the scopes of the evaluation of s for writing if
+// goroutines are running. It returns whether the scopes were locked, to be
+// passed to unlockScopes.
+func (s *Scope) lockScopes() bool {
+	st := s.state
+	if st == nil || atomic.LoadInt32(&st.goroutines) == 0 {
+		return false
+	}
+	st.mu.Lock()
+	return true
+}
+
+func (s *Scope) unlockScopes(locked bool) {
+	if locked {
+		s.state.mu.Unlock()
+	}
+}
+
+// rlockScopes locks the scopes of the evaluation of s for reading if
+// goroutines are running.
+func (s *Scope) rlockScopes() bool {
+	st := s.state
+	if st == nil || atomic.LoadInt32(&st.goroutines) == 0 {
+		return false
+	}
+	st.mu.RLock()
+	return true
+}
+
+func (s *Scope) runlockScopes(locked bool) {
+	if locked {
+		s.state.mu.RUnlock()
+	}
+}
+
+var (
+	errClosedChan = errors.New("put! on closed channel")
+	errNotChan    = errors.New("Error in parameter type, expected a channel")
+)
+
+// channel is a gel channel, created by chan and go.
+type channel struct {
+	ch     chan interface{}
+	mu     sync.Mutex
+	closed bool
+}
+
+// failed is put in the channel of a goroutine that returned an error,
+// taking it raises the error.
+type failed struct {
+	err error
+}
+
+func (c *channel) String() string {
+	return "#chan"
+}
+
+func (c *channel) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("close! of closed channel")
+	}
+	c.closed = true
+	close(c.ch)
+	return nil
+}
+
+// done returns the channel closed when the evaluation of s is canceled.
+// It is nil, blocking forever, for scopes outside of Gel.EvalContext and
+// once the evaluation has returned.
+func done(s *Scope) <-chan struct{} {
+	if s.state == nil || atomic.LoadInt32(&s.state.ended) != 0 {
+		return nil
+	}
+	return s.state.done
+}
+
+// received returns the value v taken from a channel.
+func received(v interface{}) (interface{}, error) {
+	if f, ok := v.(failed); ok {
+		return nil, f.err
+	}
+	return v, nil
+}
+
+// send sends v on c, failing instead of panicking if c is closed.
+func send(s *Scope, c *channel, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errClosedChan
+		}
+	}()
+	select {
+	case c.ch <- v:
+		return nil
+	case <-done(s):
+		return s.state.ctx.Err()
+	}
+}
+
+func toChan(v interface{}) (*channel, error) {
+	c, ok := v.(*channel)
+	if !ok {
+		return nil, errNotChan
+	}
+	return c, nil
+}
+
+var chanFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if len(args) > 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	n := 0
+	if len(args) == 1 {
+		var err error
+		if n, err = toInt(args[0]); err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errors.New("negative channel buffer size")
+		}
+	}
+	return &channel{ch: make(chan interface{}, n)}, nil
+})
+
+var isChanFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(*channel)
+	return ok
+}, utils.CheckArity(1))
+
+func putChanFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	c, err := toChan(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := send(s, c, args[1]); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func takeChanFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	c, err := toChan(args[0])
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case v := <-c.ch:
+		return received(v)
+	case <-done(s):
+		return nil, s.state.ctx.Err()
+	}
+}
+
+var closeChanFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	c, err := toChan(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return nil, c.close()
+}, utils.CheckArity(1))
+
+// waitGroup waits for the goroutines started with it by go.
+type waitGroup struct {
+	wg  sync.WaitGroup
+	mu  sync.Mutex
+	err error
+}
+
+func (w *waitGroup) String() string {
+	return "#wait-group"
+}
+
+func (w *waitGroup) done(err error) {
+	if err != nil {
+		w.mu.Lock()
+		if w.err == nil {
+			w.err = err
+		}
+		w.mu.Unlock()
+	}
+	w.wg.Done()
+}
+
+var waitGroupFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	return &waitGroup{}
+}, utils.CheckArity(0))
+
+func waitFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	w, ok := args[0].(*waitGroup)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	finished := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-done(s):
+		return nil, s.state.ctx.Err()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return nil, w.err
+}
+
+// goFn calls a gel function in a new goroutine. It returns a channel that
+// receives the result of the function and is then closed.
+func goFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	w, _ := args[0].(*waitGroup)
+	if w != nil {
+		args = args[1:]
+		if len(args) == 0 {
+			return nil, utils.ErrWrongNumberPar
+		}
+	}
+	f, fargs := args[0], args[1:]
+	if f == nil || reflect.TypeOf(f).Kind() != reflect.Func {
+		return nil, errors.New("go takes a function")
+	}
+	if w != nil {
+		w.wg.Add(1)
+	}
+	c := &channel{ch: make(chan interface{}, 1)}
+	st := s.state
+	var depth int64
+	if st != nil {
+		depth = st.spawn()
+	}
+	go func() {
+		var v interface{}
+		var err error
+		var id int64
+		if st != nil {
+			id = st.begin(depth)
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+			if err != nil {
+				c.ch <- failed{err}
+			} else {
+				c.ch <- v
+			}
+			c.close()
+			if st != nil {
+				st.exit(id)
+			}
+			if w != nil {
+				w.done(err)
+			}
+		}()
+		v, err = utils.Call(f, fargs...)
+	}()
+	return c, nil
+}
+
+// toTimeout converts a select timeout, a duration or a number of
+// milliseconds.
+func toTimeout(v interface{}) (time.Duration, error) {
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case int64:
+		return time.Duration(v) * time.Millisecond, nil
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	}
+	return 0, errors.New("timeout must be a duration or a number of milliseconds")
+}
+
+// selectClause is a compiled clause of select.
+type selectClause struct {
+	kind  string
+	arg   code
+	value code
+	name  string
+	body  code
+}
+
+func selectFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) == 0 {
+		return nil, errors.New("select takes at least one clause")
+	}
+	clauses := make([]*selectClause, len(args))
+	hasDefault := false
+	for i, arg := range args {
+		cl := &selectClause{}
+		var args []ast.Node
+		for _, kind := range []string{"take", "put", "timeout", "default"} {
+			if nodes, ok := clause(arg, kind); ok {
+				cl.kind, args = kind, nodes
+				break
+			}
+		}
+		switch cl.kind {
+		case "take":
+			if len(args) < 2 {
+				return nil, errors.New("take clause takes a channel and a symbol")
+			}
+			symbol, ok := args[1].(*ast.Symbol)
+			if !ok {
+				return nil, errors.New("take clause takes a channel and a symbol")
+			}
+			cl.arg, cl.name = c.compile(args[0]), symbol.Name
+			cc := c.branch()
+			cc.declare(cl.name)
+			cl.body = cc.compileBody(args[2:])
+		case "put":
+			if len(args) < 2 {
+				return nil, errors.New("put clause takes a channel and a value")
+			}
+			cl.arg, cl.value = c.compile(args[0]), c.compile(args[1])
+			cl.body = c.branch().compileBody(args[2:])
+		case "timeout":
+			if len(args) < 1 {
+				return nil, errors.New("timeout clause takes a duration")
+			}
+			cl.arg = c.compile(args[0])
+			cl.body = c.branch().compileBody(args[1:])
+		case "default":
+			if hasDefault {
+				return nil, errors.New("select takes at most one default clause")
+			}
+			hasDefault = true
+			cl.body = c.branch().compileBody(args)
+		default:
+			return nil, errors.New("select clauses are (take ch v stmts...), (put ch x stmts...), (timeout d stmts...) or (default stmts...)")
+		}
+		clauses[i] = cl
+	}
+
+	return func(scope *Scope) (value interface{}, err error) {
+		cases := make([]reflect.SelectCase, len(clauses), len(clauses)+1)
+		for i, cl := range clauses {
+			switch cl.kind {
+			case "take", "put":
+				v, err := cl.arg(scope)
+				if err != nil {
+					return nil, err
+				}
+				ch, err := toChan(v)
+				if err != nil {
+					return nil, err
+				}
+				cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.ch)}
+				if cl.kind == "put" {
+					if v, err = cl.value(scope); err != nil {
+						return nil, err
+					}
+					cases[i] = reflect.SelectCase{Dir: reflect.SelectSend, Chan: reflect.ValueOf(ch.ch), Send: reflect.ValueOf(&v).Elem()}
+				}
+			case "timeout":
+				v, err := cl.arg(scope)
+				if err != nil {
+					return nil, err
+				}
+				d, err := toTimeout(v)
+				if err != nil {
+					return nil, err
+				}
+				cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(time.After(d))}
+			case "default":
+				cases[i] = reflect.SelectCase{Dir: reflect.SelectDefault}
+			}
+		}
+		if d := done(scope); d != nil {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(d)})
+		}
+
+		chosen, v, err := selectCases(cases)
+		if err != nil {
+			return nil, err
+		}
+		if chosen == len(clauses) {
+			return nil, scope.state.ctx.Err()
+		}
+		cl := clauses[chosen]
+		s := scope.Branch()
+		if cl.kind == "take" {
+			var x interface{}
+			if v.IsValid() && !v.IsNil() {
+				if x, err = received(v.Interface()); err != nil {
+					return nil, err
+				}
+			}
+			s.vars = map[string]interface{}{cl.name: x}
+		}
+		return cl.body(s)
+	}, nil
+}
+
+// selectCases is reflect.Select failing instead of panicking when a put
+// clause sends on a closed channel.
+func selectCases(cases []reflect.SelectCase) (chosen int, v reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errClosedChan
+		}
+	}()
+	chosen, v, _ = reflect.Select(cases)
+	return chosen, v, nil
+}
@@ -0,0 +1,154 @@
+package gel_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel"
+	"github.com/Stromberg/gel/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func evalString(t *testing.T, expr string) (interface{}, error) {
+	g, err := gel.New(expr)
+	assert.NoError(t, err, expr)
+	return g.Eval(gel.NewEnv())
+}
+
+func TestGo(t *testing.T) {
+	r, err := evalString(t, "(take! (go (fn [x] (* x 2)) 21))")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), r)
+
+	r, err = evalString(t, "(var ch (go (fn [] 1))) [(take! ch) (take! ch) (chan? ch)]")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), nil, true}, r)
+
+	_, err = evalString(t, `(take! (go (fn [] (throw "boom"))))`)
+	assert.EqualError(t, err, "twik source:1:20: boom")
+
+	_, err = evalString(t, "(go 1)")
+	assert.EqualError(t, err, "twik source:1:2: go takes a function")
+}
+
+func TestChannels(t *testing.T) {
+	r, err := evalString(t, "(var ch (chan 3)) (put! ch 1) (put! ch 2) (close! ch) [(take! ch) (take! ch) (take! ch)]")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2), nil}, r)
+
+	r, err = evalString(t, `
+(var ch (chan))
+(go (fn [] (for (var i 0) (< i 5) (set i (inc i)) (put! ch i)) (close! ch)))
+(var sum 0)
+(var v (take! ch))
+(while (!= v nil) (set sum (+ sum v)) (set v (take! ch)))
+sum`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), r)
+
+	_, err = evalString(t, "(var ch (chan)) (close! ch) (close! ch)")
+	assert.EqualError(t, err, "twik source:1:30: close! of closed channel")
+
+	_, err = evalString(t, "(var ch (chan 1)) (close! ch) (put! ch 1)")
+	assert.EqualError(t, err, "twik source:1:32: put! on closed channel")
+
+	_, err = evalString(t, "(take! 1)")
+	assert.EqualError(t, err, "twik source:1:2: Error in parameter type, expected a channel")
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value interface{}
+	}{
+		{"(select (take (chan) v v) (timeout 10 :timeout))", utils.Keyword("timeout")},
+		{`(select (take (chan) v v) (timeout (time/duration "1ms") :timeout))`, utils.Keyword("timeout")},
+		{"(var ch (chan 1)) (put! ch 3) (select (take ch v (* v 2)) (timeout 1000 :timeout))", int64(6)},
+		{"(select (take (chan) v v) (default :default))", utils.Keyword("default")},
+		{"(var ch (chan 1)) (select (put ch 7 :sent) (default :full)) (take! ch)", int64(7)},
+		{"(var ch (chan)) (close! ch) (select (take ch v [v])) ", []interface{}{nil}},
+	}
+	for _, test := range tests {
+		r, err := evalString(t, test.expr)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, r, test.expr)
+	}
+
+	_, err := evalString(t, "(select (take (chan) 1 1))")
+	assert.EqualError(t, err, "twik source:1:2: take clause takes a channel and a symbol")
+	_, err = evalString(t, "(select (recv (chan) v))")
+	assert.Error(t, err)
+	_, err = evalString(t, "(select)")
+	assert.EqualError(t, err, "twik source:1:2: select takes at least one clause")
+}
+
+func TestWaitGroup(t *testing.T) {
+	r, err := evalString(t, `
+(var wg (wait-group))
+(var results (chan 10))
+(var counter 0)
+(func work [n] (var x (* n n)) (set counter (inc counter)) (put! results x))
+(for (var i 0) (< i 10) (set i (inc i)) (go wg work i))
+(wait wg)
+(close! results)
+(var sum 0)
+(var v (take! results))
+(while (!= v nil) (set sum (+ sum v)) (set v (take! results)))
+sum`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(285), r)
+
+	g, err := gel.New("(var wg (wait-group)) (go wg (fn [] 1)) (go wg fail) (wait wg)")
+	assert.NoError(t, err)
+	env := gel.NewEnv()
+	env.AddVar("fail", func(args ...interface{}) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	_, err = g.Eval(env)
+	assert.EqualError(t, err, "twik source:1:55: failed")
+}
+
+func TestConcurrencyCanceled(t *testing.T) {
+	for _, expr := range []string{
+		"(take! (chan))",
+		"(put! (chan) 1)",
+		"(select (take (chan) v v))",
+		"(var wg (wait-group)) (go wg (fn [] (while true 1))) (wait wg)",
+	} {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err = g.EvalContext(ctx, gel.NewEnv())
+		cancel()
+		e, ok := err.(*gel.Error)
+		assert.True(t, ok, expr)
+		if ok {
+			assert.Equal(t, context.DeadlineExceeded, e.Err, expr)
+		}
+	}
+}
+
+func TestGoStoppedWithEval(t *testing.T) {
+	var ticks int64
+	env := gel.NewEnv()
+	env.AddVar("tick", func(args ...interface{}) (interface{}, error) {
+		return atomic.AddInt64(&ticks, 1), nil
+	})
+	for _, expr := range []string{
+		"(go (fn [] (while true (tick)))) 1",
+		"(go (fn [] (take! (chan)))) (go (fn [] (while true (tick)))) 1",
+	} {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		r, err := g.Eval(env)
+		assert.NoError(t, err, expr)
+		assert.Equal(t, int64(1), r, expr)
+
+		n := atomic.LoadInt64(&ticks)
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, n, atomic.LoadInt64(&ticks), expr)
+	}
+}
@@ -0,0 +1,385 @@
+package gel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/persistent"
+	"github.com/Stromberg/gel/utils"
+)
+
+// ReadData parses a single value written in the gel data format, without
+// evaluating anything. The data format is the literal syntax of gel:
+// numbers, decimals, strings, keywords, nil, true and false, lists in []
+// or (), dicts in {} and sets in #{}. Values without a literal are written
+// with a tag before a literal: #vec [1.0 2.0] for a vec,
+// #inst "2020-05-01T00:00:00Z" for a time, #duration "1h30m0s" for a
+// duration and #rat "1/3" for a rational. Keywords and symbols whose names
+// cannot be read back as written, like (keyword "a b"), are written as
+// #keyword "a b" and #symbol "a b". Other symbols are read as Symbols,
+// like quoted code.
+func ReadData(data string) (interface{}, error) {
+	return readData("data", data)
+}
+
+// WriteData writes v in the gel data format, so that ReadData returns a
+// value equal to v. Functions, channels and other Go values cannot be
+// written.
+func WriteData(v interface{}) (string, error) {
+	var b strings.Builder
+	if err := writeData(&b, v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func readData(name, data string) (interface{}, error) {
+	fset := ast.NewFileSet()
+	node, err := ast.ParseString(fset, name, data)
+	if err != nil {
+		return nil, err
+	}
+	r := &dataReader{fset: fset}
+	values, err := r.readAll(node.(*ast.Root).Nodes)
+	if err != nil {
+		return nil, err
+	}
+	switch len(values) {
+	case 0:
+		return nil, fmt.Errorf("%s no value to read", fset.PosInfo(node.End()))
+	case 1:
+		return values[0], nil
+	}
+	return nil, fmt.Errorf("%s more than one value to read", fset.PosInfo(node.End()))
+}
+
+type dataReader struct {
+	fset *ast.FileSet
+}
+
+func (r *dataReader) errorf(node ast.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("%s %s", r.fset.PosInfo(node.Pos()), fmt.Sprintf(format, args...))
+}
+
+// readAll reads the values of nodes. A tag takes the node after it.
+func (r *dataReader) readAll(nodes []ast.Node) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(nodes))
+	for i := 0; i < len(nodes); i++ {
+		if sym, ok := nodes[i].(*ast.Symbol); ok && strings.HasPrefix(sym.Name, "#") {
+			if i+1 == len(nodes) {
+				return nil, r.errorf(sym, "missing value after %s", sym.Name)
+			}
+			i++
+			v, err := r.readTagged(sym, nodes[i])
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			continue
+		}
+		v, err := r.read(nodes[i])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (r *dataReader) read(node ast.Node) (interface{}, error) {
+	switch node := node.(type) {
+	case *ast.Symbol:
+		switch node.Name {
+		case "nil":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return Symbol(node.Name), nil
+	case *ast.Int:
+		return node.Value, nil
+	case *ast.BigInt:
+		return node.Value, nil
+	case *ast.Float:
+		return node.Value, nil
+	case *ast.Decimal:
+		return node.Value, nil
+	case *ast.String:
+		return node.Value, nil
+	case *ast.Keyword:
+		return Keyword(node.Name), nil
+	case *ast.List:
+		return r.readAll(node.Nodes)
+	case *ast.ListList:
+		return r.readAll(node.Nodes)
+	case *ast.DictList:
+		list, err := r.readAll(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		d, err := utils.NewDict(list...)
+		if err != nil {
+			return nil, r.errorf(node, "%v", err)
+		}
+		return d, nil
+	case *ast.SetList:
+		list, err := r.readAll(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		s, err := persistent.NewSet(list...)
+		if err != nil {
+			return nil, r.errorf(node, "%v", err)
+		}
+		return s, nil
+	}
+	return nil, r.errorf(node, "cannot read %s", r.fset.Code(node))
+}
+
+func (r *dataReader) readTagged(tag *ast.Symbol, node ast.Node) (interface{}, error) {
+	v, err := r.read(node)
+	if err != nil {
+		return nil, err
+	}
+	switch tag.Name {
+	case "#vec":
+		if l, ok := v.([]interface{}); ok {
+			vec := make([]float64, len(l))
+			for i, x := range l {
+				switch x := x.(type) {
+				case float64:
+					vec[i] = x
+				case int64:
+					vec[i] = float64(x)
+				default:
+					return nil, r.errorf(node, "#vec takes a list of numbers")
+				}
+			}
+			return vec, nil
+		}
+		return nil, r.errorf(node, "#vec takes a list of numbers")
+	case "#inst":
+		if s, ok := v.(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, r.errorf(node, "invalid #inst: %s", s)
+			}
+			return t, nil
+		}
+		return nil, r.errorf(node, "#inst takes a RFC 3339 string")
+	case "#duration":
+		if s, ok := v.(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, r.errorf(node, "invalid #duration: %s", s)
+			}
+			return d, nil
+		}
+		return nil, r.errorf(node, "#duration takes a duration string")
+	case "#rat":
+		if s, ok := v.(string); ok {
+			if rat, ok := new(big.Rat).SetString(s); ok {
+				return rat, nil
+			}
+			return nil, r.errorf(node, "invalid #rat: %s", s)
+		}
+		return nil, r.errorf(node, "#rat takes a rational string")
+	case "#keyword":
+		if s, ok := v.(string); ok {
+			return Keyword(s), nil
+		}
+		return nil, r.errorf(node, "#keyword takes a string")
+	case "#symbol":
+		if s, ok := v.(string); ok {
+			return Symbol(s), nil
+		}
+		return nil, r.errorf(node, "#symbol takes a string")
+	}
+	return nil, r.errorf(tag, "unknown tag %s", tag.Name)
+}
+
+func writeData(b *strings.Builder, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("nil")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case *big.Int:
+		b.WriteString(v.String())
+	case *big.Rat:
+		b.WriteString("#rat " + strconv.Quote(v.RatString()))
+	case float64:
+		s, err := formatFloat(v)
+		if err != nil {
+			return err
+		}
+		b.WriteString(s)
+	case num.Decimal:
+		b.WriteString(v.String() + "M")
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case Keyword:
+		if isPlainKeyword(string(v)) {
+			b.WriteString(":" + string(v))
+		} else {
+			b.WriteString("#keyword " + strconv.Quote(string(v)))
+		}
+	case Symbol:
+		if isPlainSymbol(string(v)) {
+			b.WriteString(string(v))
+		} else {
+			b.WriteString("#symbol " + strconv.Quote(string(v)))
+		}
+	case time.Time:
+		b.WriteString("#inst " + strconv.Quote(v.Format(time.RFC3339Nano)))
+	case time.Duration:
+		b.WriteString("#duration " + strconv.Quote(v.String()))
+	case []float64:
+		b.WriteString("#vec [")
+		for i, f := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			s, err := formatFloat(f)
+			if err != nil {
+				return err
+			}
+			b.WriteString(s)
+		}
+		b.WriteByte(']')
+	case []interface{}:
+		return writeSeq(b, "[", "]", v)
+	case *persistent.Vector:
+		return writeSeq(b, "[", "]", v.Slice())
+	case *lazy.Seq:
+		list, err := utils.ToList(v)
+		if err != nil {
+			return err
+		}
+		return writeSeq(b, "[", "]", list)
+	case map[interface{}]interface{}:
+		return writeDict(b, v)
+	case *persistent.Map:
+		return writeDict(b, v.ToMap())
+	case *persistent.Set:
+		return writeSeq(b, "#{", "}", v.Slice())
+	default:
+		return fmt.Errorf("cannot write %s as data", utils.TypeName(v))
+	}
+	return nil
+}
+
+// writeDict writes the entries of d sorted by key, for a stable output.
+func writeDict(b *strings.Builder, d map[interface{}]interface{}) error {
+	keys := make([]interface{}, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	entries := make([]interface{}, 0, 2*len(d))
+	for _, k := range keys {
+		entries = append(entries, k, d[k])
+	}
+	return writeSeq(b, "{", "}", entries)
+}
+
+func writeSeq(b *strings.Builder, open, close string, values []interface{}) error {
+	b.WriteString(open)
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if err := writeData(b, v); err != nil {
+			return err
+		}
+	}
+	b.WriteString(close)
+	return nil
+}
+
+// isPlainKeyword reports whether the keyword name is read back from
+// :name as the same keyword.
+func isPlainKeyword(name string) bool {
+	kw, ok := parseOne(":" + name).(*ast.Keyword)
+	return ok && kw.Name == name
+}
+
+// isPlainSymbol reports whether the symbol name is read back from name as
+// the same symbol, and not as a value or a tag.
+func isPlainSymbol(name string) bool {
+	switch name {
+	case "nil", "true", "false":
+		return false
+	}
+	sym, ok := parseOne(name).(*ast.Symbol)
+	return ok && sym.Name == name && !strings.HasPrefix(name, "#")
+}
+
+// parseOne parses code that holds a single node, or returns nil.
+func parseOne(code string) ast.Node {
+	node, err := ast.ParseString(ast.NewFileSet(), "", code)
+	if err != nil {
+		return nil
+	}
+	if nodes := node.(*ast.Root).Nodes; len(nodes) == 1 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// formatFloat formats f so that it is read back as a float, with a dot
+// in the mantissa.
+func formatFloat(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("cannot write %v as data", f)
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.Contains(s, ".") {
+		return s, nil
+	}
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		return s[:i] + ".0" + s[i:], nil
+	}
+	return s + ".0", nil
+}
+
+var readStringFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return ReadData(s)
+}, utils.CheckArity(1))
+
+var readFileFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	file, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	data, err := ioutil.ReadFile(path.Join(module.BasePath, file))
+	if err != nil {
+		return nil, err
+	}
+	return readData(file, string(data))
+}, utils.CheckArity(1))
+
+var prStrFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return WriteData(args[0])
+}, utils.CheckArity(1))
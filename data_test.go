@@ -0,0 +1,144 @@
+package gel_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel"
+	"github.com/Stromberg/gel/module"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadData(t *testing.T) {
+	tests := []struct {
+		data  string
+		value interface{}
+	}{
+		{"1", int64(1)},
+		{"-2.5", -2.5},
+		{`"a\"b"`, "a\"b"},
+		{":k", gel.Keyword("k")},
+		{"nil", nil},
+		{"true", true},
+		{"x", gel.Symbol("x")},
+		{"[1 [2] (3 :a)]", []interface{}{int64(1), []interface{}{int64(2)}, []interface{}{int64(3), gel.Keyword("a")}}},
+		{"[]", []interface{}{}},
+		{`{:a 1 "b" [2.0]}`, map[interface{}]interface{}{gel.Keyword("a"): int64(1), "b": []interface{}{2.0}}},
+		{"#vec [1.0 2]", []float64{1, 2}},
+		{`#inst "2020-05-01T13:30:00Z"`, time.Date(2020, 5, 1, 13, 30, 0, 0, time.UTC)},
+		{"9223372036854775808", new(big.Int).Lsh(big.NewInt(1), 63)},
+		{"1e21", 1e21},
+		{`#rat "1/3"`, big.NewRat(1, 3)},
+		{`#duration "1h30m"`, 90 * time.Minute},
+		{`#keyword "a b"`, gel.Keyword("a b")},
+		{`#symbol "nil"`, gel.Symbol("nil")},
+		{"; comment\n(+ 1 2)", []interface{}{gel.Symbol("+"), int64(1), int64(2)}},
+	}
+	for _, test := range tests {
+		v, err := gel.ReadData(test.data)
+		assert.NoError(t, err, test.data)
+		assert.Equal(t, test.value, v, test.data)
+	}
+
+	errorTests := []struct {
+		data string
+		err  string
+	}{
+		{"", "data:1:1: no value to read"},
+		{"1 2", "data:1:4: more than one value to read"},
+		{"[1", "data:1:3: missing ]"},
+		{"{:a}", "data:1:1: dict requires an even number of arguments"},
+		{"#vec [:a]", "data:1:6: #vec takes a list of numbers"},
+		{`#inst "may"`, `data:1:7: invalid #inst: may`},
+		{`#rat "1/0"`, `data:1:6: invalid #rat: 1/0`},
+		{`#duration 1`, `data:1:11: #duration takes a duration string`},
+		{`#keyword :a`, `data:1:10: #keyword takes a string`},
+		{"[#foo 1]", "data:1:2: unknown tag #foo"},
+		{"[#vec]", "data:1:2: missing value after #vec"},
+	}
+	for _, test := range errorTests {
+		_, err := gel.ReadData(test.data)
+		assert.EqualError(t, err, test.err, test.data)
+	}
+}
+
+func TestWriteData(t *testing.T) {
+	values := []interface{}{
+		nil, true, int64(-3), 2.0, 1e21, 1.5e-7, "a\\\"b\n", gel.Keyword("k"),
+		[]interface{}{int64(1), []interface{}{}, "x"},
+		[]float64{1, 2.5},
+		map[interface{}]interface{}{gel.Keyword("a"): []interface{}{int64(1)}, "b": map[interface{}]interface{}{}},
+		time.Date(2020, 5, 1, 13, 30, 0, 5, time.UTC),
+		new(big.Int).Lsh(big.NewInt(-1), 100),
+		big.NewRat(-7, 3),
+		90*time.Minute + time.Nanosecond, -time.Second,
+		gel.Keyword("a b"), gel.Keyword(""), gel.Keyword("a:b"), gel.Keyword("[x]"),
+		gel.Symbol("x"), gel.Symbol("a b"), gel.Symbol("nil"), gel.Symbol("#vec"), gel.Symbol("1"), gel.Symbol(""),
+	}
+	for _, v := range values {
+		s, err := gel.WriteData(v)
+		assert.NoError(t, err, "%#v", v)
+		r, err := gel.ReadData(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, v, r, s)
+	}
+
+	s, err := gel.WriteData(map[interface{}]interface{}{"b": 2.0, gel.Keyword("a"): []float64{1}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{:a #vec [1.0] "b" 2.0}`, s)
+	s, err = gel.WriteData([]interface{}{gel.Keyword("a b"), gel.Symbol("true"), big.NewRat(1, 3), 2 * time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, `[#keyword "a b" #symbol "true" #rat "1/3" #duration "2s"]`, s)
+
+	_, err = gel.WriteData(func(args ...interface{}) (interface{}, error) { return nil, nil })
+	assert.EqualError(t, err, "cannot write function as data")
+	_, err = gel.WriteData([]interface{}{make(chan int)})
+	assert.EqualError(t, err, "cannot write chan int as data")
+}
+
+func TestReadString(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value interface{}
+	}{
+		{`(read-string "{:a [1 2.5]}")`, map[interface{}]interface{}{gel.Keyword("a"): []interface{}{int64(1), 2.5}}},
+		{`(read-string "(launch missiles)")`, []interface{}{gel.Symbol("launch"), gel.Symbol("missiles")}},
+		{`(pr-str {:a [1 "x" (vec 2)] :b nil})`, `{:a [1 "x" #vec [2.0]] :b nil}`},
+		{`(var x {:a [1 "x" (vec 2)] :b #{:c 2.0}}) (== x (read-string (pr-str x)))`, true},
+		{`(var x [1.0 "\\" :k [] {}]) (== x (read-string (pr-str x)))`, true},
+		{`(var x [9223372036854775808 (rational 1 3) 1e21 (keyword "a b") (symbol "(x)")]) (== x (read-string (pr-str x)))`, true},
+		{`(pr-str (take 3 (lazy-range)))`, `[0 1 2]`},
+	}
+	for _, test := range tests {
+		r, err := evalString(t, test.expr)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, r, test.expr)
+	}
+
+	_, err := evalString(t, `(pr-str inc)`)
+	assert.EqualError(t, err, "twik source:1:2: cannot write function as data")
+	_, err = evalString(t, `(read-string "[1")`)
+	assert.EqualError(t, err, "twik source:1:2: data:1:3: missing ]")
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gel")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "config.edn"), []byte("{:workers 4\n :names [\"a\" \"b\"]}\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bad.edn"), []byte("[1\n 2}"), 0644))
+
+	basePath := module.BasePath
+	module.BasePath = dir
+	defer func() { module.BasePath = basePath }()
+
+	r, err := evalString(t, `(read-file "config.edn")`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[interface{}]interface{}{gel.Keyword("workers"): int64(4), gel.Keyword("names"): []interface{}{"a", "b"}}, r)
+	_, err = evalString(t, `(read-file "bad.edn")`)
+	assert.EqualError(t, err, "twik source:1:2: bad.edn:2:4: unexpected }")
+}
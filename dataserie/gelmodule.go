@@ -221,29 +221,40 @@ var Module = &module.Module{
 		},
 		&module.Func{
 			Name:        "ds.LagFill",
-			Signature:   "(dataserie.LagFill ds n)",
-			Description: "Shifts the data n steps forward in time by adding months at the end.",
-			F: utils.ErrFunc(func(ds *DataSerie, n int) (interface{}, error) {
-				next := func(s string) string {
-					t, _ := time.Parse("2006-01-02", s)
-					t = t.AddDate(0, 1, 0)
-					return t.Format("2006-01-02")
+			Signature:   "(dataserie.LagFill ds n) or (dataserie.LagFill ds n next)",
+			Description: "Shifts the data n steps forward in time by adding months at the end.\nWith next, a function like (time/x-step :day), the X values are stepped with next.",
+			F: utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+				ds, ok := args[0].(*DataSerie)
+				if !ok {
+					return nil, utils.ErrParameterType
 				}
-				return ds.LagFill(n, next), nil
-			}, utils.CheckArity(2), utils.ParamToInt(1)),
+				var err error
+				next := nextX(args[2:], "", &err)
+				res := ds.LagFill(args[1].(int), next)
+				if err != nil {
+					return nil, err
+				}
+				return res, nil
+			}, utils.CheckArityAtLeast(2), utils.ParamToInt(1)),
 		},
 		&module.Func{
 			Name:        "ds.PadLastUntil",
-			Signature:   "(dataserie.PadLastUntil ds until)",
-			Description: "Pads the data serie with new monthly data repeating the last value in Ys",
-			F: utils.ErrFunc(func(ds *DataSerie, until string) (interface{}, error) {
-				next := func(s string) string {
-					t, _ := time.Parse("2006-01-02", s)
-					t = t.AddDate(0, 1, 0)
-					return t.Format("2006-01-02")
+			Signature:   "(dataserie.PadLastUntil ds until) or (dataserie.PadLastUntil ds until next)",
+			Description: "Pads the data serie with new monthly data repeating the last value in Ys.\nWith next, a function like (time/x-step :day), the X values are stepped with next.",
+			F: utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+				ds, ok := args[0].(*DataSerie)
+				until, ok2 := args[1].(string)
+				if !ok || !ok2 {
+					return nil, utils.ErrParameterType
 				}
-				return ds.PadLastUntil(until, next), nil
-			}, utils.CheckArity(2)),
+				var err error
+				next := nextX(args[2:], until, &err)
+				res := ds.PadLastUntil(until, next)
+				if err != nil {
+					return nil, err
+				}
+				return res, nil
+			}, utils.CheckArityAtLeast(2)),
 		},
 		&module.Func{
 			Name:        "ds.Union!",
@@ -256,3 +267,30 @@ var Module = &module.Module{
 		},
 	},
 }
+
+// nextX returns the function stepping X values, the gel function in args
+// or monthly by default. The first error of the gel function is stored in
+// err and makes the function return stop from then on.
+func nextX(args []interface{}, stop string, err *error) func(s string) string {
+	if len(args) == 0 {
+		return func(s string) string {
+			t, _ := time.Parse("2006-01-02", s)
+			t = t.AddDate(0, 1, 0)
+			return t.Format("2006-01-02")
+		}
+	}
+	return func(s string) string {
+		if *err != nil {
+			return stop
+		}
+		v, e := utils.Call(args[0], s)
+		if e == nil {
+			if x, ok := v.(string); ok {
+				return x
+			}
+			e = fmt.Errorf("next returned %v, expected a string", v)
+		}
+		*err = e
+		return stop
+	}
+}
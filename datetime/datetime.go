@@ -0,0 +1,121 @@
+// Package datetime implements the calendar arithmetic of the time module:
+// month and business day stepping and conversions to the X values of
+// data series.
+package datetime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// XLayout is the layout of the dates used as X values in data series.
+const XLayout = "2006-01-02"
+
+// ParseX parses an X value like 2019-03-31 as a date in UTC.
+func ParseX(s string) (time.Time, error) {
+	return time.Parse(XLayout, s)
+}
+
+// FormatX formats t as an X value.
+func FormatX(t time.Time) string {
+	return t.Format(XLayout)
+}
+
+// StartOfMonth returns midnight of the first day in the month of t.
+func StartOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfMonth returns the last day in the month of t, keeping the clock of t.
+func EndOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 0, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// IsEndOfMonth reports whether t is on the last day of its month.
+func IsEndOfMonth(t time.Time) bool {
+	return t.Day() == EndOfMonth(t).Day()
+}
+
+// AddMonths adds n months to t. Unlike time.AddDate the day is clamped to
+// the end of the resulting month, so January 31 plus one month is the last
+// day of February.
+func AddMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := EndOfMonth(first).Day(); t.Day() > last {
+		return first.AddDate(0, 0, last-1)
+	}
+	return first.AddDate(0, 0, t.Day()-1)
+}
+
+// IsBusinessDay reports whether t is a weekday from Monday to Friday.
+func IsBusinessDay(t time.Time) bool {
+	switch t.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return true
+}
+
+// AddBusinessDays moves t n business days forward, or backwards if n is
+// negative. From a t on a weekend the first business day in the direction
+// of n is one step, so Saturday plus one business day is Monday. t is
+// returned unchanged for n = 0.
+func AddBusinessDays(t time.Time, n int) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for ; n > 0; n-- {
+		t = t.AddDate(0, 0, step)
+		for !IsBusinessDay(t) {
+			t = t.AddDate(0, 0, step)
+		}
+	}
+	return t
+}
+
+// Add adds n of unit to t, where unit is one of day, week, month, year
+// and business-day. The plural forms are accepted as well.
+func Add(t time.Time, unit string, n int) (time.Time, error) {
+	switch strings.TrimSuffix(unit, "s") {
+	case "day":
+		return t.AddDate(0, 0, n), nil
+	case "week":
+		return t.AddDate(0, 0, 7*n), nil
+	case "month":
+		return AddMonths(t, n), nil
+	case "year":
+		return AddMonths(t, 12*n), nil
+	case "business-day":
+		return AddBusinessDays(t, n), nil
+	}
+	return t, fmt.Errorf("unknown time unit: %s", unit)
+}
+
+// Stepper returns a function stepping X values n units, with units as in
+// Add. Dates at the end of a month stay at the end of the month when
+// stepping months or years, so monthly series of month end dates keep
+// their shape.
+func Stepper(unit string, n int) (func(x string) (string, error), error) {
+	if _, err := Add(time.Time{}, unit, n); err != nil {
+		return nil, err
+	}
+	months := false
+	switch strings.TrimSuffix(unit, "s") {
+	case "month", "year":
+		months = true
+	}
+	return func(x string) (string, error) {
+		t, err := ParseX(x)
+		if err != nil {
+			return "", err
+		}
+		eom := IsEndOfMonth(t)
+		t, _ = Add(t, unit, n)
+		if months && eom {
+			t = EndOfMonth(t)
+		}
+		return FormatX(t), nil
+	}, nil
+}
@@ -0,0 +1,60 @@
+package datetime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel/datetime"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestMonths(t *testing.T) {
+	assert.Equal(t, date(2020, 2, 29), datetime.AddMonths(date(2020, 1, 31), 1))
+	assert.Equal(t, date(2019, 2, 28), datetime.AddMonths(date(2020, 2, 29), -12))
+	assert.Equal(t, date(2021, 1, 15), datetime.AddMonths(date(2020, 11, 15), 2))
+	assert.Equal(t, date(2020, 2, 29), datetime.EndOfMonth(date(2020, 2, 3)))
+	assert.Equal(t, date(2020, 2, 1), datetime.StartOfMonth(time.Date(2020, 2, 3, 10, 0, 0, 0, time.UTC)))
+	assert.True(t, datetime.IsEndOfMonth(date(2019, 12, 31)))
+	assert.False(t, datetime.IsEndOfMonth(date(2019, 12, 30)))
+}
+
+func TestBusinessDays(t *testing.T) {
+	fri := date(2020, 5, 1)
+	assert.True(t, datetime.IsBusinessDay(fri))
+	assert.False(t, datetime.IsBusinessDay(fri.AddDate(0, 0, 1)))
+	assert.Equal(t, date(2020, 5, 4), datetime.AddBusinessDays(fri, 1))
+	assert.Equal(t, date(2020, 5, 8), datetime.AddBusinessDays(fri, 5))
+	assert.Equal(t, fri, datetime.AddBusinessDays(date(2020, 5, 4), -1))
+	sat, sun := date(2020, 5, 2), date(2020, 5, 3)
+	assert.Equal(t, sat, datetime.AddBusinessDays(sat, 0))
+	assert.Equal(t, date(2020, 5, 4), datetime.AddBusinessDays(sat, 1))
+	assert.Equal(t, date(2020, 5, 5), datetime.AddBusinessDays(sun, 2))
+	assert.Equal(t, fri, datetime.AddBusinessDays(sun, -1))
+	assert.Equal(t, date(2020, 4, 30), datetime.AddBusinessDays(sat, -2))
+}
+
+func TestStepper(t *testing.T) {
+	next, err := datetime.Stepper("month", 1)
+	assert.NoError(t, err)
+	x := "2019-12-31"
+	var xs []string
+	for i := 0; i < 3; i++ {
+		x, err = next(x)
+		assert.NoError(t, err)
+		xs = append(xs, x)
+	}
+	assert.Equal(t, []string{"2020-01-31", "2020-02-29", "2020-03-31"}, xs)
+
+	next, _ = datetime.Stepper("business-days", 2)
+	x, _ = next("2020-05-01")
+	assert.Equal(t, "2020-05-05", x)
+
+	_, err = next("May 1")
+	assert.Error(t, err)
+	_, err = datetime.Stepper("fortnight", 1)
+	assert.EqualError(t, err, "unknown time unit: fortnight")
+}
@@ -0,0 +1,407 @@
+package datetime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/utils"
+)
+
+// Module holds the time functions. Times are time.Time values and
+// durations time.Duration values, both ordered by the comparison operators.
+var Module = &module.Module{
+	Name: "time",
+	Funcs: []*module.Func{
+		&module.Func{Name: "time/RFC3339", F: time.RFC3339,
+			Signature:   "time/RFC3339",
+			Description: "The RFC 3339 layout, 2006-01-02T15:04:05Z07:00.",
+		},
+		&module.Func{Name: "time/x-layout", F: XLayout,
+			Signature:   "time/x-layout",
+			Description: "The layout of data serie X values, 2006-01-02.",
+		},
+		&module.Func{Name: "time?", F: utils.ErrFunc(isTime, utils.CheckArity(1)),
+			Signature:   "(time? v)",
+			Description: "Checks if v is a time.",
+		},
+		&module.Func{Name: "duration?", F: utils.ErrFunc(isDuration, utils.CheckArity(1)),
+			Signature:   "(duration? v)",
+			Description: "Checks if v is a duration.",
+		},
+		&module.Func{Name: "time/now", F: utils.ErrFunc(now, utils.CheckArity(0)),
+			Signature:   "(time/now)",
+			Description: "Returns the current local time.",
+		},
+		&module.Func{Name: "time/date", F: utils.ErrFunc(date, utils.CheckArityAtLeast(3)),
+			Signature:   "(time/date year month day) or (time/date year month day hour min sec) with an optional zone last",
+			Description: "Returns the time of the date, in UTC unless a zone like \"Europe/Stockholm\" is given.",
+		},
+		&module.Func{Name: "time/parse", F: utils.ErrFunc(parse, utils.CheckArityAtLeast(1)),
+			Signature:   "(time/parse s) or (time/parse layout s) or (time/parse layout s zone)",
+			Description: "Parses s using a Go layout like \"2006-01-02 15:04\".\nWithout layout s is parsed as a date like 2019-03-31 or as RFC 3339.\nTimes without zone are in UTC unless zone is given.",
+		},
+		&module.Func{Name: "time/format", F: utils.ErrFunc(format, utils.CheckArityAtLeast(1)),
+			Signature:   "(time/format t) or (time/format t layout)",
+			Description: "Formats t using a Go layout, RFC 3339 by default.",
+		},
+		&module.Func{Name: "time/in", F: utils.ErrFunc(in, utils.CheckArity(2)),
+			Signature:   "(time/in t zone)",
+			Description: "Returns t in the zone, like \"UTC\", \"Local\" or \"America/New_York\".",
+		},
+		&module.Func{Name: "time/zone", F: utils.ErrFunc(zone, utils.CheckArity(1)),
+			Signature:   "(time/zone t)",
+			Description: "Returns the name of the zone of t.",
+		},
+		&module.Func{Name: "time/duration", F: utils.ErrFunc(duration, utils.CheckArity(1)),
+			Signature:   "(time/duration v)",
+			Description: "Returns the duration of a string like \"1h30m\" or a number of seconds.",
+		},
+		&module.Func{Name: "time/seconds", F: utils.ErrFunc(seconds, utils.CheckArity(1)),
+			Signature:   "(time/seconds d)",
+			Description: "Returns the duration d in seconds.",
+		},
+		&module.Func{Name: "time/add", F: utils.ErrFunc(add, utils.CheckArityAtLeast(2)),
+			Signature:   "(time/add t d) or (time/add t n unit)",
+			Description: "Adds the duration d to t, or n of unit :day, :week, :month, :year or :business-day.\nAdding months keeps the day of month, or the last day of shorter months.",
+		},
+		&module.Func{Name: "time/sub", F: utils.ErrFunc(sub, utils.CheckArity(2)),
+			Signature:   "(time/sub t u)",
+			Description: "Returns the duration t - u.",
+		},
+		&module.Func{Name: "time/start-of-month", F: utils.ErrFunc(timeFunc(StartOfMonth), utils.CheckArity(1)),
+			Signature:   "(time/start-of-month t)",
+			Description: "Returns midnight of the first day in the month of t.",
+		},
+		&module.Func{Name: "time/end-of-month", F: utils.ErrFunc(timeFunc(EndOfMonth), utils.CheckArity(1)),
+			Signature:   "(time/end-of-month t)",
+			Description: "Returns the last day in the month of t.",
+		},
+		&module.Func{Name: "time/business-day?", F: utils.ErrFunc(isBusinessDay, utils.CheckArity(1)),
+			Signature:   "(time/business-day? t)",
+			Description: "Checks if t is a weekday from Monday to Friday.",
+		},
+		&module.Func{Name: "time/fields", F: utils.ErrFunc(fields, utils.CheckArity(1)),
+			Signature:   "(time/fields t)",
+			Description: "Returns a dict with :year, :month, :day, :hour, :minute, :second, :nanosecond, :weekday and :yearday of t.",
+		},
+		&module.Func{Name: "time/unix", F: utils.ErrFunc(unix, utils.CheckArity(1)),
+			Signature:   "(time/unix t)",
+			Description: "Returns t as seconds since 1970-01-01 UTC.",
+		},
+		&module.Func{Name: "time/from-unix", F: utils.ErrFunc(fromUnix, utils.CheckArity(1)),
+			Signature:   "(time/from-unix n)",
+			Description: "Returns the UTC time n seconds after 1970-01-01 UTC.",
+		},
+		&module.Func{Name: "time/to-x", F: utils.ErrFunc(toX, utils.CheckArity(1)),
+			Signature:   "(time/to-x t)",
+			Description: "Formats t as a data serie X value like 2019-03-31.",
+		},
+		&module.Func{Name: "time/from-x", F: utils.ErrFunc(fromX, utils.CheckArity(1)),
+			Signature:   "(time/from-x x)",
+			Description: "Parses a data serie X value like 2019-03-31.",
+		},
+		&module.Func{Name: "time/x-step", F: utils.ErrFunc(xStep, utils.CheckArityAtLeast(1)),
+			Signature:   "(time/x-step unit) or (time/x-step unit n)",
+			Description: "Returns a function stepping X values n units, 1 by default, with units as in time/add.\nMonth end dates stay at month ends. Use it as next function of ds.LagFill and ds.PadLastUntil.",
+		},
+	},
+}
+
+var errTimeType = errors.New("Error in parameter type, expected a time")
+
+func toTime(v interface{}) (time.Time, error) {
+	if t, ok := v.(time.Time); ok {
+		return t, nil
+	}
+	return time.Time{}, errTimeType
+}
+
+// toInt converts a whole number to an int, a float with a fraction is
+// rejected rather than truncated.
+func toInt(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("expected a whole number, got %v", v)
+		}
+		return int(v), nil
+	}
+	return 0, utils.ErrParameterType
+}
+
+// toName returns the string of a string or keyword.
+func toName(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case utils.Keyword:
+		return string(v), nil
+	}
+	return "", utils.ErrParameterType
+}
+
+func toLocation(v interface{}) (*time.Location, error) {
+	name, err := toName(v)
+	if err != nil {
+		return nil, err
+	}
+	return time.LoadLocation(name)
+}
+
+func timeFunc(f func(time.Time) time.Time) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		t, err := toTime(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(t), nil
+	}
+}
+
+func isTime(args ...interface{}) (interface{}, error) {
+	_, ok := args[0].(time.Time)
+	return ok, nil
+}
+
+func isDuration(args ...interface{}) (interface{}, error) {
+	_, ok := args[0].(time.Duration)
+	return ok, nil
+}
+
+func now(args ...interface{}) (interface{}, error) {
+	return time.Now(), nil
+}
+
+func date(args ...interface{}) (interface{}, error) {
+	loc := time.UTC
+	if len(args) == 4 || len(args) == 7 {
+		var err error
+		if loc, err = toLocation(args[len(args)-1]); err != nil {
+			return nil, err
+		}
+		args = args[:len(args)-1]
+	}
+	if len(args) != 3 && len(args) != 6 {
+		return nil, errors.New("time/date takes 3 or 6 numbers and an optional zone")
+	}
+	var f [6]int
+	for i, arg := range args {
+		v, err := toInt(arg)
+		if err != nil {
+			return nil, err
+		}
+		f[i] = v
+	}
+	return time.Date(f[0], time.Month(f[1]), f[2], f[3], f[4], f[5], 0, loc), nil
+}
+
+func parse(args ...interface{}) (interface{}, error) {
+	if len(args) > 3 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		s, err := toName(arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = s
+	}
+	switch len(strs) {
+	case 1:
+		if t, err := ParseX(strs[0]); err == nil {
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, strs[0])
+	case 2:
+		return time.Parse(strs[0], strs[1])
+	}
+	loc, err := time.LoadLocation(strs[2])
+	if err != nil {
+		return nil, err
+	}
+	return time.ParseInLocation(strs[0], strs[1], loc)
+}
+
+func format(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	layout := time.RFC3339
+	if len(args) > 1 {
+		if layout, err = toName(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	return t.Format(layout), nil
+}
+
+func in(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	loc, err := toLocation(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return t.In(loc), nil
+}
+
+func zone(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return t.Location().String(), nil
+}
+
+func duration(args ...interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return time.ParseDuration(v)
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case time.Duration:
+		return v, nil
+	}
+	return nil, utils.ErrParameterType
+}
+
+func seconds(args ...interface{}) (interface{}, error) {
+	d, ok := args[0].(time.Duration)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return d.Seconds(), nil
+}
+
+func add(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 2 {
+		d, ok := args[1].(time.Duration)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		return t.Add(d), nil
+	}
+	if len(args) != 3 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	n, err := toInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	unit, err := toName(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return Add(t, unit, n)
+}
+
+func sub(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	u, err := toTime(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return t.Sub(u), nil
+}
+
+func isBusinessDay(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return IsBusinessDay(t), nil
+}
+
+func fields(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return map[interface{}]interface{}{
+		utils.Keyword("year"):       int64(t.Year()),
+		utils.Keyword("month"):      int64(t.Month()),
+		utils.Keyword("day"):        int64(t.Day()),
+		utils.Keyword("hour"):       int64(t.Hour()),
+		utils.Keyword("minute"):     int64(t.Minute()),
+		utils.Keyword("second"):     int64(t.Second()),
+		utils.Keyword("nanosecond"): int64(t.Nanosecond()),
+		utils.Keyword("weekday"):    t.Weekday().String(),
+		utils.Keyword("yearday"):    int64(t.YearDay()),
+	}, nil
+}
+
+func unix(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return t.Unix(), nil
+}
+
+func fromUnix(args ...interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))).UTC(), nil
+	}
+	return nil, utils.ErrParameterType
+}
+
+func toX(args ...interface{}) (interface{}, error) {
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return FormatX(t), nil
+}
+
+func fromX(args ...interface{}) (interface{}, error) {
+	x, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return ParseX(x)
+}
+
+func xStep(args ...interface{}) (interface{}, error) {
+	unit, err := toName(args[0])
+	if err != nil {
+		return nil, err
+	}
+	n := 1
+	if len(args) > 1 {
+		if n, err = toInt(args[1]); err != nil {
+			return nil, err
+		}
+	}
+	step, err := Stepper(unit, n)
+	if err != nil {
+		return nil, err
+	}
+	return utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+		x, ok := args[0].(string)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		return step(x)
+	}, utils.CheckArity(1)), nil
+}
@@ -0,0 +1,63 @@
+package datetime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeModule(t *testing.T) {
+	test := func(expr string, expected interface{}) {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		assert.NotNil(t, g)
+		s, err := g.Eval(gel.NewEnv())
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, s, expr)
+	}
+
+	test(`(time/date 2020 1 31)`, date(2020, 1, 31))
+	test(`(time/to-x (time/add (time/date 2020 1 31) 1 :month))`, "2020-02-29")
+	test(`(time/to-x (time/add (time/from-x "2020-05-01") 1 :business-day))`, "2020-05-04")
+	test(`(time/to-x (time/add (time/parse "2020-05-01") -2 :weeks))`, "2020-04-17")
+	test(`(time/format (time/parse "2006-01-02 15:04" "2020-05-01 13:30") "Jan 2 3:04PM")`, "May 1 1:30PM")
+	test(`(time/format (time/date 2020 1 31 12 0 0 "Europe/Stockholm"))`, "2020-01-31T12:00:00+01:00")
+	test(`(time/format (time/in (time/parse "2020-06-01T12:00:00Z") "America/New_York"))`, "2020-06-01T08:00:00-04:00")
+	test(`(time/zone (time/parse "2006-01-02" "2020-06-01" "Europe/Stockholm"))`, "Europe/Stockholm")
+	test(`(time/to-x (time/end-of-month (time/date 2020 2 3)))`, "2020-02-29")
+	test(`(time/to-x (time/start-of-month (time/date 2020 2 3)))`, "2020-02-01")
+	test(`[(time/business-day? (time/date 2020 5 2)) (time/business-day? (time/date 2020 5 4))]`, []interface{}{false, true})
+	test(`(:weekday (time/fields (time/date 2020 5 2)))`, "Saturday")
+	test(`(:month (time/fields (time/date 2020 5 2)))`, int64(5))
+	test(`(time/unix (time/from-unix 86400))`, int64(86400))
+	test(`(time/duration "1h30m")`, 90*time.Minute)
+	test(`(time/seconds (time/sub (time/date 2020 1 2) (time/date 2020 1 1)))`, 86400.0)
+	test(`(time/format (time/add (time/date 2020 1 1) (time/duration 90)))`, "2020-01-01T00:01:30Z")
+	test(`[(< (time/date 2020 1 1) (time/date 2020 1 2)) (>= (time/date 2020 1 1) (time/date 2020 1 2))]`, []interface{}{true, false})
+	test(`(== (time/date 2020 1 1 1 0 0 "Europe/Stockholm") (time/parse "2020-01-01T00:00:00Z"))`, true)
+	test(`(> (time/duration "1h") (time/duration "59m"))`, true)
+	test(`[(time? (time/now)) (time? "2020-01-01") (duration? (time/duration 1))]`, []interface{}{true, false, true})
+	test(`(json {"t" (time/date 2020 1 31)})`, `{"t":"2020-01-31T00:00:00Z"}`)
+	test(`(map (time/x-step :month) ["2019-11-30" "2020-01-31"])`, []interface{}{"2019-12-31", "2020-02-29"})
+	test(`(ds.Xs (ds.LagFill (ds.New "a" ["2020-01-31" "2020-02-29"] (vec 1 2)) 1 (time/x-step :month)))`,
+		[]interface{}{"2020-02-29", "2020-03-31"})
+	test(`(ds.Xs (ds.PadLastUntil (ds.New "a" ["2020-05-01"] (vec 1)) "2020-05-05" (time/x-step :business-day)))`,
+		[]interface{}{"2020-05-01", "2020-05-04", "2020-05-05"})
+	test(`(ds.Xs (ds.LagFill (ds.New "a" ["2020-01-15"] (vec 1)) 1))`, []interface{}{"2020-02-15"})
+
+	for _, expr := range []string{
+		`(time/parse "yesterday")`,
+		`(time/add (time/date 2020 1 1) 1 :fortnight)`,
+		`(time/add (time/date 2020 1 1) 1.5 :day)`,
+		`(time/in (time/now) "Mars/Olympus")`,
+		`(time/to-x "2020-01-01")`,
+		`(ds.PadLastUntil (ds.New "a" ["2020-05-01"] (vec 1)) "2020-05-05" (func [x] (error "bad")))`,
+	} {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		_, err = g.Eval(gel.NewEnv())
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,265 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/utils"
+)
+
+// pattern is a binding form that destructures a value into symbols.
+//
+// A symbol binds the whole value. [a [b c] & more :as all] binds the
+// elements of a list or vector, more to the remaining elements and all to
+// the whole value. {:keys [x y] z :z-key :as all} binds x and y to the
+// values of the keys :x and :y of a dict and z to the value of :z-key.
+// {:strs [x y]} binds the values of the string keys "x" and "y".
+// Missing elements and keys bind nil.
+type pattern struct {
+	name  string
+	elems []*pattern
+	rest  *pattern
+	keys  []interface{}
+	vals  []*pattern
+	dict  bool
+	as    string
+}
+
+// parsePattern parses a binding form. Lists are accepted in place of
+// vectors, as quoted code turns vectors into lists.
+func parsePattern(node ast.Node) (*pattern, error) {
+	var p *pattern
+	var err error
+	switch node := node.(type) {
+	case *ast.Symbol:
+		return &pattern{name: node.Name}, nil
+	case *ast.ListList:
+		p, err = parseListPattern(node.Nodes)
+	case *ast.List:
+		p, err = parseListPattern(node.Nodes)
+	case *ast.DictList:
+		p, err = parseDictPattern(node.Nodes)
+	default:
+		return nil, errors.New("binding must be a symbol, a list or a dict pattern")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if name := duplicate(p.names()); name != "" {
+		return nil, fmt.Errorf("pattern binds %s more than once", name)
+	}
+	return p, nil
+}
+
+// duplicate returns the first name that occurs more than once in names,
+// or "" if there is none. Empty names are skipped.
+func duplicate(names []string) string {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return name
+		}
+		seen[name] = true
+	}
+	return ""
+}
+
+// isPattern reports whether node is a list or dict pattern.
+func isPattern(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.ListList, *ast.List, *ast.DictList:
+		return true
+	}
+	return false
+}
+
+// isKey reports whether node is the keyword :key.
+func isKey(node ast.Node, key string) bool {
+	k, ok := node.(*ast.Keyword)
+	return ok && k.Name == key
+}
+
+func asName(nodes []ast.Node, i int) (string, error) {
+	if i+1 < len(nodes) {
+		if symbol, ok := nodes[i+1].(*ast.Symbol); ok {
+			return symbol.Name, nil
+		}
+	}
+	return "", errors.New(":as must be followed by a symbol")
+}
+
+func parseListPattern(nodes []ast.Node) (*pattern, error) {
+	p := &pattern{}
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if isKey(node, "as") {
+			name, err := asName(nodes, i)
+			if err != nil {
+				return nil, err
+			}
+			p.as = name
+			i++
+			continue
+		}
+		if symbol, ok := node.(*ast.Symbol); ok && symbol.Name == "&" {
+			if i+1 == len(nodes) {
+				return nil, errors.New("& must be followed by a binding")
+			}
+			rest, err := parsePattern(nodes[i+1])
+			if err != nil {
+				return nil, err
+			}
+			p.rest = rest
+			i++
+			continue
+		}
+		if p.rest != nil {
+			return nil, errors.New("& binding must be the last binding of a list pattern")
+		}
+		elem, err := parsePattern(node)
+		if err != nil {
+			return nil, err
+		}
+		p.elems = append(p.elems, elem)
+	}
+	return p, nil
+}
+
+func parseDictPattern(nodes []ast.Node) (*pattern, error) {
+	if len(nodes)%2 != 0 {
+		return nil, errors.New("dict pattern takes pairs of bindings and keys")
+	}
+	p := &pattern{dict: true}
+	for i := 0; i < len(nodes); i += 2 {
+		switch {
+		case isKey(nodes[i], "as"):
+			name, err := asName(nodes, i)
+			if err != nil {
+				return nil, err
+			}
+			p.as = name
+		case isKey(nodes[i], "keys"), isKey(nodes[i], "strs"):
+			kind := nodes[i].(*ast.Keyword).Input
+			names, ok := paramList(nodes[i+1])
+			if !ok {
+				return nil, fmt.Errorf("%s must be followed by a list of symbols", kind)
+			}
+			for _, node := range names {
+				symbol, ok := node.(*ast.Symbol)
+				if !ok {
+					return nil, fmt.Errorf("%s must be followed by a list of symbols", kind)
+				}
+				var key interface{} = Keyword(symbol.Name)
+				if kind == ":strs" {
+					key = symbol.Name
+				}
+				p.keys = append(p.keys, key)
+				p.vals = append(p.vals, &pattern{name: symbol.Name})
+			}
+		default:
+			val, err := parsePattern(nodes[i])
+			if err != nil {
+				return nil, err
+			}
+			key, err := nodeToData(nodes[i+1])
+			if err != nil {
+				return nil, err
+			}
+			p.keys = append(p.keys, key)
+			p.vals = append(p.vals, val)
+		}
+	}
+	return p, nil
+}
+
+// names returns the symbols bound by p.
+func (p *pattern) names() []string {
+	var res []string
+	if p.name != "" {
+		res = append(res, p.name)
+	}
+	for _, e := range p.elems {
+		res = append(res, e.names()...)
+	}
+	if p.rest != nil {
+		res = append(res, p.rest.names()...)
+	}
+	for _, v := range p.vals {
+		res = append(res, v.names()...)
+	}
+	if p.as != "" {
+		res = append(res, p.as)
+	}
+	return res
+}
+
+// bind destructures v and calls set for every symbol bound by p.
+func (p *pattern) bind(v interface{}, set func(name string, v interface{})) error {
+	if p.name != "" {
+		set(p.name, v)
+		return nil
+	}
+	if p.as != "" {
+		set(p.as, v)
+	}
+
+	if p.dict {
+		if v != nil && !utils.IsDict(v) {
+			return fmt.Errorf("cannot destructure %v as a dict", v)
+		}
+		for i, key := range p.keys {
+			val, _ := utils.DictGet(v, key)
+			if err := p.vals[i].bind(val, set); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var list []interface{}
+	if v != nil {
+		var err error
+		if list, err = utils.ToList(v); err == utils.ErrParameterType {
+			return fmt.Errorf("cannot destructure %v as a list", v)
+		} else if err != nil {
+			return err
+		}
+	}
+	for i, e := range p.elems {
+		var elem interface{}
+		if i < len(list) {
+			elem = list[i]
+		}
+		if err := e.bind(elem, set); err != nil {
+			return err
+		}
+	}
+	if p.rest != nil {
+		rest := emptyList
+		if len(p.elems) < len(list) {
+			rest = list[len(p.elems):]
+		}
+		if err := p.rest.bind(rest, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create destructures v and creates the bound symbols in scope.
+func (p *pattern) create(scope *Scope, v interface{}) error {
+	var err error
+	bindErr := p.bind(v, func(name string, v interface{}) {
+		if e := scope.Create(name, v); e != nil && err == nil {
+			err = e
+		}
+	})
+	if bindErr != nil {
+		return bindErr
+	}
+	return err
+}
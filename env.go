@@ -1,9 +1,16 @@
 package gel
 
+import (
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/utils"
+)
+
 // Env contains the variables, functions and modules that
 // should be used for Gel expression evaluation
 type Env struct {
-	vars map[string]interface{}
+	vars    map[string]interface{}
+	repo    *module.Repo
+	workers int
 }
 
 // NewEnv creates a new Env.
@@ -19,17 +26,51 @@ func (e *Env) Copy() *Env {
 	}
 
 	return &Env{
-		vars: vars,
+		vars:    vars,
+		repo:    e.repo,
+		workers: e.workers,
 	}
 }
 
+// SetRepo sets the modules to evaluate with, overriding
+// the module.Repo of the Gel.
+func (e *Env) SetRepo(repo *module.Repo) {
+	e.repo = repo
+}
+
+// SetWorkers sets the number of goroutines used by pmap, pvec-map, pfilter
+// and preduce. By default it is runtime.GOMAXPROCS.
+func (e *Env) SetWorkers(n int) {
+	e.workers = n
+}
+
 // AddVar adds a variable or function to the Env.
 func (e *Env) AddVar(name string, value interface{}) {
 	e.vars[name] = value
 }
 
+// names returns the set of names defined in the Env.
+func (e *Env) names() map[string]bool {
+	if len(e.vars) == 0 {
+		return nil
+	}
+	names := make(map[string]bool, len(e.vars))
+	for k := range e.vars {
+		names[k] = true
+	}
+	return names
+}
+
 func (e *Env) fillScope(scope *Scope) {
 	for k, v := range e.vars {
 		scope.SetOrCreate(k, v)
 	}
 }
+
+// AddFunc adds the Go function fn to the Env as the function name.
+// Unlike AddVar, fn may have any signature: its arity, variadic parameters
+// and argument conversions are derived from it, and a last error result is
+// raised as a gel error. It panics if fn is not a function.
+func (e *Env) AddFunc(name string, fn interface{}) {
+	e.vars[name] = utils.GoFunc(name, fn)
+}
@@ -0,0 +1,81 @@
+package gel_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Stromberg/gel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStack(t *testing.T) {
+	g, err := gel.New("(func f [x]\n  (+ x y))\n(func g [x] (f x))\n(g 1)")
+	assert.NoError(t, err)
+
+	_, err = g.Eval(gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, "twik source:2:8: undefined symbol: y", e.Error())
+	assert.Equal(t, []string{"f", "g", ""}, []string{e.Stack[0].Func, e.Stack[1].Func, e.Stack[2].Func})
+	assert.Equal(t, "twik source:2:8: undefined symbol: y\n"+
+		"    at twik source:2:8 in f\n"+
+		"    at twik source:3:14 in g\n"+
+		"    at twik source:4:2", fmt.Sprintf("%+v", err))
+	assert.Equal(t, e.Error(), fmt.Sprintf("%v", err))
+}
+
+func TestErrorStackRepeated(t *testing.T) {
+	g, err := gel.New("(func f [] (let)) (f)")
+	assert.NoError(t, err)
+
+	stack := "twik source:1:13: let takes a list of bindings and a body\n" +
+		"    at twik source:1:13 in f\n" +
+		"    at twik source:1:20"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := g.Eval(gel.NewEnv())
+				assert.Equal(t, stack, fmt.Sprintf("%+v", err))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestErrorPanic(t *testing.T) {
+	g, err := gel.New("((func [] (boom)))")
+	assert.NoError(t, err)
+	env := gel.NewEnv()
+	env.AddVar("boom", func(args ...interface{}) (interface{}, error) {
+		panic("boom")
+	})
+
+	_, err = g.Eval(env)
+	assert.EqualError(t, err, "twik source:1:11: boom")
+	e := err.(*gel.Error)
+	assert.Equal(t, "anonymous function", e.Stack[0].Func)
+	assert.Empty(t, e.GoStack)
+
+	g.SetDebug(true)
+	_, err = g.Eval(env)
+	assert.True(t, strings.Contains(err.(*gel.Error).GoStack, "goroutine"))
+}
+
+func TestErrorStackDeep(t *testing.T) {
+	g, err := gel.New("(func f [n] (if (== n 0) (throw \"deep\") (f (- n 1))))\n(f 20000)")
+	assert.NoError(t, err)
+
+	_, err = g.Eval(gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, gel.MaxStack, len(e.Stack))
+	assert.Equal(t, 20002-gel.MaxStack, e.Elided)
+	assert.Equal(t, "f", e.Stack[0].Func)
+	assert.Equal(t, "twik source:2:2", e.Stack[gel.MaxStack-1].String())
+	assert.Contains(t, fmt.Sprintf("%+v", err), fmt.Sprintf("\n    ... %d frames elided\n", e.Elided))
+}
@@ -93,6 +93,14 @@ var evalList = []struct {
 		`1.0`,
 		1.0,
 	},
+	{
+		`1e3`,
+		1000.0,
+	},
+	{
+		`(- 9223372036854775808 1)`,
+		int64(9223372036854775807),
+	},
 	{
 		`0x10`,
 		16,
@@ -274,6 +282,45 @@ var evalList = []struct {
 		errorf("twik source:1:2: error function takes a single string argument"),
 	},
 
+	// try
+	{
+		`(try (error "boom") (catch e (error-message e)))`,
+		"boom",
+	}, {
+		`(try 1 (catch e 2))`,
+		1,
+	}, {
+		"(try\n  (get [1] 5)\n  (catch e (error-pos e)))",
+		"twik source:2:4",
+	}, {
+		`(try (throw {:code 3}) (catch e (get (error-data e) :code)))`,
+		3,
+	}, {
+		`(try (throw (make-error "failed" {:code 3})) (catch e [(error-message e) (error-data e)]))`,
+		[]interface{}{"failed", map[interface{}]interface{}{gel.Keyword("code"): int64(3)}},
+	}, {
+		`(var log []) (try (error "a") (catch e (set log (append log 1))) (finally (set log (append log 2)))) log`,
+		[]interface{}{int64(1), int64(2)},
+	}, {
+		`(var log []) (try (try (error "a") (finally (set log (append log 2)))) (catch e (append log (error-message e))))`,
+		[]interface{}{int64(2), "a"},
+	}, {
+		`(try (throw "inner") (catch e (throw e)))`,
+		errorf("twik source:1:7: inner"),
+	}, {
+		`(try (error "a") (catch e (error? e)))`,
+		true,
+	}, {
+		`(error? 1)`,
+		false,
+	}, {
+		`(catch e 1)`,
+		errorf("twik source:1:2: catch outside of try"),
+	}, {
+		`(try (finally 1))`,
+		errorf("twik source:1:2: try takes a body"),
+	},
+
 	// vec
 	{
 		`(vec)`,
@@ -402,7 +449,7 @@ var evalList = []struct {
 	},
 	{
 		`(dict :d 12.0)`,
-		map[interface{}]interface{}{"d": 12.0},
+		map[interface{}]interface{}{gel.Keyword("d"): 12.0},
 	},
 	{
 		`(dict "d")`,
@@ -416,11 +463,11 @@ var evalList = []struct {
 	},
 	{
 		`(:d (dict "d" 12.0))`,
-		12.0,
+		false,
 	},
 	{
 		`(:d)`,
-		errorf(`twik source:1:2: lookup using string requires a dictionary`),
+		errorf(`twik source:1:2: lookup using keyword requires a dictionary`),
 	},
 	{
 		`(:d (dict :a 12.0))`,
@@ -431,6 +478,180 @@ var evalList = []struct {
 		12.0,
 	},
 
+	// keywords
+	{
+		`[(keyword? :a) (keyword? "a") (== :a (keyword "a")) (== :a "a")]`,
+		[]interface{}{true, false, true, false},
+	},
+	{
+		`[(name :a) (name "b") (name 'c)]`,
+		[]interface{}{"a", "b", "c"},
+	},
+	{
+		`(len {:a 1 "a" 2})`,
+		2,
+	},
+	{
+		`(json {:a :b "c" [:d]})`,
+		`{"a":"b","c":["d"]}`,
+	},
+	{
+		`'(:a b)`,
+		[]interface{}{gel.Keyword("a"), gel.Symbol("b")},
+	},
+	{
+		`((func [s :window 20] [s window]) "window" :window 3)`,
+		[]interface{}{"window", int64(3)},
+	},
+	{
+		`(var {:strs [a] :keys [b]} {"a" 1 :b 2}) [a b]`,
+		[]interface{}{int64(1), int64(2)},
+	},
+	{
+		`(name 1)`,
+		errorf("twik source:1:2: Error in parameter type"),
+	},
+
+	// numeric tower
+	{
+		`(sprintf "%v" (+ 0.10M 0.20M))`,
+		"0.30",
+	},
+	{
+		`[(== (+ 0.1M 0.2M) 0.3M) (== 0.3M 0.30M)]`,
+		[]interface{}{true, true},
+	},
+	{
+		`(sprintf "%v" (* 9223372036854775807 2))`,
+		"18446744073709551614",
+	},
+	{
+		`(- (+ 9223372036854775807 1) 1)`,
+		int64(9223372036854775807),
+	},
+	{
+		`(sprintf "%v" (- -9223372036854775807 2))`,
+		"-9223372036854775809",
+	},
+	{
+		`(sprintf "%v %v %v" (rational 7 2) (+ (rational 1 3) (rational 2 3)) (* (rational 1 3) 1.5M))`,
+		"7/2 1 0.5",
+	},
+	{
+		`(sprintf "%v %v" (/ 1M 3) (/ 10.00M 4))`,
+		"0.3333333333333333 2.50",
+	},
+	{
+		`(/ 1M 0)`,
+		errorf("twik source:1:2: division by zero"),
+	},
+	{
+		`[(< 1.5M 2) (> (rational 1 2) 0.4) (<= 2.0M 2) (>= 1M 2) (== 1.50M 1.5) (!= (rational 1 2) 0.5M)]`,
+		[]interface{}{true, true, true, false, true, false},
+	},
+	{
+		`(sprintf "%v %v" (min 3 1.5M 2) (max 3 (rational 7 2) 2.0))`,
+		"1.5 7/2",
+	},
+	{
+		`(sprintf "%v" (% 10.5M 3))`,
+		"1.5",
+	},
+	{
+		`[(int 3.99M) (int (rational 7 2)) (float 2.5M) (int "-12")]`,
+		[]interface{}{int64(3), int64(3), 2.5, int64(-12)},
+	},
+	{
+		`(sprintf "%v %v" (int "123456789012345678901234567890") (decimal "12.50"))`,
+		"123456789012345678901234567890 12.50",
+	},
+	{
+		`[(decimal? 1.0M) (decimal? 1.0) (rational? (rational 1 2)) (rational? (rational 4 2))]`,
+		[]interface{}{true, false, true, false},
+	},
+	{
+		`(json {"price" 12.50M})`,
+		`{"price":12.50}`,
+	},
+
+	// lazy sequences
+	{
+		`(lazy? (map inc (lazy-range)))`,
+		true,
+	},
+	{
+		`(realize (take 3 (filter (func [x] (== (% x 2) 0)) (map inc (lazy-range)))))`,
+		[]interface{}{int64(2), int64(4), int64(6)},
+	},
+	{
+		`(realize (lazy-range 2 10 3))`,
+		[]interface{}{int64(2), int64(5), int64(8)},
+	},
+	{
+		`(realize (take 3 (iterate (func [x] (* x 2)) 1)))`,
+		[]interface{}{int64(1), int64(2), int64(4)},
+	},
+	{
+		`(realize (take 4 (cycle [:a :b])))`,
+		[]interface{}{gel.Keyword("a"), gel.Keyword("b"), gel.Keyword("a"), gel.Keyword("b")},
+	},
+	{
+		`(realize (take-while (func [x] (< x 3)) (skip 1 (lazy-range))))`,
+		[]interface{}{int64(1), int64(2)},
+	},
+	{
+		`(take-while (func [x] (< x 3)) [1 2 3 1])`,
+		[]interface{}{int64(1), int64(2)},
+	},
+	{
+		`[(first (skip 100 (lazy-range))) (second (lazy-range 5)) (last (lazy-range 5))]`,
+		[]interface{}{int64(100), int64(1), int64(4)},
+	},
+	{
+		`[(len (lazy-range 5)) (reduce + (lazy-range 5)) (json (lazy-range 3))]`,
+		[]interface{}{int64(5), int64(10), "[0,1,2]"},
+	},
+	{
+		`(realize (map + [1 2 3] (lazy-range 10 20)))`,
+		[]interface{}{int64(11), int64(13), int64(15)},
+	},
+	{
+		`(realize (lazy-seq [1 2]))`,
+		[]interface{}{int64(1), int64(2)},
+	},
+	{
+		`(var n 0) (var s (map (func [x] (set n (+ n 1)) x) (lazy-range))) (first s) n`,
+		int64(1),
+	},
+	{
+		`(realize (map (func [x] (error "bad")) (lazy-range)))`,
+		errorf("twik source:1:26: bad"),
+	},
+	{
+		`(lazy-range 0 1 0)`,
+		errorf("twik source:1:2: range step must not be zero"),
+	},
+	{
+		`[(apply + (take 3 (lazy-range))) (reverse (take 3 (lazy-range)))]`,
+		[]interface{}{int64(3), []interface{}{int64(2), int64(1), int64(0)}},
+	},
+	{
+		`(apply + (map (# (error "boom")) (take 3 (lazy-range))))`,
+		errorf("twik source:1:19: boom"),
+	},
+	{
+		`(reverse (map (# (error "boom")) (take 3 (lazy-range))))`,
+		errorf("twik source:1:19: boom"),
+	},
+	{
+		`(json (map (# (error "boom")) (take 3 (lazy-range))))`,
+		errorf("twik source:1:16: boom"),
+	},
+	{
+		`(let [[a] (map (# (error "boom")) (take 3 (lazy-range)))] a)`,
+		errorf("twik source:1:20: boom"),
+	},
+
 	// {}
 	{
 		`{}`,
@@ -484,6 +705,10 @@ var evalList = []struct {
 		`(dict-keys "d")`,
 		errorf(`twik source:1:2: dict-keys expects a dictionary`),
 	},
+	{
+		`(min [1 "a"])`,
+		errorf(`twik source:1:2: cannot min \[1 "a"\]`),
+	},
 
 	// get
 	{
@@ -1055,11 +1280,11 @@ var evalList = []struct {
 	},
 	{
 		`(filter :a [{:a false :x 12} {:a true :x 13.0}])`,
-		[]interface{}{map[interface{}]interface{}{"a": true, "x": 13.0}},
+		[]interface{}{map[interface{}]interface{}{gel.Keyword("a"): true, gel.Keyword("x"): 13.0}},
 	},
 	{
 		`(filter {:a false :x true} [:a :x])`,
-		[]interface{}{"x"},
+		[]interface{}{gel.Keyword("x")},
 	},
 
 	// count-if
@@ -1223,6 +1448,14 @@ var evalList = []struct {
 		`(range 6.0 1.0 -2.5)`,
 		[]interface{}{6.0, 3.5},
 	},
+	{
+		`(sprintf "%v %v" (range 0 1.5M 0.5M) (range 1 0 (rational -1 3)))`,
+		"[0 0.5 1.0] [1 2/3 1/3]",
+	},
+	{
+		`(range 0 1 nil)`,
+		errorf(`twik source:1:2: Error in parameter type`),
+	},
 
 	// vec-range
 	{
@@ -1758,6 +1991,18 @@ var evalList = []struct {
 	}, {
 		`(==)`,
 		errorf("twik source:1:2: == takes two values"),
+	}, {
+		`[(== #{1 2} #{2 1}) (== #{1} #{1 2}) (== #{1} [1])]`,
+		[]interface{}{true, false, false},
+	}, {
+		`[(== [1 [2 "a"]] (list 1 (vector 2 "a"))) (== [1 2] [2 1]) (== [1] [1 2]) (== [] {})]`,
+		[]interface{}{true, false, false, false},
+	}, {
+		`[(== {:a [1] :b 2} (dict :b 2 :a (list 1))) (== {:a 1} {:a 2}) (== {:a 1} {:b 1}) (== {:a nil} {:b nil})]`,
+		[]interface{}{true, false, false, false},
+	}, {
+		`[(== (vec 1 2) (vec 1 2)) (== (vec 1) (vec 2)) (== (vec 1) [1.0])]`,
+		[]interface{}{true, false, false},
 	},
 
 	// skip
@@ -1870,6 +2115,9 @@ var evalList = []struct {
 	}, {
 		`(!=)`,
 		errorf("twik source:1:2: != takes two values"),
+	}, {
+		`[(!= #{1 2} #{2 1}) (!= [1 2] [1 3]) (!= {:a 1} (hash-map :a 1))]`,
+		[]interface{}{false, true, false},
 	},
 
 	// <
@@ -2093,6 +2341,9 @@ var evalList = []struct {
 	}, {
 		"(func f [a] 1)\n(f 1 2)",
 		errorf(`twik source:2:2: function "f" takes one argument`),
+	}, {
+		`(str "a" "b")`,
+		errorf(`twik source:1:2: function "str" takes one argument`),
 	}, {
 		"(func f [a b] 1)\n(f 1)",
 		errorf(`twik source:2:2: function "f" takes 2 arguments`),
@@ -2255,6 +2506,320 @@ var evalList = []struct {
 		9.42,
 	},
 
+	// parameters
+	{
+		`((func [x & more] [x more]) 1 2 3)`,
+		[]interface{}{int64(1), []interface{}{int64(2), int64(3)}},
+	},
+	{
+		`((func [x & more] more) 1)`,
+		[]interface{}{},
+	},
+	{
+		`((func f [x y & more] more) 1)`,
+		errorf(`twik source:1:2: function "f" takes at least 2 arguments`),
+	},
+	{
+		`((func [x &opt y 2 z (+ x y)] [x y z]) 1)`,
+		[]interface{}{int64(1), int64(2), int64(3)},
+	},
+	{
+		`((func [x &opt y 2 z (+ x y)] [x y z]) 1 5 7)`,
+		[]interface{}{int64(1), int64(5), int64(7)},
+	},
+	{
+		`((func [x &opt y 2] y) 1 2 3)`,
+		errorf(`twik source:1:2: anonymous function takes 1 to 2 arguments`),
+	},
+	{
+		`((func [s :window 20 :step 1] [s window step]) 0 :step 2)`,
+		[]interface{}{int64(0), int64(20), int64(2)},
+	},
+	{
+		`((func [&opt a 1 :window 20 & more] [a window more]) 5 6 :window 3)`,
+		[]interface{}{int64(5), int64(3), []interface{}{int64(6)}},
+	},
+	{
+		`((func f [s :window 20] window) 0 :step 2)`,
+		errorf(`twik source:1:2: function "f" takes one argument and the keyword arguments :window`),
+	},
+	{
+		`((func [s :window 20] window) 0 :window)`,
+		errorf(`twik source:1:2: missing value for keyword argument :window`),
+	},
+	{
+		`(func [x &opt y] y)`,
+		errorf(`twik source:1:2: func's optional parameter y takes a default value`),
+	},
+	{
+		`(func [x & y z] y)`,
+		errorf(`twik source:1:2: func's & must be followed by exactly one parameter`),
+	},
+
+	// destructuring
+	{
+		`(map (func [[a b]] (* a b)) [[1 2] [3 4]])`,
+		[]interface{}{int64(2), int64(12)},
+	},
+	{
+		`((func [{:keys [x y] z :zz}] [x y z]) {:x 1 :zz 3})`,
+		[]interface{}{int64(1), nil, int64(3)},
+	},
+	{
+		`((func [[a & more :as all] &opt [b c] [5 6]] [a more all b c]) [1 2 3])`,
+		[]interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(1), int64(2), int64(3)}, int64(5), int64(6)},
+	},
+	{
+		`(var [a [b c]] [1 [2 3]]) (+ a b c)`,
+		6,
+	},
+	{
+		`(var {:keys [x]} {:x 2}) x`,
+		2,
+	},
+	{
+		`(var [a b] 1)`,
+		errorf(`twik source:1:2: cannot destructure 1 as a list`),
+	},
+	{
+		`(let [a 1 [b c] [a 2] a (+ a b c)] a)`,
+		4,
+	},
+	{
+		`(var a 10) (let [a (+ a 1)] a)`,
+		11,
+	},
+	{
+		`(var a 10) (let [b 1] (set a b)) a`,
+		1,
+	},
+	{
+		`(let [b 1] b) b`,
+		errorf(`twik source:1:15: undefined symbol: b`),
+	},
+	{
+		`(let [a] a)`,
+		errorf(`twik source:1:2: let takes a list of pairs of bindings and values`),
+	},
+	{
+		`(let [1 2] 1)`,
+		errorf(`twik source:1:2: binding must be a symbol, a list or a dict pattern`),
+	},
+	{
+		`(let [[a {:keys [a]}] [1 {:a 2}]] a)`,
+		errorf(`twik source:1:2: pattern binds a more than once`),
+	},
+	{
+		`(var [a & a] [1 2])`,
+		errorf(`twik source:1:2: pattern binds a more than once`),
+	},
+	{
+		`(func [a a] a)`,
+		errorf(`twik source:1:2: func's parameter a is defined more than once`),
+	},
+	{
+		`(func [a [b a]] a)`,
+		errorf(`twik source:1:2: func's parameter a is defined more than once`),
+	},
+	{
+		`(func [a :a 1] a)`,
+		errorf(`twik source:1:2: func's parameter a is defined more than once`),
+	},
+	{
+		`(let [a 1 a (+ a 1)] a)`,
+		2,
+	},
+
+	// quote, quasiquote and macros
+	{
+		`'a`,
+		gel.Symbol("a"),
+	},
+	{
+		`'(a [1 "s"] 2.0)`,
+		[]interface{}{gel.Symbol("a"), []interface{}{int64(1), "s"}, 2.0},
+	},
+	{
+		"(var x 1) `(a ~x ~@[2 3] ~@nil)",
+		[]interface{}{gel.Symbol("a"), int64(1), int64(2), int64(3)},
+	},
+	{
+		"`(a ~@1)",
+		errorf("twik source:1:1: unquote-splicing requires a list"),
+	},
+	{
+		`(unquote x)`,
+		errorf("twik source:1:2: unquote outside of quasiquote"),
+	},
+	{
+		"(defmacro unless [test body] `(if ~test nil ~body)) (unless false 5)",
+		5,
+	},
+	{
+		"(defmacro unless [test body] `(if ~test nil ~body)) (unless true (undefined))",
+		nil,
+	},
+	{
+		"(defmacro unless [test body] `(if ~test nil ~body)) (macroexpand '(unless false 5))",
+		[]interface{}{gel.Symbol("if"), gel.Symbol("false"), gel.Symbol("nil"), int64(5)},
+	},
+	{
+		"(defmacro times [n body] `(do (var i 0) (while (< i ~n) ~body (set i (inc i))))) (var acc 0) (times 4 (set acc (+ acc i))) acc",
+		6,
+	},
+	{
+		"(defmacro defdouble [name] `(func ~name (x) (* x 2))) (defdouble dbl) (dbl 21)",
+		42,
+	},
+	{
+		"(func f [y] (defmacro twice [e] `(+ ~e ~e)) (twice y)) (f 4)",
+		8,
+	},
+	{
+		"(defmacro m [] `(len [1 2 3])) (m)",
+		3,
+	},
+	{
+		"(defmacro m [] `{:a [1 2]}) (m)",
+		map[interface{}]interface{}{gel.Keyword("a"): []interface{}{int64(1), int64(2)}},
+	},
+	{
+		"(defmacro m [x] `(let [y ~x] [y ~@[2 3]])) (m 1)",
+		[]interface{}{int64(1), int64(2), int64(3)},
+	},
+	{
+		`[(persistent? '[1]) (persistent? '(1)) (persistent? '{:a 1})]`,
+		[]interface{}{true, false, true},
+	},
+	{
+		"(defmacro bad [] (error \"expansion failed\")) (bad)",
+		errorf("twik source:1:19: expansion failed"),
+	},
+	{
+		`(symbol? (symbol "a"))`,
+		true,
+	},
+	{
+		`(== 'a (symbol "a"))`,
+		true,
+	},
+	{
+		`(eval '(+ 1 2))`,
+		3,
+	},
+
+	// persistent containers
+	{
+		`(var a (vector 1 2 3)) (var b (conj a 4)) [(len a) (len b) (get b -1)]`,
+		[]interface{}{int64(3), int64(4), int64(4)},
+	},
+	{
+		`(var a [1 2 3]) (var b (assoc a 0 "x")) [(get a 0) (get b 0) (persistent? b)]`,
+		[]interface{}{int64(1), "x", true},
+	},
+	{
+		`(var d (hash-map :a 1)) (var e (assoc d :b 2)) [(contains? d :b) (get e :b) (len (dissoc e :a))]`,
+		[]interface{}{false, int64(2), int64(1)},
+	},
+	{
+		`(var d (persistent {:a 1})) (var f (func [] (get d :a))) (assoc d :a 2) (f)`,
+		1,
+	},
+	{
+		`(json (conj (hash-map :a (vector 1 2)) [:b nil]))`,
+		`{"a":[1,2],"b":null}`,
+	},
+	{
+		`(map (func [x] (* x 2)) (vector 1 2))`,
+		[]interface{}{int64(2), int64(4)},
+	},
+	{
+		`(var {:keys [a]} (hash-map :a 5)) a`,
+		5,
+	},
+	{
+		`(var t (transient [])) (for (var i 0) (< i 100) (set i (inc i)) (conj! t i)) (var v (persistent! t)) [(len v) (get v 99)]`,
+		[]interface{}{int64(100), int64(99)},
+	},
+	{
+		`(var t (transient {:a 1})) (assoc! t :b 2) (dissoc! t :a) (get (persistent! t) :b)`,
+		2,
+	},
+	{
+		`(var t (transient [])) (persistent! t) (conj! t 1)`,
+		errorf("twik source:1:41: transient used after persistent"),
+	},
+	{
+		`(assoc (vector) 1 1)`,
+		errorf("twik source:1:2: index out of range"),
+	},
+	{
+		`(conj {} 1)`,
+		errorf(`twik source:1:2: conj on a dict takes \[key value\] pairs`),
+	},
+	{
+		`[(persistent? [1 2]) (persistent? {:a 1}) (list? [1 2]) (dict? {:a 1})]`,
+		[]interface{}{true, true, true, true},
+	},
+	{
+		`(var a [1 2]) (var f (func [] (get a 0))) (update! a 0 3)`,
+		errorf("twik source:1:44: update! cannot change a persistent value, use assoc"),
+	},
+	{
+		`(var d {:a 1}) (var e (assoc d :a 2)) [(get d :a) (get e :a)]`,
+		[]interface{}{int64(1), int64(2)},
+	},
+	{
+		`(var a [1]) (var b (append a 2)) [(len a) (len b) (persistent? b)]`,
+		[]interface{}{int64(1), int64(2), true},
+	},
+	{
+		`(merge {:a 1} (dict :b 2) {:a 3})`,
+		map[interface{}]interface{}{gel.Keyword("a"): int64(3), gel.Keyword("b"): int64(2)},
+	},
+
+	// sets
+	{
+		`(var s #{1 2 (+ 1 2)}) [(len s) (contains? s 3) (contains? s 4) (set? s)]`,
+		[]interface{}{int64(3), true, false, true},
+	},
+	{
+		`(len #{1 1 "a" "a"})`,
+		2,
+	},
+	{
+		`[(len #{1.5M 1.5M}) (get {1.5M "x"} 1.5M) (contains? #{1.50M} 1.5M) (== #{1.5M} #{1.5M}) (contains? #{(rational 1 3)} (rational 2 6)) (get {9223372036854775808 1} 9223372036854775808)]`,
+		[]interface{}{int64(1), "x", true, true, true, int64(1)},
+	},
+	{
+		`(map (func [x] (* x 10)) #{3 1 2})`,
+		[]interface{}{int64(10), int64(20), int64(30)},
+	},
+	{
+		`(len (filter (func [x] (> x 1)) #{1 2 3}))`,
+		2,
+	},
+	{
+		`(json #{"b" "a"})`,
+		`["a","b"]`,
+	},
+	{
+		`(#{:a :b} :a)`,
+		gel.Keyword("a"),
+	},
+	{
+		`(contains? (conj #{} 1) 1)`,
+		true,
+	},
+	{
+		"(var x 5) (contains? `#{~x} 5)",
+		true,
+	},
+	{
+		`#{[1]}`,
+		errorf("twik source:1:1: key is not comparable"),
+	},
+
 	// identity
 	{
 		`(identity 1)`,
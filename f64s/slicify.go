@@ -3,7 +3,9 @@ package f64s
 import "reflect"
 
 // Slicify takes a function that takes float64, int64 and int arguments
-// and returns a function that accepts iterable arguments
+// and returns a function that accepts iterable arguments. Each iteration
+// of the result has its own arguments, so it can be iterated from many
+// goroutines at once.
 func Slicify(f interface{}) func(args ...Iterable) Iterable {
 	vf := reflect.ValueOf(f)
 	t := vf.Type()
@@ -12,8 +14,6 @@ func Slicify(f interface{}) func(args ...Iterable) Iterable {
 		types[i] = t.In(i)
 	}
 
-	argv := make([]reflect.Value, len(types))
-
 	toValue := func(v float64, t reflect.Type) reflect.Value {
 		switch t.Kind() {
 		case reflect.Float64:
@@ -31,13 +31,13 @@ func Slicify(f interface{}) func(args ...Iterable) Iterable {
 			return Empty
 		}
 
-		nexts := make([]Iterator, len(args))
-		for i, arg := range args {
-			nexts[i] = arg.Iterate()
-		}
-
 		return Iterable{
 			Iterate: func() Iterator {
+				nexts := make([]Iterator, len(args))
+				for i, arg := range args {
+					nexts[i] = arg.Iterate()
+				}
+				argv := make([]reflect.Value, len(types))
 				return func() (item float64, ok bool) {
 					for i, next := range nexts {
 						v, ok1 := next()
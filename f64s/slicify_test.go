@@ -1,6 +1,7 @@
 package f64s
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,3 +24,17 @@ func TestSlicify(t *testing.T) {
 	sf4 := Slicify(f4)
 	assert.EqualValues(t, []float64{46, 60, 238}, sf4(Slice([]float64{2, 5, 7}), Slice([]float64{23, 12, 34})).Slice())
 }
+
+func TestSlicifyConcurrent(t *testing.T) {
+	sf := Slicify(func(v1, v2 float64) float64 { return v1 + v2 })
+	s := sf(Slice([]float64{1, 2, 3}), Slice([]float64{10, 20, 30}))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.EqualValues(t, []float64{11, 22, 33}, s.Slice())
+		}()
+	}
+	wg.Wait()
+}
@@ -2,6 +2,7 @@
 package gel
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,15 +10,29 @@ import (
 	"strings"
 
 	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/utils"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 // Gel is the language expression handler.
+//
+// A Gel is safe for concurrent use by multiple goroutines: Eval,
+// EvalContext and Missing may be called concurrently, as every evaluation
+// has its own scope and the functions of the built-in modules are safe
+// for concurrent use. RedirectStdOut, SetLimits and SetDebug must be called
+// before the Gel is shared. Values passed in an Env are shared by the
+// evaluations using it and must be safe for concurrent use themselves if
+// they are updated.
 type Gel struct {
 	node           ast.Node
+	program        *Program
 	fset           *ast.FileSet
 	code           string
 	stdOutRedirect io.Writer
+	limits         Limits
+	debug          bool
+	repo           *module.Repo
 }
 
 // New creates a new Gel from a code string
@@ -26,7 +41,18 @@ func New(code string) (*Gel, error) {
 }
 
 func NewWithName(code string, fname string) (*Gel, error) {
+	return NewWithNameAndRepo(code, fname, module.DefaultRepo)
+}
+
+// NewWithRepo creates a new Gel from a code string that is evaluated
+// with the modules in repo instead of those in module.DefaultRepo.
+func NewWithRepo(code string, repo *module.Repo) (*Gel, error) {
+	return NewWithNameAndRepo(code, "", repo)
+}
 
+// NewWithNameAndRepo creates a new Gel from a code string named fname
+// that is evaluated with the modules in repo.
+func NewWithNameAndRepo(code string, fname string, repo *module.Repo) (*Gel, error) {
 	fset := NewFileSet()
 
 	node, err := ParseString(fset, fname, code)
@@ -34,7 +60,12 @@ func NewWithName(code string, fname string) (*Gel, error) {
 		return nil, err
 	}
 
-	return &Gel{node, fset, code, nil}, nil
+	program, err := CompileWithRepo(fset, node, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Gel{node: node, program: program, fset: fset, code: code, repo: repo}, nil
 }
 
 func (g *Gel) Code() string {
@@ -45,6 +76,17 @@ func (g *Gel) RedirectStdOut(writer io.Writer) {
 	g.stdOutRedirect = writer
 }
 
+// SetLimits sets the limits used by Eval and EvalContext.
+func (g *Gel) SetLimits(limits Limits) {
+	g.limits = limits
+}
+
+// SetDebug sets whether errors from panics in functions called by Eval
+// and EvalContext keep the Go stack of the panic in Error.GoStack.
+func (g *Gel) SetDebug(debug bool) {
+	g.debug = debug
+}
+
 // Missing returns the symbols that are missing
 // in the environment in order to evaluate the expression.
 func (g *Gel) Missing(env *Env) ([]string, error) {
@@ -57,18 +99,66 @@ func (g *Gel) Missing(env *Env) ([]string, error) {
 
 // Eval evaluates the expression in the given environment.
 func (g *Gel) Eval(env *Env) (interface{}, error) {
+	return g.EvalContext(context.Background(), env)
+}
+
+// EvalContext evaluates the expression in the given environment.
+// The evaluation is aborted with an *Error when ctx is done or when
+// one of the limits set with SetLimits is exceeded. Persistent lists and
+// dicts in the result are converted like in Program.Eval. The goroutines
+// started with go that are still running when the evaluation returns are
+// cancelled, and EvalContext waits for them to return.
+func (g *Gel) EvalContext(ctx context.Context, env *Env) (interface{}, error) {
 	scope, err := g.scope(env)
 	if err != nil {
 		return nil, err
 	}
 
 	scope.RedirectStdOut(g.stdOutRedirect)
+	ctx, cancel := context.WithCancel(ctx)
+	st := newEvalState(ctx, g.limits)
+	defer func() {
+		cancel()
+		st.wait()
+		st.end()
+	}()
+	scope.state = st
+	scope.state.debug = g.debug
+	scope.state.workers = env.workers
+	scope.state.hostNames = env.names()
+	limitScope(scope)
 
-	return scope.Eval(g.node)
+	return g.program.Eval(scope)
+}
+
+// EvalInto evaluates the expression in the given environment and stores the
+// result in the value dst points to. Lists, vecs and dicts are converted to
+// slices, maps and structs, with the fields of a struct named by their gel
+// tags like `gel:"name"`, see utils.ConvertToPath. A result that does not
+// fit dst is reported with its path, like result.items[3].weight.
+func (g *Gel) EvalInto(env *Env, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("EvalInto needs a non-nil pointer, got %T", dst)
+	}
+	r, err := g.Eval(env)
+	if err != nil {
+		return err
+	}
+	v, err := utils.ConvertToPath(r, rv.Type().Elem(), "result")
+	if err != nil {
+		return err
+	}
+	rv.Elem().Set(v)
+	return nil
 }
 
 func (g *Gel) scope(env *Env) (*Scope, error) {
-	scope, err := NewScope(g.fset)
+	repo := g.repo
+	if env.repo != nil {
+		repo = env.repo
+	}
+	scope, err := NewScopeWithRepo(g.fset, repo)
 	if err != nil {
 		return nil, err
 	}
@@ -162,20 +252,85 @@ func missing(s *Scope, node ast.Node) []string {
 
 	switch node := node.(type) {
 	case *ast.Symbol:
-		_, err := s.Get(node.Name)
-		if err != nil {
-			return append(res, node.Name)
+		if _, err := s.Get(node.Name); err == nil {
+			return res
+		}
+		// The symbols of a required file are bound as alias/name.
+		if i := strings.Index(node.Name, "/"); i > 0 {
+			if _, err := s.Get(node.Name[:i+1]); err == nil {
+				return res
+			}
 		}
+		return append(res, node.Name)
 	case *ast.List:
 		if n, ok := node.Nodes[0].(*ast.Symbol); ok {
-			if n.Name == "var" {
-				if n2, ok := node.Nodes[1].(*ast.Symbol); ok {
-					_, err := s.Get(n2.Name)
-					if err != nil {
-						s.Create(n2.Name, 0.0)
+			if n.Name == "quote" || n.Name == "quasiquote" {
+				return res
+			}
+			if (n.Name == "." || n.Name == ".-") && len(node.Nodes) > 2 {
+				// The method or field name is not a symbol to look up.
+				res = append(res, missing(s, node.Nodes[1])...)
+				for _, n := range node.Nodes[3:] {
+					res = append(res, missing(s, n)...)
+				}
+				return res
+			}
+			if n.Name == "select" {
+				for _, n := range node.Nodes[1:] {
+					res = append(res, missingClause(s, n)...)
+				}
+				return res
+			}
+			if n.Name == "ns" {
+				return res
+			}
+			if n.Name == "require" && len(node.Nodes) > 1 {
+				res = append(res, missing(s, node.Nodes[1])...)
+				if alias := requireAlias(node.Nodes[1:]); alias != "" {
+					define(s, []string{alias + "/"})
+				}
+				return res
+			}
+			if n.Name == "var" && len(node.Nodes) > 1 {
+				define(s, bindingNames(node.Nodes[1]))
+				for i := 2; i < len(node.Nodes); i++ {
+					res = append(res, missing(s, node.Nodes[i])...)
+				}
+				return res
+			}
+			if n.Name == "let" && len(node.Nodes) > 1 {
+				if bindings, ok := paramList(node.Nodes[1]); ok {
+					// Each value sees the bindings before it.
+					s := s.Branch()
+					for i := 0; i+1 < len(bindings); i += 2 {
+						res = append(res, missing(s, bindings[i+1])...)
+						define(s, bindingNames(bindings[i]))
 					}
-					for i := 2; i < len(node.Nodes); i++ {
-						res = append(res, missing(s, node.Nodes[i])...)
+					for _, n := range node.Nodes[2:] {
+						res = append(res, missing(s, n)...)
+					}
+					return res
+				}
+			}
+			if n.Name == "catch" && len(node.Nodes) > 1 {
+				s := s.Branch()
+				define(s, bindingNames(node.Nodes[1]))
+				for _, n := range node.Nodes[2:] {
+					res = append(res, missing(s, n)...)
+				}
+				return res
+			}
+			if (n.Name == "func" || n.Name == "fn") && len(node.Nodes) > 2 {
+				i := 1
+				if name, ok := node.Nodes[1].(*ast.Symbol); ok {
+					define(s, []string{name.Name})
+					i++
+				}
+				if list, ok := paramList(node.Nodes[i]); ok {
+					s := s.Branch()
+					res = append(res, missingParams(s, list)...)
+					for _, n := range node.Nodes[i+1:] {
+						res = append(res, missing(s, n)...)
 					}
 					return res
 				}
@@ -191,3 +346,75 @@ func missing(s *Scope, node ast.Node) []string {
 	}
 	return res
 }
+
+// missingParams defines the parameters of a function in s and returns the
+// symbols missing in their default values, see params.
+func missingParams(s *Scope, list []ast.Node) []string {
+	var res []string
+	optional := false
+	for i := 0; i < len(list); i++ {
+		switch node := list[i].(type) {
+		case *ast.Keyword:
+			if i+1 < len(list) {
+				res = append(res, missing(s, list[i+1])...)
+				i++
+			}
+			define(s, []string{node.Name})
+			continue
+		case *ast.Symbol:
+			if node.Name == "&opt" || node.Name == "&" {
+				// The rest parameter takes no default value.
+				optional = node.Name == "&opt"
+				continue
+			}
+		}
+		define(s, bindingNames(list[i]))
+		if optional && i+1 < len(list) {
+			res = append(res, missing(s, list[i+1])...)
+			i++
+		}
+	}
+	return res
+}
+
+// missingClause returns the symbols missing in a clause of select. The
+// value of a take clause is bound in its statements.
+func missingClause(s *Scope, node ast.Node) []string {
+	var res []string
+	if args, ok := clause(node, "take"); ok && len(args) > 1 {
+		res = missing(s, args[0])
+		s := s.Branch()
+		define(s, bindingNames(args[1]))
+		for _, n := range args[2:] {
+			res = append(res, missing(s, n)...)
+		}
+		return res
+	}
+	if list, ok := node.(*ast.List); ok && len(list.Nodes) > 0 {
+		for _, n := range list.Nodes[1:] {
+			res = append(res, missing(s, n)...)
+		}
+		return res
+	}
+	return missing(s, node)
+}
+
+// bindingNames returns the names bound by a symbol or a destructuring
+// pattern.
+func bindingNames(node ast.Node) []string {
+	pat, err := parsePattern(node)
+	if err != nil {
+		return nil
+	}
+	return pat.names()
+}
+
+// define creates the undefined names in s, so that missing does not
+// report them.
+func define(s *Scope, names []string) {
+	for _, name := range names {
+		if _, err := s.Get(name); err != nil {
+			s.Create(name, 0.0)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package gel
 
 import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
 	"testing"
 
+	"github.com/Stromberg/gel/f64s"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -75,6 +80,33 @@ func TestMissingVar(t *testing.T) {
 	assert.Equal(t, 4.0, r)
 }
 
+func TestMissingBindings(t *testing.T) {
+	tests := []struct {
+		code    string
+		missing []string
+	}{
+		{"(let [a 1 b a] (+ a b))", nil},
+		{"(let [a b] a) a", []string{"b", "a"}},
+		{"(var [a {:keys [b]}] x) (+ a b)", []string{"x"}},
+		{"(try 1 (catch e e))", nil},
+		{"(try 1 (catch e (f e)))", []string{"f"}},
+		{"(func f [a &opt b y & r] (f a b r))", []string{"y"}},
+		{"(fn [[a b] :step z] (+ a b step))", []string{"z"}},
+		{"(ns foo) bar", []string{"bar"}},
+		{`(require "x.gel" :as u) (u/f 1) (v/g 1)`, []string{"v/g"}},
+		{`(require "lib/util.gel") (util/f 1)`, nil},
+		{"(require f :as u) (u/f 1)", []string{"f"}},
+		{"(select (take c v (f v)) (put d v) (timeout 10 t) (default v))", []string{"c", "f", "d", "v", "t", "v"}},
+	}
+	for _, test := range tests {
+		g, err := New(test.code)
+		assert.NoError(t, err)
+		m, err := g.Missing(NewEnv())
+		assert.NoError(t, err)
+		assert.Equal(t, test.missing, m, test.code)
+	}
+}
+
 func TestEval(t *testing.T) {
 	g, err := New("")
 	assert.Nil(t, err)
@@ -99,3 +131,136 @@ func TestEval(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, r, 3.14)
 }
+
+func TestEnvOverridesForm(t *testing.T) {
+	e := NewEnv()
+	e.AddVar("time", func(args ...interface{}) (interface{}, error) {
+		return []interface{}{"time", args[0]}, nil
+	})
+	e.AddVar("select", func(args ...interface{}) (interface{}, error) {
+		return []interface{}{"select", args[0]}, nil
+	})
+
+	tests := []struct {
+		expr  string
+		value interface{}
+	}{
+		{"(time 1)", []interface{}{"time", int64(1)}},
+		{"(func f [x] (select (+ x 1))) (f 2)", []interface{}{"select", int64(3)}},
+		{"(let [x 4] (time (if true x 0)))", []interface{}{"time", int64(4)}},
+	}
+	for _, test := range tests {
+		g, err := New(test.expr)
+		assert.NoError(t, err, test.expr)
+		r, err := g.Eval(e)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, r, test.expr)
+
+		// The same Gel still uses the forms without the host variables.
+		g.RedirectStdOut(ioutil.Discard)
+		r, _ = g.Eval(NewEnv())
+		assert.NotEqual(t, test.value, r, test.expr)
+	}
+}
+
+func TestEvalIterable(t *testing.T) {
+	e := NewEnv()
+	e.AddVar("xs", f64s.InfiniteRange(1, 0.5))
+
+	g, err := New("(realize (take 3 (map (func [x] (* x 2)) xs)))")
+	assert.NoError(t, err)
+	r, err := g.Eval(e)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{2.0, 3.0, 4.0}, r)
+}
+
+func TestCompile(t *testing.T) {
+	fset := NewFileSet()
+	node, err := ParseString(fset, "", "(func f [x y] (set x (+ x y)) (do (var y 10) (+ x y))) (f a 2)")
+	assert.NoError(t, err)
+
+	p, err := Compile(fset, node)
+	assert.NoError(t, err)
+
+	for _, a := range []int64{1, 5} {
+		scope, err := NewScope(fset)
+		assert.NoError(t, err)
+		scope.Create("a", a)
+		r, err := p.Eval(scope)
+		assert.NoError(t, err)
+		assert.Equal(t, a+2+10, r)
+	}
+}
+
+func TestCompileClosure(t *testing.T) {
+	g, err := New("(func adder [n] (func [x] (+ x n))) (var add2 (adder 2)) (map add2 [1 2 3])")
+	assert.NoError(t, err)
+
+	r, err := g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(3), int64(4), int64(5)}, r)
+}
+
+func TestPreludeCopyOnWrite(t *testing.T) {
+	g, err := New("(set inc (func [x] (+ x 10))) (inc 1)")
+	assert.NoError(t, err)
+	r, err := g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), r)
+
+	g, err = New("(inc 1)")
+	assert.NoError(t, err)
+	r, err = g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), r)
+
+	s1, err := NewScope(NewFileSet())
+	assert.NoError(t, err)
+	s2, err := NewScope(NewFileSet())
+	assert.NoError(t, err)
+	assert.Equal(t, reflect.ValueOf(s1.base).Pointer(), reflect.ValueOf(s2.base).Pointer())
+}
+
+func TestEvalConcurrent(t *testing.T) {
+	g, err := New(`
+(defmacro twice [x] ` + "`" + `(* 2 ~x))
+(func scale [x] (twice (* x n)))
+(var d {})
+(set d (assoc d :n n))
+(var sq (map (# (* %1 %1)) [1 2 3]))
+(let [total (apply + xs)]
+  (try
+    (throw total)
+    (catch e
+      [(get d :n) (scale 2) sq (error-data e) (load "(+ n 1)") (re/find "\\d+" (sprintf "a%vb" n)) (take! (go scale 3))])))`)
+	assert.NoError(t, err)
+
+	missing, err := g.Missing(NewEnv())
+	assert.NoError(t, err)
+
+	xs := []interface{}{int64(1), 2.5}
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int64) {
+			defer wg.Done()
+			<-start
+			e := NewEnv()
+			e.AddVar("n", n)
+			e.AddVar("xs", xs)
+			expected := []interface{}{n, 4 * n, []interface{}{int64(1), int64(4), int64(9)}, 3.5, n + 1, fmt.Sprint(n), 6 * n}
+			for j := 0; j < 10; j++ {
+				m, err := g.Missing(NewEnv())
+				assert.NoError(t, err)
+				assert.Equal(t, missing, m)
+				r, err := g.Eval(e)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, r)
+			}
+		}(int64(i))
+	}
+	close(start)
+	wg.Wait()
+	assert.Equal(t, []interface{}{int64(1), 2.5}, xs)
+}
@@ -4,17 +4,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
+	"math/big"
 	"math/rand"
-	"path"
+	"reflect"
 	"sort"
 	"time"
 
 	"github.com/Stromberg/gel/ast"
 	"github.com/Stromberg/gel/dataserie"
+	"github.com/Stromberg/gel/datetime"
 	"github.com/Stromberg/gel/f64s"
+	"github.com/Stromberg/gel/lazy"
 	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/persistent"
+	"github.com/Stromberg/gel/re"
+	"github.com/Stromberg/gel/sets"
 	"github.com/Stromberg/gel/utils"
 	"github.com/google/uuid"
 )
@@ -23,34 +29,24 @@ func init() {
 	module.RegisterModules(GlobalsModule)
 	module.RegisterModules(dataserie.Module)
 	module.RegisterModules(f64s.F64sModule)
+	module.RegisterModules(sets.Module)
+	module.RegisterModules(datetime.Module)
+	module.RegisterModules(re.Module)
 }
 
 var GlobalsModule = &module.Module{
 	Name: "globals",
 	Funcs: []*module.Func{
 		&module.Func{
-			Name: "eval", F: evalFn,
+			Name: "eval", F: scopeFunc(evalFn),
 			Signature:   "(eval code)",
-			Description: "Evaluates code in its own context and returns the result",
-		},
-		&module.Func{
-			Name: "eval-file", F: evalFileFn,
-			Signature:   "(eval-file filename)",
-			Description: "Evaluates file in its own context and returns the result",
+			Description: "Evaluates code, a string or quoted code, in its own context and returns the result",
 		},
 		&module.Func{
 			Name: "load", F: loadFn,
 			Signature:   "(load code)",
 			Description: "Evaluates code in current context and returns the last statement",
 		},
-		&module.Func{Name: "load-file", F: loadFileFn,
-			Signature:   "(load-file filename)",
-			Description: "Evaluates filename in current context and returns the last statement",
-		},
-		&module.Func{Name: "slurp", F: slurpFn,
-			Signature:   "(slurp filename)",
-			Description: "Reads content of file into a string",
-		},
 		&module.Func{Name: "true", F: true},
 		&module.Func{Name: "false", F: false},
 		&module.Func{Name: "nil", F: nil},
@@ -59,25 +55,61 @@ var GlobalsModule = &module.Module{
 			Signature:   "(error s)",
 			Description: "Generate an error",
 		},
+		&module.Func{Name: "try", F: tryFn,
+			Signature:   "(try stmts... (catch e stmts...) (finally stmts...))",
+			Description: "Evaluates the statements. If one fails, the catch statements are evaluated with e bound to the error.\nThe finally statements are always evaluated. Both clauses are optional. Exceeded limits cannot be caught.",
+		},
+		&module.Func{Name: "catch", F: catchFn,
+			Signature:   "(catch e stmts...)",
+			Description: "Catches errors in try.",
+		},
+		&module.Func{Name: "finally", F: finallyFn,
+			Signature:   "(finally stmts...)",
+			Description: "Cleans up after try.",
+		},
+		&module.Func{Name: "throw", F: throwFn,
+			Signature:   "(throw v)",
+			Description: "Raises an error. v is an error, a message or any value, which becomes the data of the error.",
+		},
+		&module.Func{Name: "make-error", F: makeErrorFn,
+			Signature:   "(make-error msg) or (make-error msg data)",
+			Description: "Returns an error with the given message and data, to be raised with throw.",
+		},
+		&module.Func{Name: "error?", F: isErrorFn,
+			Signature:   "(error? v)",
+			Description: "Checks if v is an error.",
+		},
+		&module.Func{Name: "error-message", F: errorMessageFn,
+			Signature:   "(error-message e)",
+			Description: "Returns the message of an error.",
+		},
+		&module.Func{Name: "error-data", F: errorDataFn,
+			Signature:   "(error-data e)",
+			Description: "Returns the data of an error, or nil.",
+		},
+		&module.Func{Name: "error-pos", F: errorPosFn,
+			Signature:   "(error-pos e)",
+			Description: "Returns the source position an error was raised at, or nil.",
+		},
 		&module.Func{Name: "==", F: eqFn,
 			Signature:   "(== v1 v2)",
-			Description: "Compares 2 values of the same type",
+			Description: "Compares 2 values of the same type. Big integers, rationals and decimals are compared by value with any number. Times are equal if they are the same instant",
 		},
 		&module.Func{Name: "<", F: lessThanFn,
 			Signature:   "(< v1 v2)",
-			Description: "Compares strings, float64 or ints. Must be the same type",
+			Description: "Compares strings, numbers, times or durations. Must be the same type",
 		},
 		&module.Func{Name: ">", F: greaterThanFn,
 			Signature:   "(> v1 v2)",
-			Description: "Compares strings, float64 or ints. Must be the same type",
+			Description: "Compares strings, numbers, times or durations. Must be the same type",
 		},
 		&module.Func{Name: "<=", F: lessThanEqualFn,
 			Signature:   "(<= v1 v2)",
-			Description: "Compares strings, float64 or ints. Must be the same type",
+			Description: "Compares strings, numbers, times or durations. Must be the same type",
 		},
 		&module.Func{Name: ">=", F: greaterThanEqualFn,
 			Signature:   "(>= v1 v2)",
-			Description: "Compares strings, float64 or ints. Must be the same type",
+			Description: "Compares strings, numbers, times or durations. Must be the same type",
 		},
 		&module.Func{Name: "!=", F: neFn,
 			Signature:   "(!= v1 v2)",
@@ -85,7 +117,7 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "+", F: plusFn,
 			Signature:   "(+ v...)",
-			Description: "Sums a list of values. Given vecs it applies them pair wise. Vecs must be the same length",
+			Description: "Sums a list of values. Given vecs it applies them pair wise. Vecs must be the same length.\nIntegers are promoted to big integers on overflow. Mixing numbers gives the type highest in the order int, big integer, rational, decimal, float",
 		},
 		&module.Func{Name: "-", F: minusFn,
 			Signature:   "(- v...)",
@@ -97,11 +129,11 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "/", F: divFn,
 			Signature:   "(/ v...)",
-			Description: "Divides a list of values. Given vecs it applies them pair wise. Vecs must be the same length",
+			Description: "Divides a list of values. Given vecs it applies them pair wise. Vecs must be the same length.\nIntegers are truncated, use rational for exact quotients. Decimals are rounded to 16 decimals if the quotient is not exact",
 		},
 		&module.Func{Name: "%", F: modFn,
 			Signature:   "(% v1 v2 ...)",
-			Description: "Integer modulo operator. At least 2 arguments.",
+			Description: "Integer modulo operator, also for big integers, rationals and decimals. At least 2 arguments.",
 		},
 		&module.Func{Name: "!", F: notFn,
 			Signature:   "(! v)",
@@ -113,11 +145,27 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "int", F: intFn,
 			Signature:   "(int v)",
-			Description: "Convert float to int.",
+			Description: "Convert a number or string to int, truncating any fraction. Integers too large for an int become big integers.",
 		},
 		&module.Func{Name: "float", F: floatFn,
 			Signature:   "(float v)",
-			Description: "Convert int to float.",
+			Description: "Convert a number to float.",
+		},
+		&module.Func{Name: "rational", F: rationalFn,
+			Signature:   "(rational a b) or (rational v)",
+			Description: "Returns the exact quotient of integers a and b, or converts a number to a rational. Rationals that are integers are returned as integers.",
+		},
+		&module.Func{Name: "rational?", F: isRationalFn,
+			Signature:   "(rational? v)",
+			Description: "Checks if argument is a rational.",
+		},
+		&module.Func{Name: "decimal", F: decimalFn,
+			Signature:   "(decimal v)",
+			Description: "Converts a number or string to an exact decimal. Decimals are also written 12.50M.",
+		},
+		&module.Func{Name: "decimal?", F: isDecimalFn,
+			Signature:   "(decimal? v)",
+			Description: "Checks if argument is a decimal.",
 		},
 		&module.Func{Name: "min", F: minFn,
 			Signature:   "(min v...)",
@@ -147,6 +195,10 @@ var GlobalsModule = &module.Module{
 			Signature:   "(var s stmt) or (var s)",
 			Description: "Creates a new variable s in current scope.",
 		},
+		&module.Func{Name: "let", F: letFn,
+			Signature:   "(let [binding value...] stmts)",
+			Description: "Binds the values in a new scope and evaluates the statements in it. Each value sees the bindings before it.\nA binding is a symbol or a pattern like [a [b c] & more :as all] or {:keys [x y] z :z-key :as all}. {:strs [x y]} binds string keys.",
+		},
 		&module.Func{Name: "set", F: setFn,
 			Signature:   "(set s stmt)",
 			Description: "Binds a new value to s in current scope.",
@@ -161,7 +213,7 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "func", F: funcFn,
 			Signature:   "(func [args...] stmts) or (func name [args...] stmts)",
-			Description: "Returns a new function that evaluates its statements in its own scope. \n(func name [args...] stmts) is equivalent to (var name (func [args...] stmts))",
+			Description: "Returns a new function that evaluates its statements in its own scope. \n(func name [args...] stmts) is equivalent to (var name (func [args...] stmts))\n[a b &opt c 1 :window 20 & more] takes a and b, an optional c defaulting to 1, a keyword argument :window defaulting to 20 and a list more with the remaining arguments",
 		},
 		&module.Func{Name: "fn", F: funcFn,
 			Signature:   "(fn [args...] stmts) or (fn name [args...] stmts)",
@@ -169,7 +221,59 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "#", F: macroFn,
 			Signature:   "(# stmt)",
-			Description: "A lambda function in current scope. Parameters passed to this function are bound to %1, %2 etc",
+			Description: "A lambda function evaluated in a branch of current scope. Parameters passed to this function are bound to %1, %2 etc",
+		},
+		&module.Func{Name: "quote", F: quoteFn,
+			Signature:   "(quote x) or 'x",
+			Description: "Returns x without evaluating it. Symbols become symbol values and lists become lists.",
+		},
+		&module.Func{Name: "quasiquote", F: quasiquoteFn,
+			Signature:   "(quasiquote x) or `x",
+			Description: "Like quote, but evaluates the forms marked with unquote (~x) and splices the lists marked with unquote-splicing (~@x).",
+		},
+		&module.Func{Name: "unquote", F: unquoteFn,
+			Signature:   "(unquote x) or ~x",
+			Description: "Evaluates x inside a quasiquote.",
+		},
+		&module.Func{Name: "unquote-splicing", F: unquoteSplicingFn,
+			Signature:   "(unquote-splicing x) or ~@x",
+			Description: "Evaluates the list x inside a quasiquote and splices its elements into the enclosing list.",
+		},
+		&module.Func{Name: "defmacro", F: defmacroFn,
+			Signature:   "(defmacro name [args...] stmts)",
+			Description: "Defines a macro. A call to the macro passes its arguments unevaluated as data to the macro,\nthe code it returns is evaluated in place of the call. Lists in the returned code are calls.",
+		},
+		&module.Func{Name: "macroexpand-1", F: scopeFunc(macroexpand1Fn),
+			Signature:   "(macroexpand-1 form)",
+			Description: "Expands form once if it is a call to a macro.",
+		},
+		&module.Func{Name: "macroexpand", F: scopeFunc(macroexpandFn),
+			Signature:   "(macroexpand form)",
+			Description: "Expands form repeatedly until it is no longer a call to a macro.",
+		},
+		&module.Func{Name: "symbol", F: symbolFn,
+			Signature:   "(symbol name)",
+			Description: "Returns a symbol with the given name.",
+		},
+		&module.Func{Name: "symbol?", F: isSymbolFn,
+			Signature:   "(symbol? x)",
+			Description: "Checks if x is a symbol.",
+		},
+		&module.Func{Name: "keyword", F: keywordFn,
+			Signature:   "(keyword name)",
+			Description: "Returns the keyword :name for a string or symbol name.",
+		},
+		&module.Func{Name: "keyword?", F: isKeywordFn,
+			Signature:   "(keyword? x)",
+			Description: "Checks if x is a keyword.",
+		},
+		&module.Func{Name: "name", F: nameFn,
+			Signature:   "(name x)",
+			Description: "Returns the name of a keyword or symbol as a string. Strings are returned as they are.",
+		},
+		&module.Func{Name: "gensym", F: gensymFn,
+			Signature:   "(gensym) or (gensym prefix)",
+			Description: "Returns a new unique symbol, for use as a name in code returned by macros.",
 		},
 		&module.Func{Name: "for", F: forFn,
 			Signature:   "(for init test step stmts)",
@@ -207,6 +311,14 @@ var GlobalsModule = &module.Module{
 			Signature:   "(dict? n)",
 			Description: "Checks if argument is a dict.",
 		},
+		&module.Func{Name: "hash-set", F: hashSetFn,
+			Signature:   "(hash-set v...)",
+			Description: "Creates a set with values v. Sets are also written #{v...}.",
+		},
+		&module.Func{Name: "set?", F: isSetFn,
+			Signature:   "(set? n)",
+			Description: "Checks if argument is a set.",
+		},
 		&module.Func{Name: "dict-keys", F: dictKeysFn,
 			Signature:   "(dict-keys d)",
 			Description: "Gets the keys of a dict.",
@@ -243,6 +355,54 @@ var GlobalsModule = &module.Module{
 			Signature:   "(merge d...)",
 			Description: "Merges dictionaries into one.",
 		},
+		&module.Func{Name: "vector", F: vectorFn,
+			Signature:   "(vector v...)",
+			Description: "Creates a persistent vector. Persistent containers are never changed, updates return new versions sharing most of their memory with the old one.",
+		},
+		&module.Func{Name: "hash-map", F: hashMapFn,
+			Signature:   "(hash-map k v ...)",
+			Description: "Creates a persistent hash map with keys and values.",
+		},
+		&module.Func{Name: "persistent", F: persistentFn,
+			Signature:   "(persistent c)",
+			Description: "Converts a list, vec or dict to a persistent vector or hash map.",
+		},
+		&module.Func{Name: "persistent?", F: isPersistentFn,
+			Signature:   "(persistent? c)",
+			Description: "Checks if argument is a persistent vector, hash map or set.",
+		},
+		&module.Func{Name: "assoc", F: assocFn,
+			Signature:   "(assoc c k v ...)",
+			Description: "Returns a persistent version of c with keys k set to values v. The key of a vector is an index, the length of the vector appends.",
+		},
+		&module.Func{Name: "conj", F: conjFn,
+			Signature:   "(conj c v...)",
+			Description: "Returns a persistent version of c with values v added. Values added to a hash map are [key value] pairs.",
+		},
+		&module.Func{Name: "dissoc", F: dissocFn,
+			Signature:   "(dissoc d k...)",
+			Description: "Returns a persistent version of d without keys k.",
+		},
+		&module.Func{Name: "transient", F: transientFn,
+			Signature:   "(transient c)",
+			Description: "Returns a transient copy of c, which is updated in place with assoc!, conj! and dissoc!.",
+		},
+		&module.Func{Name: "persistent!", F: persistentInPlaceFn,
+			Signature:   "(persistent! t)",
+			Description: "Returns the persistent version of transient t. t may not be used afterwards.",
+		},
+		&module.Func{Name: "assoc!", F: assocInPlaceFn,
+			Signature:   "(assoc! t k v ...)",
+			Description: "Sets keys k to values v in transient t and returns t.",
+		},
+		&module.Func{Name: "conj!", F: conjInPlaceFn,
+			Signature:   "(conj! t v...)",
+			Description: "Adds values v to transient t and returns t.",
+		},
+		&module.Func{Name: "dissoc!", F: dissocInPlaceFn,
+			Signature:   "(dissoc! t k...)",
+			Description: "Removes keys k from transient t and returns t.",
+		},
 		&module.Func{Name: "range", F: rangeFn,
 			Signature:   "(range start step end)",
 			Description: "Creates a list with values from start to end (not included) step apart",
@@ -265,7 +425,7 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "map", F: mapFn,
 			Signature:   "(map f c...)",
-			Description: "Maps lists and/or vecs over f into a list. \nIf multiple lists and vecs are used they must be of the same length. \nVecs are converted to lists.",
+			Description: "Maps lists and/or vecs over f into a list. \nIf multiple lists and vecs are used they must be of the same length. \nVecs are converted to lists.\nGiven a lazy sequence it returns a lazy sequence ending with the shortest c.",
 		},
 		&module.Func{Name: "map-indexed", F: mapIndexedFn,
 			Signature:   "(map-indexed f c...)",
@@ -301,7 +461,7 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "filter", F: filterFn,
 			Signature:   "(filter f c)",
-			Description: "Filters a list or vec.",
+			Description: "Filters a list or vec. Given a lazy sequence it returns a lazy sequence.",
 		},
 		&module.Func{Name: "count-if", F: countIfFn,
 			Signature:   "(count-if f c)",
@@ -313,11 +473,99 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "skip", F: skipFn,
 			Signature:   "(skip n c)",
-			Description: "Skips n items of list or vec.",
+			Description: "Skips n items of list or vec. Given a lazy sequence it returns a lazy sequence.",
 		},
 		&module.Func{Name: "take", F: takeFn,
 			Signature:   "(take n c)",
-			Description: "Takes n items from list or vec.",
+			Description: "Takes n items from list or vec. Given a lazy sequence it returns a lazy sequence.",
+		},
+		&module.Func{Name: "take-while", F: takeWhileFn,
+			Signature:   "(take-while f c)",
+			Description: "Takes the items of c up to the first for which f returns false. Given a lazy sequence it returns a lazy sequence, otherwise a list.",
+		},
+		&module.Func{Name: "lazy-range", F: lazyRangeFn,
+			Signature:   "(lazy-range) or (lazy-range end) or (lazy-range start end) or (lazy-range start end step)",
+			Description: "Creates a lazy sequence of numbers from start, 0 by default, to end (not included) step apart, 1 by default.\nWithout end the sequence is infinite.",
+		},
+		&module.Func{Name: "iterate", F: iterateFn,
+			Signature:   "(iterate f x)",
+			Description: "Creates the infinite lazy sequence x, (f x), (f (f x)) ...",
+		},
+		&module.Func{Name: "cycle", F: cycleFn,
+			Signature:   "(cycle c)",
+			Description: "Creates an infinite lazy sequence repeating the items of c.",
+		},
+		&module.Func{Name: "lazy-seq", F: lazySeqFn,
+			Signature:   "(lazy-seq c)",
+			Description: "Creates a lazy sequence of the items of a list, vec or f64s.Iterable.",
+		},
+		&module.Func{Name: "realize", F: realizeFn,
+			Signature:   "(realize s)",
+			Description: "Computes all items of a lazy sequence into a list. Never returns for infinite sequences.\nFunctions that need all items, like len, reduce and json, realize lazy sequences by themselves.",
+		},
+		&module.Func{Name: "lazy?", F: isLazyFn,
+			Signature:   "(lazy? v)",
+			Description: "Checks if v is a lazy sequence.",
+		},
+		&module.Func{Name: "go", F: scopeFunc(goFn),
+			Signature:   "(go f args...) or (go wg f args...)",
+			Description: "Calls f with args in a new goroutine. Returns a channel that receives the result of f, or its error, and is then closed.\nWith a wait group wg, wait waits for the call.\nThe goroutine is cancelled when the evaluation that started it returns.",
+		},
+		&module.Func{Name: "chan", F: chanFn,
+			Signature:   "(chan) or (chan n)",
+			Description: "Creates a channel, unbuffered or with a buffer of n values.",
+		},
+		&module.Func{Name: "chan?", F: isChanFn,
+			Signature:   "(chan? v)",
+			Description: "Checks if v is a channel.",
+		},
+		&module.Func{Name: "put!", F: scopeFunc(putChanFn),
+			Signature:   "(put! ch v)",
+			Description: "Sends v on the channel ch, blocking until it is received or buffered. It is an error to put on a closed channel.",
+		},
+		&module.Func{Name: "take!", F: scopeFunc(takeChanFn),
+			Signature:   "(take! ch)",
+			Description: "Receives a value from the channel ch, blocking until one is sent. Returns nil once ch is closed.\nTaking the error of a failed go call raises it.",
+		},
+		&module.Func{Name: "close!", F: closeChanFn,
+			Signature:   "(close! ch)",
+			Description: "Closes the channel ch.",
+		},
+		&module.Func{Name: "select", F: selectFn,
+			Signature:   "(select (take ch v stmts...) (put ch x stmts...) (timeout d stmts...) (default stmts...))",
+			Description: "Waits until one of the clauses can proceed and evaluates its statements.\ntake receives from ch with the value bound to v, put sends x on ch, timeout proceeds after the duration d or d milliseconds and default proceeds if no other clause can.",
+		},
+		&module.Func{Name: "wait-group", F: waitGroupFn,
+			Signature:   "(wait-group)",
+			Description: "Creates a wait group for go.",
+		},
+		&module.Func{Name: "wait", F: scopeFunc(waitFn),
+			Signature:   "(wait wg)",
+			Description: "Waits for the go calls of the wait group wg to return. Raises the first error of the calls.",
+		},
+		&module.Func{Name: "pmap", F: scopeFunc(pmapFn),
+			Signature:   "(pmap f c...)",
+			Description: "Like map, but calls f in parallel. The results keep the order of c.\nThe error of the first item that failed is raised.",
+		},
+		&module.Func{Name: "pvec-map", F: scopeFunc(pvecMapFn),
+			Signature:   "(pvec-map f c...)",
+			Description: "Like vec-map, but calls f in parallel. The results keep the order of c.\nThe error of the first item that failed is raised.",
+		},
+		&module.Func{Name: "pfilter", F: scopeFunc(pfilterFn),
+			Signature:   "(pfilter f c)",
+			Description: "Like filter, but calls f in parallel. The items keep the order of c.\nThe error of the first item that failed is raised.",
+		},
+		&module.Func{Name: ".", F: dotFn,
+			Signature:   "(. v Method args...)",
+			Description: "Calls the exported method Method of the Go value v. The arguments are converted to the parameter types of the method.\nA last error result is raised, several other results are returned in a list.",
+		},
+		&module.Func{Name: ".-", F: dotFieldFn,
+			Signature:   "(.- v Field)",
+			Description: "Gets the exported field Field of the Go struct v, or of the struct v points to.",
+		},
+		&module.Func{Name: "preduce", F: scopeFunc(preduceFn),
+			Signature:   "(preduce f l) (preduce f l init)",
+			Description: "Reduces chunks of l in parallel with f, then reduces the results of the chunks in order, starting with init if provided.\nf must be associative, like +.",
 		},
 		&module.Func{Name: "sort-asc", F: sortAscFn,
 			Signature:   "(sort-asc f l)",
@@ -339,6 +587,14 @@ var GlobalsModule = &module.Module{
 			Signature:   "(json c)",
 			Description: "Converts a dict or list to a json string. If it is a dict the keys must be all be strings.",
 		},
+		&module.Func{Name: "pr-str", F: prStrFn,
+			Signature:   "(pr-str x)",
+			Description: "Writes x as a string of gel data that read-string reads back. Vecs are written as #vec [...] and times as #inst \"...\".",
+		},
+		&module.Func{Name: "read-string", F: readStringFn,
+			Signature:   "(read-string s)",
+			Description: "Reads a single value of gel data from s without evaluating it: numbers, strings, keywords, lists, dicts, sets, #vec and #inst.",
+		},
 		&module.Func{Name: "uuid", F: uuidFn,
 			Signature:   "(uuid)",
 			Description: "Creates a new UUID string.",
@@ -353,7 +609,7 @@ var GlobalsModule = &module.Module{
 		},
 		&module.Func{Name: "time", F: timeFn,
 			Signature:   "(time f)",
-			Description: "Times the call to f. The time is printed to stdout and the result of f is returned.",
+			Description: "Times the call to f. The time is printed to stdout and the result of f is returned.\nDates and times are in the time module, see (docs \"time/*\").",
 		},
 		&module.Func{Name: "->", F: threadFn,
 			Signature:   "(-> v...)",
@@ -363,7 +619,7 @@ var GlobalsModule = &module.Module{
 			Signature:   "(printf fmt arg...)",
 			Description: "Printf command. Could be redirected in gel.",
 		},
-		&module.Func{Name: "docs", F: docsFn,
+		&module.Func{Name: "docs", F: scopeFunc(docsFn),
 			Signature:   "(docs) or (docs n)",
 			Description: "With no arguments it returns a list of all available variables at this time. \nSupports wildcards.\nWith arguments resolving to one variable it returns the docs for that variable.",
 		},
@@ -421,114 +677,98 @@ func errorFn(args ...interface{}) (value interface{}, err error) {
 	return nil, errors.New("error function takes a single string argument")
 }
 
-func printfFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func printfFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) < 1 {
 		return nil, errors.New("printf function requires at least a string argument")
 	}
 
-	formatRaw, err := scope.Eval(args[0])
-	if err != nil {
-		return nil, err
-	}
-	format, ok := formatRaw.(string)
-	if !ok {
-		return nil, errors.New("printf requires a string argument")
-	}
+	format := c.compile(args[0])
+	argCodes := c.compileAll(args[1:])
 
-	vargs := make([]interface{}, len(args[1:]))
-	for i, arg := range args[1:] {
-		varg, err := scope.Eval(arg)
+	return func(scope *Scope) (interface{}, error) {
+		formatRaw, err := format(scope)
 		if err != nil {
 			return nil, err
 		}
-		vargs[i] = varg
-	}
-
-	err = scope.Printf(format, vargs...)
-	return nil, err
-}
-
-var evalFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
-	code, ok := args[0].(string)
-	if !ok {
-		return nil, utils.ErrParameterType
-	}
+		format, ok := formatRaw.(string)
+		if !ok {
+			return nil, errors.New("printf requires a string argument")
+		}
 
-	g, err := New(code)
-	if err != nil {
-		return nil, fmt.Errorf("Error in eval: %v", err)
-	}
+		vargs, err := evalAll(scope, argCodes)
+		if err != nil {
+			return nil, err
+		}
 
-	return g.Eval(NewEnv())
-}, utils.CheckArity(1))
+		err = scope.Printf(format, vargs...)
+		return nil, err
+	}, nil
+}
 
-func loadFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func evalFn(scope *Scope, args ...interface{}) (interface{}, error) {
 	if len(args) != 1 {
-		return nil, errors.New("load function takes a single string argument")
+		return nil, utils.ErrWrongNumberPar
 	}
-
-	r, err := scope.Eval(args[0])
+	fset := NewFileSet()
+	s, err := evalScope(scope, fset)
 	if err != nil {
 		return nil, err
 	}
-	code, ok := r.(string)
+	code, ok := args[0].(string)
 	if !ok {
-		return nil, utils.ErrParameterType
+		// Quoted code is evaluated like code parsed from a string.
+		return s.eval(dataToNode(args[0], 0))
 	}
 
-	node, err := ParseString(scope.fset, "", code)
+	node, err := ParseString(fset, "", code)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Error in eval: %v", err)
 	}
-
-	return scope.Eval(node)
+	return s.eval(node)
 }
 
-func loadFileFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
-	if len(args) != 1 {
-		return nil, errors.New("load-file function takes a single string argument")
-	}
-
-	r, err := scope.Eval(args[0])
+// evalScope returns the scope of the code evaluated by eval, a new context
+// that shares the evaluation state and limits of scope.
+func evalScope(scope *Scope, fset *ast.FileSet) (*Scope, error) {
+	s, err := NewScopeWithRepo(fset, scope.Repo())
 	if err != nil {
 		return nil, err
 	}
+	s.state = scope.state
+	limitScope(s)
+	return s, nil
+}
 
-	file, ok := r.(string)
-	if !ok {
-		return nil, utils.ErrParameterType
-	}
-	realPath := path.Join(module.BasePath, file)
-	data, err := ioutil.ReadFile(realPath)
-	if err != nil {
-		return nil, err
+func loadFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 1 {
+		return nil, errors.New("load function takes a single string argument")
 	}
-	code := string(data)
 
-	node, err := ParseString(scope.fset, file, code)
-	if err != nil {
-		return nil, err
-	}
+	arg := c.compile(args[0])
 
-	return scope.Eval(node)
-}
+	return func(scope *Scope) (interface{}, error) {
+		r, err := arg(scope)
+		if err != nil {
+			return nil, err
+		}
+		code, ok := r.(string)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
 
-var slurpFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
-	file, ok := args[0].(string)
-	if !ok {
-		return nil, utils.ErrParameterType
-	}
-	realPath := path.Join(module.BasePath, file)
-	data, err := ioutil.ReadFile(realPath)
-	if err != nil {
-		return nil, err
-	}
-	return string(data), nil
-}, utils.CheckArity(1))
+		node, err := ParseString(scope.fset, "", code)
+		if err != nil {
+			return nil, err
+		}
+
+		return scope.eval(node)
+	}, nil
+}
 
-func docsFn(args ...interface{}) (interface{}, error) {
+func docsFn(scope *Scope, args ...interface{}) (interface{}, error) {
+	repo := scope.Repo()
 	if len(args) == 0 {
-		fnames := module.AllFunctionNames()
+		fnames := repo.AllFunctionNames()
 		res := make([]interface{}, len(fnames))
 		for i, f := range fnames {
 			res[i] = f
@@ -546,13 +786,13 @@ func docsFn(args ...interface{}) (interface{}, error) {
 		return nil, errors.New("Expected string argument")
 	}
 
-	names := module.MatchingFuncNames(expr)
+	names := repo.MatchingFuncNames(expr)
 	if len(names) == 0 {
 		return "Function not found", nil
 	}
 
 	if len(names) == 1 {
-		return module.FunctionRepr(names[0]), nil
+		return repo.FunctionRepr(names[0]), nil
 	}
 
 	res := make([]interface{}, len(names))
@@ -588,26 +828,6 @@ func randFn() func(args ...interface{}) (value interface{}, err error) {
 	}
 }
 
-var evalFileFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
-	file, ok := args[0].(string)
-	if !ok {
-		return nil, utils.ErrParameterType
-	}
-	realPath := path.Join(module.BasePath, file)
-	data, err := ioutil.ReadFile(realPath)
-	if err != nil {
-		return nil, err
-	}
-	code := string(data)
-
-	g, err := NewWithName(code, file)
-	if err != nil {
-		return nil, fmt.Errorf("Error in eval: %v", err)
-	}
-
-	return g.Eval(NewEnv())
-}, utils.CheckArity(1))
-
 func vecFn(args ...interface{}) (value interface{}, err error) {
 	if len(args) == 0 {
 		return []float64{}, nil
@@ -617,7 +837,7 @@ func vecFn(args ...interface{}) (value interface{}, err error) {
 		return list, nil
 	}
 
-	if list, ok := args[0].([]interface{}); ok {
+	if list, ok := utils.AsList(args[0]); ok {
 		res := make([]float64, len(list))
 		for i, e := range list {
 			switch e.(type) {
@@ -647,19 +867,14 @@ func vecFn(args ...interface{}) (value interface{}, err error) {
 }
 
 var dictKeysFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
-	dict, ok := args[0].(map[interface{}]interface{})
-	if !ok {
+	keys := []interface{}{}
+	if !utils.RangeDict(args[0], func(k, v interface{}) bool {
+		keys = append(keys, k)
+		return true
+	}) {
 		return nil, errors.New("dict-keys expects a dictionary")
 	}
 
-	keys := make([]interface{}, len(dict))
-
-	i := 0
-	for k := range dict {
-		keys[i] = k
-		i++
-	}
-
 	return keys, nil
 }, utils.CheckArity(1))
 
@@ -682,10 +897,16 @@ func vecToListFn(args ...interface{}) (value interface{}, err error) {
 var rangeFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	res := []interface{}{}
 
+	if num.AnyExtended(args...) {
+		return numRange(args[0], args[1], args[2])
+	}
 	switch start := args[0].(type) {
 	case int64:
-		step := args[2].(int64)
-		end := args[1].(int64)
+		step, ok1 := args[2].(int64)
+		end, ok2 := args[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, utils.ErrParameterType
+		}
 		if step == 0 {
 			return nil, errors.New("Invalid argument")
 		} else if step > 0 {
@@ -700,8 +921,11 @@ var rangeFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err er
 
 		return res, nil
 	case float64:
-		step := args[2].(float64)
-		end := args[1].(float64)
+		step, ok1 := args[2].(float64)
+		end, ok2 := args[1].(float64)
+		if !ok1 || !ok2 {
+			return nil, utils.ErrParameterType
+		}
 		if step == 0 {
 			return nil, errors.New("Invalid argument")
 		} else if step > 0 {
@@ -719,6 +943,34 @@ var rangeFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err er
 	return nil, utils.ErrParameterType
 }, utils.CheckArity(3), utils.ParamsToSameBaseType())
 
+// numRange is range for decimals, rationals and big integers.
+func numRange(start, end, step interface{}) (interface{}, error) {
+	if !num.IsNumber(start) || !num.IsNumber(end) || !num.IsNumber(step) {
+		return nil, utils.ErrParameterType
+	}
+	dir, err := num.Cmp(step, int64(0))
+	if err != nil {
+		return nil, err
+	}
+	if dir == 0 {
+		return nil, errors.New("Invalid argument")
+	}
+	res := []interface{}{}
+	for i := start; ; {
+		c, err := num.Cmp(i, end)
+		if err != nil {
+			return nil, err
+		}
+		if c != -dir {
+			return res, nil
+		}
+		res = append(res, i)
+		if i, err = num.Add(i, step); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func bindFn(args ...interface{}) (value interface{}, err error) {
 	if len(args) < 2 {
 		return nil, errors.New("bind takes 2 or more arguments")
@@ -875,12 +1127,23 @@ var isVecFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
 }, utils.CheckArity(1))
 
 var isListFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
-	_, ok := args[0].([]interface{})
-	return ok
+	switch args[0].(type) {
+	case []interface{}, *persistent.Vector:
+		return true
+	}
+	return false
 }, utils.CheckArity(1))
 
 var isDictFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
-	_, ok := args[0].(map[interface{}]interface{})
+	return utils.IsDict(args[0])
+}, utils.CheckArity(1))
+
+var hashSetFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return persistent.NewSet(args...)
+})
+
+var isSetFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(*persistent.Set)
 	return ok
 }, utils.CheckArity(1))
 
@@ -981,7 +1244,7 @@ var subFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 		return v[i1:i2], nil
 	}
 	return nil, utils.ErrParameterType
-}, utils.CheckArity(3))
+}, utils.CheckArity(3), utils.ParamToList(0))
 
 var containsFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 	switch arg := args[0].(type) {
@@ -1010,36 +1273,76 @@ var containsFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 			return false, nil
 		}
 		return true, nil
+	case *persistent.Map:
+		_, ok := arg.Get(args[1])
+		return ok, nil
+	case *persistent.Set:
+		return arg.Contains(args[1]), nil
+	case *persistent.Vector:
+		i, ok := args[1].(int64)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		return int(i) < arg.Len(), nil
 	}
 	return nil, utils.ErrParameterType
 }, utils.CheckArity(2))
 
 var jsonFn = utils.ErrFunc(func(arg interface{}) (interface{}, error) {
-	var fix func(interface{}) interface{}
+	var fix func(interface{}) (interface{}, error)
 
-	fix = func(arg interface{}) interface{} {
+	fix = func(arg interface{}) (interface{}, error) {
 		switch rarg := arg.(type) {
 		case map[interface{}]interface{}:
 			d := map[string]interface{}{}
 			for k, v := range rarg {
-				s, ok := k.(string)
-				if !ok {
+				var s string
+				switch k := k.(type) {
+				case string:
+					s = k
+				case utils.Keyword:
+					s = string(k)
+				default:
 					s = fmt.Sprintf("%v", k)
 				}
-				d[s] = fix(v)
+				var err error
+				if d[s], err = fix(v); err != nil {
+					return nil, err
+				}
 			}
-			return d
+			return d, nil
+		case utils.Keyword:
+			return string(rarg), nil
 		case []interface{}:
 			d := make([]interface{}, len(rarg))
 			for i, v := range rarg {
-				d[i] = fix(v)
+				var err error
+				if d[i], err = fix(v); err != nil {
+					return nil, err
+				}
 			}
-			return d
+			return d, nil
+		case *persistent.Map:
+			return fix(rarg.ToMap())
+		case *persistent.Vector:
+			return fix(rarg.Slice())
+		case *persistent.Set:
+			return fix(rarg.Slice())
+		case *lazy.Seq:
+			l, err := utils.ToList(rarg)
+			if err != nil {
+				return nil, err
+			}
+			return fix(l)
 		}
-		return arg
+		return arg, nil
 	}
 
-	b, err := json.Marshal(fix(arg))
+	v, err := fix(arg)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
@@ -1083,6 +1386,8 @@ var updateFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 		}
 		v[i] = f
 		return args[0], nil
+	case *persistent.Vector, *persistent.Map:
+		return nil, errors.New("update! cannot change a persistent value, use assoc")
 	}
 	return nil, utils.ErrParameterType
 }, utils.CheckArity(3))
@@ -1096,6 +1401,8 @@ var appendFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 			v = append(v, n)
 		}
 		return v, nil
+	case *persistent.Vector:
+		return batch(arg, args[1:], conjAll)
 	case []float64:
 		v := make([]float64, len(arg))
 		copy(v, arg)
@@ -1127,13 +1434,23 @@ var concatFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 		v := make([]interface{}, len(arg))
 		copy(v, arg)
 		for _, n := range args[1:] {
-			v2, ok := n.([]interface{})
+			v2, ok := utils.AsList(n)
 			if !ok {
 				return nil, utils.ErrParameterType
 			}
 			v = append(v, v2...)
 		}
 		return v, nil
+	case *persistent.Vector:
+		var v []interface{}
+		for _, n := range args[1:] {
+			v2, ok := utils.AsList(n)
+			if !ok {
+				return nil, utils.ErrParameterType
+			}
+			v = append(v, v2...)
+		}
+		return batch(arg, v, conjAll)
 	case []float64:
 		if len(args) == 1 {
 			return arg, nil
@@ -1156,14 +1473,16 @@ var concatFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 }, utils.CheckArityAtLeast(1))
 
 var mergeFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if m, ok := args[0].(*persistent.Map); ok {
+		return batch(m, args[1:], mergeAll)
+	}
 	res := map[interface{}]interface{}{}
 	for _, arg := range args {
-		d, ok := arg.(map[interface{}]interface{})
-		if !ok {
-			return nil, utils.ErrParameterType
-		}
-		for k, v := range d {
+		if !utils.RangeDict(arg, func(k, v interface{}) bool {
 			res[k] = v
+			return true
+		}) {
+			return nil, utils.ErrParameterType
 		}
 	}
 	return res, nil
@@ -1180,6 +1499,22 @@ var lenFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
 		return int64(len(arg)), nil
 	case string:
 		return int64(len(arg)), nil
+	case *persistent.Vector:
+		return int64(arg.Len()), nil
+	case *persistent.Map:
+		return int64(arg.Len()), nil
+	case *persistent.Set:
+		return int64(arg.Len()), nil
+	case *persistent.TransientVector:
+		return int64(arg.Len()), nil
+	case *persistent.TransientMap:
+		return int64(arg.Len()), nil
+	case *lazy.Seq:
+		l, err := arg.Slice()
+		if err != nil {
+			return nil, err
+		}
+		return int64(len(l)), nil
 	}
 	return nil, utils.ErrParameterType
 }, utils.CheckArity(1))
@@ -1188,14 +1523,14 @@ func eqFn(args ...interface{}) (value interface{}, err error) {
 	if len(args) != 2 {
 		return nil, errors.New("== takes two values")
 	}
-	return args[0] == args[1], nil
+	return equal(args[0], args[1]), nil
 }
 
 func neFn(args ...interface{}) (value interface{}, err error) {
 	if len(args) != 2 {
 		return nil, errors.New("!= takes two values")
 	}
-	return args[0] != args[1], nil
+	return !equal(args[0], args[1]), nil
 }
 
 var plusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
@@ -1221,13 +1556,21 @@ var plusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err err
 		return res, nil
 	}
 
+	if num.AnyExtended(args...) {
+		return num.Reduce(num.Add, args)
+	}
+
 	var resi int64
 	var resf float64
 	var f bool
 	for _, arg := range args {
 		switch arg := arg.(type) {
 		case int64:
-			resi += arg
+			r, ok := num.AddInt64(resi, arg)
+			if !ok {
+				return num.Reduce(num.Add, args)
+			}
+			resi = r
 			resf += float64(arg)
 		case float64:
 			resf += arg
@@ -1243,6 +1586,10 @@ var plusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err err
 }, utils.ParamsToSameBaseType(), utils.ParamsSlicify())
 
 var modFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if num.AnyExtended(args...) {
+		return num.Reduce(num.Mod, args)
+	}
+
 	var resi int64
 	switch arg := args[0].(type) {
 	case int64:
@@ -1262,27 +1609,78 @@ var modFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 	return resi, nil
 }, utils.CheckArityAtLeast(2), utils.ParamsToSameBaseType())
 
-var intFn = utils.SimpleFunc(func(args ...interface{}) (value interface{}) {
-	return args[0]
-}, utils.CheckArity(1), utils.ParamToInt64(0))
+var intFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	switch arg := args[0].(type) {
+	case float64:
+		if v, ok := num.ToInteger(arg); ok {
+			return v, nil
+		}
+		return nil, utils.ErrParameterType
+	case string:
+		if i, ok := new(big.Int).SetString(arg, 10); ok {
+			return num.Normalize(i), nil
+		}
+		return nil, utils.ErrParameterType
+	}
+	if v, ok := num.ToInteger(args[0]); ok {
+		return v, nil
+	}
+	return nil, utils.ErrParameterType
+}, utils.CheckArity(1))
 
-var floatFn = utils.SimpleFunc(func(args ...interface{}) (value interface{}) {
-	return args[0]
-}, utils.CheckArity(1), utils.ParamToFloat64(0))
+var floatFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if v, ok := num.ToFloat64(args[0]); ok {
+		return v, nil
+	}
+	return nil, utils.ErrParameterType
+}, utils.CheckArity(1))
 
-var minusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
-	if len(args) == 0 {
-		return nil, fmt.Errorf(`function "-" takes one or more arguments`)
+var rationalFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if len(args) == 2 {
+		return num.Rational(args[0], args[1])
+	}
+	if len(args) != 1 {
+		return nil, utils.ErrWrongNumberPar
 	}
+	if v, ok := num.ToRat(args[0]); ok {
+		return v, nil
+	}
+	return nil, utils.ErrParameterType
+}, utils.CheckArityAtLeast(1))
 
-	if utils.IsSlice(args[0]) {
-		res := make([]float64, len(args[0].([]float64)))
-		if len(args) == 1 {
-			for i, v := range args[0].([]float64) {
-				res[i] = -v
-			}
-		} else {
-			for i, v := range args[0].([]float64) {
+var isRationalFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(*big.Rat)
+	return ok
+}, utils.CheckArity(1))
+
+var decimalFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if s, ok := args[0].(string); ok {
+		return num.ParseDecimal(s)
+	}
+	if v, ok := num.ToDecimal(args[0]); ok {
+		return v, nil
+	}
+	return nil, utils.ErrParameterType
+}, utils.CheckArity(1))
+
+var isDecimalFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(num.Decimal)
+	return ok
+}, utils.CheckArity(1))
+
+var minusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf(`function "-" takes one or more arguments`)
+	}
+
+	if utils.IsSlice(args[0]) {
+		res := make([]float64, len(args[0].([]float64)))
+		if len(args) == 1 {
+			for i, v := range args[0].([]float64) {
+				res[i] = -v
+			}
+		} else {
+			for i, v := range args[0].([]float64) {
 				res[i] = v
 			}
 		}
@@ -1299,6 +1697,10 @@ var minusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err er
 		return res, nil
 	}
 
+	if num.AnyExtended(args...) {
+		return extendedMinus(args)
+	}
+
 	var resi int64
 	var resf float64
 	var f bool
@@ -1308,9 +1710,11 @@ var minusFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err er
 			if i == 0 && len(args) > 1 {
 				resi = arg
 				resf = float64(arg)
-			} else {
-				resi -= arg
+			} else if r, ok := num.SubInt64(resi, arg); ok {
+				resi = r
 				resf -= float64(arg)
+			} else {
+				return extendedMinus(args)
 			}
 		case float64:
 			if i == 0 && len(args) > 1 {
@@ -1352,13 +1756,21 @@ var mulFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 		return res, nil
 	}
 
+	if num.AnyExtended(args...) {
+		return num.Reduce(num.Mul, args)
+	}
+
 	var resi = int64(1)
 	var resf = float64(1)
 	var f bool
 	for _, arg := range args {
 		switch arg := arg.(type) {
 		case int64:
-			resi *= arg
+			r, ok := num.MulInt64(resi, arg)
+			if !ok {
+				return num.Reduce(num.Mul, args)
+			}
+			resi = r
 			resf *= float64(arg)
 		case float64:
 			resf *= arg
@@ -1374,6 +1786,10 @@ var mulFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 }, utils.ParamsToSameBaseType(), utils.ParamsSlicify())
 
 var minFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if num.AnyExtended(args...) {
+		return extremum(args, func(c int) bool { return c < 0 })
+	}
+
 	var resf = math.MaxFloat64
 	var f bool
 	for _, arg := range args {
@@ -1394,6 +1810,10 @@ var minFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 }, utils.CheckArityAtLeast(1))
 
 var maxFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
+	if num.AnyExtended(args...) {
+		return extremum(args, func(c int) bool { return c > 0 })
+	}
+
 	var resf = -math.MaxFloat64
 	var f bool
 	for _, arg := range args {
@@ -1436,6 +1856,10 @@ var divFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 		return res, nil
 	}
 
+	if num.AnyExtended(args...) {
+		return num.Reduce(num.Div, args)
+	}
+
 	var resi int64
 	var resf float64
 	var f bool
@@ -1445,6 +1869,8 @@ var divFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 			if i == 0 && len(args) > 1 {
 				resi = arg
 				resf = float64(arg)
+			} else if resi == math.MinInt64 && arg == -1 {
+				return num.Reduce(num.Div, args)
 			} else {
 				resi /= arg
 				resf /= float64(arg)
@@ -1466,22 +1892,55 @@ var divFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err erro
 	return resi, nil
 }, utils.ParamsToSameBaseType(), utils.ParamsSlicify())
 
+// extendedMinus subtracts numbers of the numeric tower, negating a single number.
+func extendedMinus(args []interface{}) (interface{}, error) {
+	if len(args) == 1 {
+		return num.Sub(int64(0), args[0])
+	}
+	return num.Reduce(num.Sub, args)
+}
+
+// extremum returns the number of args that wins over all others by better.
+func extremum(args []interface{}, better func(c int) bool) (interface{}, error) {
+	res := args[0]
+	for _, arg := range args[1:] {
+		c, err := num.Cmp(arg, res)
+		if err != nil {
+			return nil, err
+		}
+		if better(c) {
+			res = arg
+		}
+	}
+	return res, nil
+}
+
 var skipFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	n := int(args[0].(int64))
 
-	if !utils.IsSlice(args[1]) {
+	if isLazy(args[1]) {
+		s, _ := toSeq(args[1])
+		return lazy.Skip(n, s), nil
+	}
+
+	list := args[1]
+	if v, ok := list.(*persistent.Vector); ok {
+		list = v.Slice()
+	}
+
+	if !utils.IsSlice(list) {
 		return nil, utils.ErrParameterType
 	}
 
-	switch args[1].(type) {
+	switch list.(type) {
 	case []interface{}:
-		s := args[1].([]interface{})
+		s := list.([]interface{})
 		if len(s) <= n {
 			return []interface{}(nil), nil
 		}
 		return s[n:len(s)], nil
 	case []float64:
-		s := args[1].([]float64)
+		s := list.([]float64)
 		if len(s) <= n {
 			return []float64(nil), nil
 		}
@@ -1518,18 +1977,28 @@ var reverseFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err
 		return res, nil
 	}
 	return nil, utils.ErrParameterType
-}, utils.CheckArity(1))
+}, utils.CheckArity(1), utils.ParamToList(0))
 
 var takeFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	n := int(args[0].(int64))
 
-	if !utils.IsSlice(args[1]) {
+	if isLazy(args[1]) {
+		s, _ := toSeq(args[1])
+		return lazy.Take(n, s), nil
+	}
+
+	list := args[1]
+	if v, ok := list.(*persistent.Vector); ok {
+		list = v.Slice()
+	}
+
+	if !utils.IsSlice(list) {
 		return nil, utils.ErrParameterType
 	}
 
-	switch args[1].(type) {
+	switch list.(type) {
 	case []interface{}:
-		s := args[1].([]interface{})
+		s := list.([]interface{})
 		if len(s) < n {
 			n = len(s)
 		}
@@ -1540,7 +2009,7 @@ var takeFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err err
 
 		return s[0:n], nil
 	case []float64:
-		s := args[1].([]float64)
+		s := list.([]float64)
 		if len(s) < n {
 			n = len(s)
 		}
@@ -1553,110 +2022,190 @@ var takeFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err err
 	return nil, utils.ErrParameterType
 }, utils.CheckArity(2), utils.ParamToInt64(0))
 
-func andFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func andFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) == 0 {
-		return true, nil
+		return constant(true), nil
 	}
-	for _, arg := range args {
-		value, err = scope.Eval(arg)
-		if err != nil {
-			return nil, err
-		}
-		if value == false {
-			return false, nil
+	codes := c.compileAll(args)
+	return func(scope *Scope) (value interface{}, err error) {
+		for _, code := range codes {
+			value, err = code(scope)
+			if err != nil {
+				return nil, err
+			}
+			if value == false {
+				return false, nil
+			}
 		}
-	}
-	return value, err
+		return value, err
+	}, nil
 }
 
-func orFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func orFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) == 0 {
-		return false, nil
+		return constant(false), nil
 	}
-	for _, arg := range args {
-		value, err = scope.Eval(arg)
-		if err != nil {
-			return nil, err
-		}
-		if value != false {
-			return value, nil
+	codes := c.compileAll(args)
+	return func(scope *Scope) (value interface{}, err error) {
+		for _, code := range codes {
+			value, err = code(scope)
+			if err != nil {
+				return nil, err
+			}
+			if value != false {
+				return value, nil
+			}
 		}
-	}
-	return value, err
+		return value, err
+	}, nil
 }
 
-func timeFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func timeFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) != 1 {
 		return nil, errors.New("time takes 1 argument")
 	}
 
-	start := time.Now()
-	value, err = scope.Eval(args[0])
-	elapsed := time.Since(start)
-	scope.Printf("Elapsed %.2f milliseconds\n", float64(elapsed.Nanoseconds())/1e6)
-	return value, err
+	arg := c.compile(args[0])
+
+	return func(scope *Scope) (value interface{}, err error) {
+		start := time.Now()
+		value, err = arg(scope)
+		elapsed := time.Since(start)
+		scope.Printf("Elapsed %.2f milliseconds\n", float64(elapsed.Nanoseconds())/1e6)
+		return value, err
+	}, nil
 }
 
-func ifFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func ifFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) < 2 || len(args) > 3 {
 		return nil, errors.New(`function "if" takes two or three arguments`)
 	}
-	value, err = scope.Eval(args[0])
-	if err != nil {
-		return nil, err
+	test, then := c.compile(args[0]), c.compile(args[1])
+	otherwise := constant(false)
+	if len(args) == 3 {
+		otherwise = c.compile(args[2])
 	}
-	if value == false {
-		if len(args) == 3 {
-			return scope.Eval(args[2])
+	return func(scope *Scope) (interface{}, error) {
+		value, err := test(scope)
+		if err != nil {
+			return nil, err
 		}
-		return false, nil
-	}
-	return scope.Eval(args[1])
+		if value == false {
+			return otherwise(scope)
+		}
+		return then(scope)
+	}, nil
 }
 
-func condFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func condFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) < 2 {
 		return nil, errors.New(`function "cond" takes two or more arguments`)
 	}
 
-	i := 0
-	for ; i+1 < len(args); i += 2 {
-		value, err = scope.Eval(args[i])
-		if err != nil {
-			return nil, err
-		}
-		if value != false {
-			return scope.Eval(args[i+1])
-		}
-	}
-
-	if len(args)%2 == 0 {
-		return false, nil
+	codes := c.compileAll(args)
+	otherwise := constant(false)
+	if len(args)%2 != 0 {
+		otherwise = codes[len(codes)-1]
 	}
 
-	return scope.Eval(args[len(args)-1])
+	return func(scope *Scope) (value interface{}, err error) {
+		for i := 0; i+1 < len(codes); i += 2 {
+			value, err = codes[i](scope)
+			if err != nil {
+				return nil, err
+			}
+			if value != false {
+				return codes[i+1](scope)
+			}
+		}
+		return otherwise(scope)
+	}, nil
 }
 
-func varFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func varFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) == 0 || len(args) > 2 {
 		return nil, errors.New("var takes one or two arguments")
 	}
+	value := constant(nil)
+	if len(args) == 2 {
+		value = c.compile(args[1])
+	}
 	symbol, ok := args[0].(*ast.Symbol)
 	if !ok {
-		return nil, errors.New("var takes a symbol as first argument")
+		if !isPattern(args[0]) {
+			return nil, errors.New("var takes a symbol as first argument")
+		}
+		pat, err := parsePattern(args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range pat.names() {
+			c.declare(name)
+		}
+		return func(scope *Scope) (interface{}, error) {
+			v, err := value(scope)
+			if err != nil {
+				return nil, err
+			}
+			return nil, pat.create(scope, v)
+		}, nil
 	}
-	if len(args) == 1 {
-		value = nil
-	} else {
-		value, err = scope.Eval(args[1])
+	name := symbol.Name
+	c.declare(name)
+	return func(scope *Scope) (interface{}, error) {
+		v, err := value(scope)
+		if err != nil {
+			return nil, err
+		}
+		return nil, scope.Create(name, v)
+	}, nil
+}
+
+func letFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) < 2 {
+		return nil, errors.New("let takes a list of bindings and a body")
+	}
+	bindings, ok := paramList(args[0])
+	if !ok || len(bindings)%2 != 0 {
+		return nil, errors.New("let takes a list of pairs of bindings and values")
+	}
+	lc := c.branch()
+	pats := make([]*pattern, len(bindings)/2)
+	values := make([]code, len(bindings)/2)
+	for i := range pats {
+		pat, err := parsePattern(bindings[2*i])
 		if err != nil {
 			return nil, err
 		}
+		// The value is compiled before the names are declared,
+		// so it sees the bindings before it.
+		pats[i], values[i] = pat, lc.compile(bindings[2*i+1])
+		for _, name := range pat.names() {
+			lc.declare(name)
+		}
 	}
-	return nil, scope.Create(symbol.Name, value)
+	body := lc.compileBody(args[1:])
+
+	return func(scope *Scope) (interface{}, error) {
+		scope = scope.Branch()
+		scope.vars = make(map[string]interface{})
+		set := func(name string, v interface{}) {
+			scope.vars[name] = v
+		}
+		for i, pat := range pats {
+			v, err := values[i](scope)
+			if err != nil {
+				return nil, err
+			}
+			if err := pat.bind(v, set); err != nil {
+				return nil, err
+			}
+		}
+		return body(scope)
+	}, nil
 }
 
-func setFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func setFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) != 2 {
 		return nil, errors.New(`function "set" takes two arguments`)
 	}
@@ -1664,33 +2213,32 @@ func setFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
 	if !ok {
 		return nil, errors.New(`function "set" takes a symbol as first argument`)
 	}
-	value, err = scope.Eval(args[1])
-	if err != nil {
-		return nil, err
-	}
-	return nil, scope.Set(symbol.Name, value)
+	return c.compileSet(symbol.Name, c.compile(args[1])), nil
 }
 
-func doFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
-	scope = scope.Branch()
-	for _, arg := range args {
-		value, err = scope.Eval(arg)
-		if err != nil {
-			return nil, err
+func doFn(c *compiler, args []ast.Node) (code, error) {
+	body := c.branch().compileAll(args)
+	return func(scope *Scope) (value interface{}, err error) {
+		scope = scope.Branch()
+		for _, code := range body {
+			value, err = code(scope)
+			if err != nil {
+				return nil, err
+			}
 		}
-	}
-	return value, nil
+		return value, nil
+	}, nil
 }
 
-func codeFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func codeFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) != 1 {
 		return nil, errors.New("code takes one argument")
 	}
 
-	return scope.Code(args[0]), nil
+	return constant(c.fset.Code(args[0])), nil
 }
 
-func funcFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func funcFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) < 2 {
 		return nil, errors.New(`func takes two or more arguments`)
 	}
@@ -1700,84 +2248,101 @@ func funcFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
 		name = symbol.Name
 		i++
 	}
-	list, ok := args[i].(*ast.ListList)
-	if !ok {
-		return nil, errors.New(`func takes a list of parameters`)
+	if name != "" {
+		c.declare(name)
 	}
-	params := list.Nodes
-	for _, param := range params {
-		if _, ok := param.(*ast.Symbol); !ok {
-			return nil, errors.New("func's list of parameters must be a list of symbols")
+	makeFn, err := c.compileFunc(name, args[i], args[i+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return func(scope *Scope) (interface{}, error) {
+		fn := makeFn(scope)
+		if name != "" {
+			if err := scope.Create(name, fn); err != nil {
+				return nil, err
+			}
 		}
+		return fn, nil
+	}, nil
+}
+
+// compileFunc compiles a function with the given list of parameters and body.
+// The returned function creates the function value closing over scope.
+func (c *compiler) compileFunc(name string, list ast.Node, body []ast.Node) (func(scope *Scope) func(args ...interface{}) (interface{}, error), error) {
+	params, err := c.parseParams(name, list)
+	if err != nil {
+		return nil, err
 	}
-	body := args[i+1:]
 	if len(body) == 0 {
 		return nil, fmt.Errorf("func takes a body sequence")
 	}
-	fn := func(args ...interface{}) (value interface{}, err error) {
-		if len(args) != len(params) {
-			nameInfo := "anonymous function"
-			if name != "" {
-				nameInfo = fmt.Sprintf("function %q", name)
-			}
-			switch len(params) {
-			case 0:
-				return nil, fmt.Errorf("%s takes no arguments", nameInfo)
-			case 1:
-				return nil, fmt.Errorf("%s takes one argument", nameInfo)
-			default:
-				return nil, fmt.Errorf("%s takes %d arguments", nameInfo, len(params))
+	fc := c.function(name, params.names)
+	params.compileDefaults(fc)
+	bodyCode := fc.compileBody(body)
+	frame := fc.env.frame
+
+	return func(scope *Scope) func(args ...interface{}) (interface{}, error) {
+		return func(args ...interface{}) (value interface{}, err error) {
+			if params.simple() && len(args) != params.required {
+				return nil, params.arityError()
 			}
-		}
-		scope = scope.Branch()
-		for i, arg := range args {
-			err := scope.Create(params[i].(*ast.Symbol).Name, arg)
-			if err != nil {
-				panic("must not happen: " + err.Error())
+			if st := scope.state; st != nil {
+				d, err := st.enter()
+				if err != nil {
+					return nil, err
+				}
+				defer st.leave(d)
 			}
-		}
-		for _, node := range body {
-			value, err = scope.Eval(node)
-			if err != nil {
+			s := &Scope{parent: scope, fset: scope.fset, frame: frame, slots: make([]interface{}, len(params.names)), state: scope.state}
+			if err := params.bind(s, args); err != nil {
 				return nil, err
 			}
+			return bodyCode(s)
 		}
-		return value, nil
-	}
-	if name != "" {
-		if err = scope.Create(name, fn); err != nil {
-			return nil, err
-		}
-	}
-	return fn, nil
+	}, nil
 }
 
-func macroFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func macroFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) != 1 {
 		return nil, errors.New(`# takes one argument`)
 	}
 
-	node := args[0]
+	body := c.branch().compile(args[0])
 
-	fn := func(args ...interface{}) (value interface{}, err error) {
-		for i, arg := range args {
-			scope.SetOrCreate(fmt.Sprintf("%%%v", i+1), arg)
-		}
+	return func(scope *Scope) (interface{}, error) {
+		fn := func(args ...interface{}) (value interface{}, err error) {
+			if st := scope.state; st != nil {
+				d, err := st.enter()
+				if err != nil {
+					return nil, err
+				}
+				defer st.leave(d)
+			}
+			vars := make(map[string]interface{}, len(args))
+			for i, arg := range args {
+				vars[fmt.Sprintf("%%%v", i+1)] = arg
+			}
 
-		return scope.Eval(node)
-	}
+			return body(&Scope{parent: scope, fset: scope.fset, vars: vars, state: scope.state})
+		}
 
-	return fn, nil
+		return fn, nil
+	}, nil
 }
 
 var mapFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	fn := args[0]
 
+	if isLazy(args[1:]...) {
+		return lazyMap(fn, args[1:])
+	}
+
 	lists := [][]interface{}{}
 	for _, arg := range args[1:] {
-		list, ok := utils.ToList(arg)
-		if !ok {
-			return nil, utils.ErrParameterType
+		list, err := utils.ToList(arg)
+		if err != nil {
+			return nil, err
 		}
 		lists = append(lists, list)
 	}
@@ -1808,9 +2373,9 @@ var mapIndexedFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, e
 
 	lists := [][]interface{}{}
 	for _, arg := range args[1:] {
-		list, ok := utils.ToList(arg)
-		if !ok {
-			return nil, utils.ErrParameterType
+		list, err := utils.ToList(arg)
+		if err != nil {
+			return nil, err
 		}
 		lists = append(lists, list)
 	}
@@ -1860,7 +2425,7 @@ var sortAscFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err
 	}
 
 	return nil, utils.ErrParameterType
-}, utils.CheckArity(2))
+}, utils.CheckArity(2), utils.ParamToList(1))
 
 var sortIndexFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	fn := args[0]
@@ -1877,7 +2442,7 @@ var sortIndexFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, er
 	}
 
 	return nil, utils.ErrParameterType
-}, utils.CheckArity(2))
+}, utils.CheckArity(2), utils.ParamToList(1))
 
 var sortDescFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	fn := args[0]
@@ -1898,53 +2463,63 @@ var sortDescFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err
 	}
 
 	return nil, utils.ErrParameterType
-}, utils.CheckArity(2))
+}, utils.CheckArity(2), utils.ParamToList(1))
 
-func reduceFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func reduceFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) != 2 && len(args) != 3 {
 		return nil, errors.New(`reduce takes 2 or three arguments arguments`)
 	}
 
-	fn, err := scope.Eval(args[0])
-	if err != nil {
-		return nil, scope.errorAt(args[0], err)
-	}
-	listRaw, err := scope.Eval(args[1])
-	if err != nil {
-		return nil, scope.errorAt(args[1], err)
-	}
+	codes := c.compileAll(args)
 
-	list, ok := listRaw.([]interface{})
-	if !ok {
-		return nil, utils.ErrParameterType
-	}
+	return func(scope *Scope) (value interface{}, err error) {
+		fn, err := codes[0](scope)
+		if err != nil {
+			return nil, c.errorAt(args[0], err)
+		}
+		listRaw, err := codes[1](scope)
+		if err != nil {
+			return nil, c.errorAt(args[1], err)
+		}
 
-	var init interface{}
+		if s, ok := listRaw.(*lazy.Seq); ok {
+			if listRaw, err = s.Slice(); err != nil {
+				return nil, c.errorAt(args[1], err)
+			}
+		}
 
-	if len(args) == 3 {
-		init, err = scope.Eval(args[2])
-		if err != nil {
-			return nil, scope.errorAt(args[2], err)
+		list, ok := utils.AsList(listRaw)
+		if !ok {
+			return nil, utils.ErrParameterType
 		}
-	}
 
-	r := init
-	if fn, ok := fn.(func(...interface{}) (interface{}, error)); ok {
-		for i, v := range list {
-			if i == 0 && r == nil {
-				r = v
-			} else {
-				r, err = fn(r, v)
-				if err != nil {
-					return nil, err
-				}
+		var init interface{}
+
+		if len(codes) == 3 {
+			init, err = codes[2](scope)
+			if err != nil {
+				return nil, c.errorAt(args[2], err)
 			}
 		}
 
-		return r, nil
-	}
+		r := init
+		if fn, ok := fn.(func(...interface{}) (interface{}, error)); ok {
+			for i, v := range list {
+				if i == 0 && r == nil {
+					r = v
+				} else {
+					r, err = fn(r, v)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
 
-	return nil, utils.ErrParameterType
+			return r, nil
+		}
+
+		return nil, utils.ErrParameterType
+	}, nil
 }
 
 func filterFn(args ...interface{}) (value interface{}, err error) {
@@ -1954,7 +2529,19 @@ func filterFn(args ...interface{}) (value interface{}, err error) {
 
 	fn := args[0]
 
+	if isLazy(args[1]) {
+		return lazyFilter(fn, args[1])
+	}
+
 	switch list := args[1].(type) {
+	case *persistent.Vector:
+		return filterFn(fn, list.Slice())
+	case *persistent.Set:
+		res, err := filterFn(fn, list.Slice())
+		if err != nil {
+			return nil, err
+		}
+		return persistent.NewSet(res.([]interface{})...)
 	case []interface{}:
 		res := []interface{}{}
 		for _, v := range list {
@@ -2003,6 +2590,8 @@ func countIfFn(args ...interface{}) (value interface{}, err error) {
 	fn := args[0]
 
 	switch list := args[1].(type) {
+	case *persistent.Vector:
+		return countIfFn(fn, list.Slice())
 	case []interface{}:
 		res := 0
 		for _, v := range list {
@@ -2057,7 +2646,7 @@ var applyFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err er
 	}
 
 	return nil, utils.ErrParameterType
-}, utils.CheckArity(2))
+}, utils.CheckArity(2), utils.ParamToList(1))
 
 var flattenFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err error) {
 	res := []interface{}{}
@@ -2067,6 +2656,8 @@ var flattenFn = utils.ErrFunc(func(args ...interface{}) (value interface{}, err
 			switch arg.(type) {
 			case []interface{}:
 				sub(arg.([]interface{}))
+			case *persistent.Vector:
+				sub(arg.(*persistent.Vector).Slice())
 			default:
 				res = append(res, arg)
 			}
@@ -2180,72 +2771,82 @@ var vecMapIndexedFn = utils.ErrFunc(func(args ...interface{}) (value interface{}
 	return nil, utils.ErrParameterType
 }, utils.CheckArityAtLeast(2))
 
-func forFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func forFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) < 4 {
 		return nil, errors.New(`for takes four or more arguments`)
 	}
-	init, test, step, code := args[0], args[1], args[2], args[3:]
-	scope = scope.Branch()
-	_, err = scope.Eval(init)
-	if err != nil {
-		return nil, err
-	}
-	for {
-		more, err := scope.Eval(test)
+	bc := c.branch()
+	init, test, step, body := bc.compile(args[0]), bc.compile(args[1]), bc.compile(args[2]), bc.compileAll(args[3:])
+	return func(scope *Scope) (value interface{}, err error) {
+		scope = scope.Branch()
+		_, err = init(scope)
 		if err != nil {
 			return nil, err
 		}
-		if more == false {
-			return value, nil
-		}
-
-		for _, c := range code {
-			value, err = scope.Eval(c)
+		for {
+			if err := scope.step(); err != nil {
+				return nil, err
+			}
+			more, err := test(scope)
 			if err != nil {
 				return nil, err
 			}
-		}
+			if more == false {
+				return value, nil
+			}
 
-		_, err = scope.Eval(step)
-		if err != nil {
-			return nil, err
+			for _, stmt := range body {
+				value, err = stmt(scope)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			_, err = step(scope)
+			if err != nil {
+				return nil, err
+			}
 		}
-	}
-	panic("unreachable")
+	}, nil
 }
 
-func whileFn(scope *Scope, args []ast.Node) (value interface{}, err error) {
+func whileFn(c *compiler, args []ast.Node) (code, error) {
 	if len(args) < 2 {
 		return nil, errors.New(`while takes 2 or more arguments`)
 	}
-	test, code := args[0], args[1:]
-	scope = scope.Branch()
-	for {
-		more, err := scope.Eval(test)
-		if err != nil {
-			return nil, err
-		}
-
-		switch more.(type) {
-		case bool:
-			if more != true {
-				return value, nil
-			}
-		default:
-			more, err = utils.Call(more)
-			if more != true {
-				return value, nil
+	bc := c.branch()
+	test, body := bc.compile(args[0]), bc.compileAll(args[1:])
+	return func(scope *Scope) (value interface{}, err error) {
+		scope = scope.Branch()
+		for {
+			if err := scope.step(); err != nil {
+				return nil, err
 			}
-		}
-
-		for _, c := range code {
-			value, err = scope.Eval(c)
+			more, err := test(scope)
 			if err != nil {
 				return nil, err
 			}
+
+			switch more.(type) {
+			case bool:
+				if more != true {
+					return value, nil
+				}
+			default:
+				more, err = utils.Call(more)
+				if more != true {
+					return value, nil
+				}
+			}
+
+			for _, stmt := range body {
+				value, err = stmt(scope)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
-	}
-	panic("unreachable")
+	}, nil
 }
 
 func threadFn(args ...interface{}) (value interface{}, err error) {
@@ -2269,7 +2870,116 @@ func threadFn(args ...interface{}) (value interface{}, err error) {
 	return
 }
 
+// compareOrdered compares the values Go can not order with < or compare
+// by ==: numbers of the numeric tower, times and durations. ok is false
+// for other values.
+func compareOrdered(a, b interface{}) (c int, ok bool) {
+	switch a := a.(type) {
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, true
+			case a.After(b):
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	case time.Duration:
+		if b, ok := b.(time.Duration); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	if num.AnyExtended(a, b) && num.IsNumber(a) && num.IsNumber(b) {
+		c, _ := num.Cmp(a, b)
+		return c, true
+	}
+	return 0, false
+}
+
+// equal reports whether a and b are equal. Lists, vecs, dicts and sets
+// are equal if they hold equal values, whether they are persistent or not.
+func equal(a, b interface{}) bool {
+	if c, ok := compareOrdered(a, b); ok {
+		return c == 0
+	}
+	switch a.(type) {
+	case []interface{}, *persistent.Vector:
+		l1, _ := utils.AsList(a)
+		l2, ok := utils.AsList(b)
+		if !ok || len(l1) != len(l2) {
+			return false
+		}
+		for i := range l1 {
+			if !equal(l1[i], l2[i]) {
+				return false
+			}
+		}
+		return true
+	case []float64:
+		v1 := a.([]float64)
+		v2, ok := b.([]float64)
+		if !ok || len(v1) != len(v2) {
+			return false
+		}
+		for i := range v1 {
+			if v1[i] != v2[i] {
+				return false
+			}
+		}
+		return true
+	case map[interface{}]interface{}, *persistent.Map:
+		if !utils.IsDict(b) || dictLen(a) != dictLen(b) {
+			return false
+		}
+		eq := true
+		utils.RangeDict(a, func(k, v interface{}) bool {
+			v2, ok := utils.DictGet(b, k)
+			eq = ok && equal(v, v2)
+			return eq
+		})
+		return eq
+	case *persistent.Set:
+		s2, ok := b.(*persistent.Set)
+		if !ok || a.(*persistent.Set).Len() != s2.Len() {
+			return false
+		}
+		eq := true
+		a.(*persistent.Set).Range(func(x interface{}) bool {
+			eq = s2.Contains(x)
+			return eq
+		})
+		return eq
+	}
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// dictLen returns the number of keys of a dict.
+func dictLen(d interface{}) int {
+	if m, ok := d.(*persistent.Map); ok {
+		return m.Len()
+	}
+	return len(d.(map[interface{}]interface{}))
+}
+
 var lessThanEqualFn = utils.SimpleFunc(func(v ...interface{}) bool {
+	if c, ok := compareOrdered(v[0], v[1]); ok {
+		return c <= 0
+	}
 	switch v[0].(type) {
 	case float64:
 		return v[0].(float64) <= v[1].(float64)
@@ -2281,6 +2991,9 @@ var lessThanEqualFn = utils.SimpleFunc(func(v ...interface{}) bool {
 }, utils.CheckArity(2), utils.ParamsToSameBaseType())
 
 var greaterThanEqualFn = utils.SimpleFunc(func(v ...interface{}) bool {
+	if c, ok := compareOrdered(v[0], v[1]); ok {
+		return c >= 0
+	}
 	switch v[0].(type) {
 	case float64:
 		return v[0].(float64) >= v[1].(float64)
@@ -2292,6 +3005,9 @@ var greaterThanEqualFn = utils.SimpleFunc(func(v ...interface{}) bool {
 }, utils.CheckArity(2), utils.ParamsToSameBaseType())
 
 var lessThanFn = utils.SimpleFunc(func(v ...interface{}) bool {
+	if c, ok := compareOrdered(v[0], v[1]); ok {
+		return c < 0
+	}
 	switch v[0].(type) {
 	case float64:
 		return v[0].(float64) < v[1].(float64)
@@ -2303,6 +3019,9 @@ var lessThanFn = utils.SimpleFunc(func(v ...interface{}) bool {
 }, utils.CheckArity(2), utils.ParamsToSameBaseType())
 
 var greaterThanFn = utils.SimpleFunc(func(v ...interface{}) bool {
+	if c, ok := compareOrdered(v[0], v[1]); ok {
+		return c > 0
+	}
 	switch v[0].(type) {
 	case float64:
 		return v[0].(float64) > v[1].(float64)
@@ -0,0 +1,102 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/utils"
+)
+
+// memberName returns the name of the method or field in a call of . or .-,
+// a symbol or a keyword.
+func memberName(node ast.Node) (string, bool) {
+	switch node := node.(type) {
+	case *ast.Symbol:
+		return node.Name, true
+	case *ast.Keyword:
+		return node.Name, true
+	}
+	return "", false
+}
+
+// callMethod calls the exported method name of the Go value v.
+func callMethod(v interface{}, name string, args []interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("cannot call method %s of nil", name)
+	}
+	m := reflect.ValueOf(v).MethodByName(name)
+	if !m.IsValid() {
+		return nil, fmt.Errorf("%T has no method %s", v, name)
+	}
+	return utils.CallGo(name, m, args)
+}
+
+// getField returns the exported field name of the Go struct v, or of the
+// struct v points to.
+func getField(v interface{}, name string) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("cannot get field %s of nil %T", name, v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot get field %s of %s", name, utils.TypeName(v))
+	}
+	f, ok := rv.Type().FieldByName(name)
+	if !ok || f.PkgPath != "" {
+		return nil, fmt.Errorf("%T has no field %s", v, name)
+	}
+	return utils.FromGo(rv.FieldByIndex(f.Index)), nil
+}
+
+func dotFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) < 2 {
+		return nil, errors.New(". takes a value, a method name and the arguments of the method")
+	}
+	name, ok := memberName(args[1])
+	if !ok {
+		return nil, errors.New(". takes a method name as second argument")
+	}
+	obj := c.compile(args[0])
+	argCodes := c.compileAll(args[2:])
+
+	return func(scope *Scope) (value interface{}, err error) {
+		v, err := obj(scope)
+		if err != nil {
+			return nil, err
+		}
+		vargs, err := evalAll(scope, argCodes)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				err = c.panicAt(scope, args[1], r)
+			}
+		}()
+		return callMethod(v, name, vargs)
+	}, nil
+}
+
+func dotFieldFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 2 {
+		return nil, errors.New(".- takes a value and a field name")
+	}
+	name, ok := memberName(args[1])
+	if !ok {
+		return nil, errors.New(".- takes a field name as second argument")
+	}
+	value := c.compile(args[0])
+
+	return func(scope *Scope) (interface{}, error) {
+		v, err := value(scope)
+		if err != nil {
+			return nil, err
+		}
+		return getField(v, name)
+	}, nil
+}
@@ -0,0 +1,220 @@
+package gel_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel"
+	"github.com/Stromberg/gel/dataserie"
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	Owner   string
+	Balance float64
+	Tags    []string
+	secret  string
+}
+
+func (a *account) Deposit(amount float64) float64 {
+	a.Balance += amount
+	return a.Balance
+}
+
+func (a *account) Withdraw(amount float64) error {
+	if amount > a.Balance {
+		return errors.New("insufficient funds")
+	}
+	a.Balance -= amount
+	return nil
+}
+
+func (a *account) Apply(f func(float64) float64) float64 {
+	return f(a.Balance)
+}
+
+func (a *account) Panic() {
+	panic("boom")
+}
+
+func TestInterop(t *testing.T) {
+	eval := func(expr string) (interface{}, error) {
+		g, err := gel.New(expr)
+		assert.NoError(t, err, expr)
+		env := gel.NewEnv()
+		env.AddVar("acc", &account{Owner: "ann", Balance: 10, Tags: []string{"a", "b"}, secret: "s"})
+		env.AddVar("ds", dataserie.NewLine("line", dataserie.ToPoints([]string{"2019-01-31", "2019-02-28"}, []float64{1, 2})))
+		return g.Eval(env)
+	}
+	tests := []struct {
+		expr  string
+		value interface{}
+	}{
+		{"(.- acc Owner)", "ann"},
+		{"(.- acc Tags)", []interface{}{"a", "b"}},
+		{"(. acc Deposit 5)", 15.0},
+		{"(. acc Withdraw 4) (.- acc :Balance)", 6.0},
+		{"(. acc Apply (fn [b] (* b 2)))", 20.0},
+		{"(.- ds Name)", "line"},
+		{"(. ds Xs)", []interface{}{"2019-01-31", "2019-02-28"}},
+		{"(. ds Ys)", []float64{1, 2}},
+		{"(.- (. ds After \"2019-02-01\") Name)", "line"},
+	}
+	for _, test := range tests {
+		r, err := eval(test.expr)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, r, test.expr)
+	}
+
+	errorTests := []struct {
+		expr string
+		err  string
+	}{
+		{"(. acc Withdraw 100)", "twik source:1:2: insufficient funds"},
+		{`(. acc Deposit "5")`, "twik source:1:2: argument 1 of Deposit: expected float, got string"},
+		{"(. acc Deposit)", "twik source:1:2: Deposit takes one argument, got 0"},
+		{"(. acc Close)", "twik source:1:2: *gel_test.account has no method Close"},
+		{"(.- acc secret)", "twik source:1:2: *gel_test.account has no field secret"},
+		{"(.- 1 Name)", "twik source:1:2: cannot get field Name of int"},
+		{"(. acc Panic)", "twik source:1:8: boom"},
+		{"(. acc)", "twik source:1:2: . takes a value, a method name and the arguments of the method"},
+	}
+	for _, test := range errorTests {
+		_, err := eval(test.expr)
+		assert.EqualError(t, err, test.err, test.expr)
+	}
+}
+
+func TestInteropMissing(t *testing.T) {
+	g, err := gel.New("(. acc Deposit amount)")
+	assert.NoError(t, err)
+	m, err := g.Missing(gel.NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acc", "amount"}, m)
+}
+
+func TestAddFunc(t *testing.T) {
+	eval := func(expr string) (interface{}, error) {
+		g, err := gel.New(expr)
+		assert.NoError(t, err, expr)
+		env := gel.NewEnv()
+		env.AddFunc("scale", func(x float64, n int) float64 { return x * float64(n) })
+		env.AddFunc("join", func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		})
+		env.AddFunc("div", func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return a / b, nil
+		})
+		env.AddFunc("twice", func(args ...interface{}) (interface{}, error) {
+			return []interface{}{args[0], args[0]}, nil
+		})
+		return g.Eval(env)
+	}
+	tests := []struct {
+		expr  string
+		value interface{}
+	}{
+		{"(scale 1.5 2)", 3.0},
+		{"(scale 2 3.0)", 6.0},
+		{`(join "-" "a" "b" :c)`, "a-b-c"},
+		{`(join "-")`, ""},
+		{"(div 7 2)", int64(3)},
+		{"(map (fn [x] (scale x 2)) [1 2])", []interface{}{2.0, 4.0}},
+		{"(twice 1)", []interface{}{int64(1), int64(1)}},
+	}
+	for _, test := range tests {
+		r, err := eval(test.expr)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, r, test.expr)
+	}
+
+	errorTests := []struct {
+		expr string
+		err  string
+	}{
+		{`(scale 1 "2")`, "twik source:1:2: argument 2 of scale: expected int, got string"},
+		{"(scale 1 2.5)", "twik source:1:2: argument 2 of scale: expected int, got float"},
+		{"(scale 1)", "twik source:1:2: scale takes 2 arguments, got 1"},
+		{"(join)", "twik source:1:2: join takes at least one argument, got 0"},
+		{"(join \"\" 1)", "twik source:1:2: argument 2 of join: expected string, got int"},
+		{"(div 1 0)", "twik source:1:2: division by zero"},
+	}
+	for _, test := range errorTests {
+		_, err := eval(test.expr)
+		assert.EqualError(t, err, test.err, test.expr)
+	}
+
+	assert.Panics(t, func() { gel.NewEnv().AddFunc("x", 1) })
+}
+
+type item struct {
+	Name   string  `gel:"name"`
+	Weight float64 `gel:"weight"`
+	Count  int
+	Hidden string `gel:"-"`
+}
+
+type order struct {
+	ID     int64              `gel:"id"`
+	Placed time.Time          `gel:"placed"`
+	Items  []item             `gel:"items"`
+	Prices map[string]float64 `gel:"prices"`
+	Total  *float64           `gel:"total"`
+}
+
+func TestEvalInto(t *testing.T) {
+	evalInto := func(expr string, dst interface{}) error {
+		g, err := gel.New(expr)
+		assert.NoError(t, err, expr)
+		return g.EvalInto(gel.NewEnv(), dst)
+	}
+
+	var o order
+	err := evalInto(`{:id 7
+		:placed "2020-05-01"
+		:items [{:name "a" :weight 1.5 :count 2} {"name" :b "weight" 2 :hidden "x"}]
+		:prices {"a" 1 :b 2.5}
+		:total 6.5
+		:ignored true}`, &o)
+	assert.NoError(t, err)
+	total := 6.5
+	assert.Equal(t, order{
+		ID:     7,
+		Placed: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+		Items:  []item{{Name: "a", Weight: 1.5, Count: 2}, {Name: "b", Weight: 2}},
+		Prices: map[string]float64{"a": 1, "b": 2.5},
+		Total:  &total,
+	}, o)
+
+	var xs []float64
+	assert.NoError(t, evalInto("(map inc (vec 1 2))", &xs))
+	assert.Equal(t, []float64{2, 3}, xs)
+	var n int
+	assert.NoError(t, evalInto("(+ 1 2)", &n))
+	assert.Equal(t, 3, n)
+	var when time.Time
+	assert.NoError(t, evalInto(`"2020-05-01T13:30:00Z"`, &when))
+	assert.Equal(t, time.Date(2020, 5, 1, 13, 30, 0, 0, time.UTC), when)
+
+	errorTests := []struct {
+		expr string
+		err  string
+	}{
+		{`{:items [{} {} {} {:weight "heavy"}]}`, "result.items[3].weight: expected float, got string"},
+		{`{:id 1.5}`, "result.id: expected int, got float"},
+		{`{:placed "tomorrow"}`, `result.placed: expected time, got "tomorrow"`},
+		{`{:prices {"a" :b}}`, "result.prices[a]: expected float, got keyword"},
+		{`[1 2]`, "result: expected dict, got list"},
+		{`(throw "failed")`, "twik source:1:2: failed"},
+	}
+	for _, test := range errorTests {
+		var o order
+		assert.EqualError(t, evalInto(test.expr, &o), test.err, test.expr)
+	}
+	assert.EqualError(t, evalInto("1", o), "EvalInto needs a non-nil pointer, got gel_test.order")
+}
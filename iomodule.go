@@ -0,0 +1,118 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/utils"
+)
+
+func init() {
+	module.RegisterModules(IOModule)
+}
+
+// IOModule contains the functions that access files relative to module.BasePath.
+var IOModule = &module.Module{
+	Name:        "io",
+	Description: "File access relative to module.BasePath",
+	Funcs: []*module.Func{
+		&module.Func{
+			Name: "eval-file", F: scopeFunc(evalFileFn),
+			Signature:   "(eval-file filename)",
+			Description: "Evaluates file in its own context and returns the result",
+		},
+		&module.Func{Name: "load-file", F: loadFileFn,
+			Signature:   "(load-file filename)",
+			Description: "Evaluates filename in current context and returns the last statement",
+		},
+		&module.Func{Name: "ns", F: nsFn,
+			Signature:   "(ns name)",
+			Description: "Names the namespace of the current file. require binds the symbols of the file as name/symbol",
+		},
+		&module.Func{Name: "require", F: requireFn,
+			Signature:   "(require filename) or (require filename :as alias)",
+			Description: "Evaluates filename in its own context once and binds its symbols as alias/symbol.\nWithout an alias, the name given by ns or the base name of the file is used",
+		},
+		&module.Func{Name: "slurp", F: slurpFn,
+			Signature:   "(slurp filename)",
+			Description: "Reads content of file into a string",
+		},
+		&module.Func{Name: "read-file", F: readFileFn,
+			Signature:   "(read-file filename)",
+			Description: "Reads a single value of gel data from file without evaluating it, like read-string",
+		},
+	},
+}
+
+func evalFileFn(scope *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	file, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	realPath := path.Join(module.BasePath, file)
+	data, err := ioutil.ReadFile(realPath)
+	if err != nil {
+		return nil, err
+	}
+	code := string(data)
+
+	g, err := NewWithNameAndRepo(code, file, scope.Repo())
+	if err != nil {
+		return nil, fmt.Errorf("Error in eval: %v", err)
+	}
+
+	return g.Eval(NewEnv())
+}
+
+func loadFileFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 1 {
+		return nil, errors.New("load-file function takes a single string argument")
+	}
+
+	arg := c.compile(args[0])
+
+	return func(scope *Scope) (interface{}, error) {
+		r, err := arg(scope)
+		if err != nil {
+			return nil, err
+		}
+
+		file, ok := r.(string)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		realPath := path.Join(module.BasePath, file)
+		data, err := ioutil.ReadFile(realPath)
+		if err != nil {
+			return nil, err
+		}
+		code := string(data)
+
+		node, err := ParseString(scope.fset, file, code)
+		if err != nil {
+			return nil, err
+		}
+
+		return scope.eval(node)
+	}, nil
+}
+
+var slurpFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	file, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	realPath := path.Join(module.BasePath, file)
+	data, err := ioutil.ReadFile(realPath)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}, utils.CheckArity(1))
@@ -0,0 +1,38 @@
+package gel
+
+import (
+	"github.com/Stromberg/gel/utils"
+)
+
+// Keyword is the value of a :name literal. Keywords are distinct from
+// strings and look up their value when called with a dict.
+type Keyword = utils.Keyword
+
+var keywordFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case Keyword:
+		return v, nil
+	case string:
+		return Keyword(v), nil
+	case Symbol:
+		return Keyword(v), nil
+	}
+	return nil, utils.ErrParameterType
+}, utils.CheckArity(1))
+
+var isKeywordFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(Keyword)
+	return ok
+}, utils.CheckArity(1))
+
+var nameFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case Keyword:
+		return string(v), nil
+	case string:
+		return v, nil
+	case Symbol:
+		return string(v), nil
+	}
+	return nil, utils.ErrParameterType
+}, utils.CheckArity(1))
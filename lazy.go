@@ -0,0 +1,135 @@
+package gel
+
+import (
+	"github.com/Stromberg/gel/f64s"
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/utils"
+)
+
+// isLazy reports whether any of args is a lazy sequence or an f64s.Iterable,
+// which makes map, filter, take and skip return lazy sequences.
+func isLazy(args ...interface{}) bool {
+	for _, arg := range args {
+		switch arg.(type) {
+		case *lazy.Seq, f64s.Iterable:
+			return true
+		}
+	}
+	return false
+}
+
+// toSeq returns c as a lazy sequence, without realizing it if it is an
+// f64s.Iterable.
+func toSeq(c interface{}) (*lazy.Seq, bool) {
+	switch c := c.(type) {
+	case *lazy.Seq:
+		return c, true
+	case f64s.Iterable:
+		return lazy.New(func() lazy.Iterator {
+			next := c.Iterate()
+			return func() (interface{}, bool, error) {
+				v, ok := next()
+				return v, ok, nil
+			}
+		}), true
+	}
+	if l, err := utils.ToList(c); err == nil {
+		return lazy.FromSlice(l), true
+	}
+	return nil, false
+}
+
+func toSeqs(cs []interface{}) ([]*lazy.Seq, error) {
+	res := make([]*lazy.Seq, len(cs))
+	for i, c := range cs {
+		s, ok := toSeq(c)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		res[i] = s
+	}
+	return res, nil
+}
+
+// lazyFunc returns a function calling the gel function fn.
+func lazyFunc(fn interface{}) lazy.Func {
+	return func(args ...interface{}) (interface{}, error) {
+		return utils.Call(fn, args...)
+	}
+}
+
+func lazyMap(fn interface{}, cs []interface{}) (interface{}, error) {
+	seqs, err := toSeqs(cs)
+	if err != nil {
+		return nil, err
+	}
+	return lazy.Map(lazyFunc(fn), seqs...), nil
+}
+
+func lazyFilter(fn, c interface{}) (interface{}, error) {
+	seqs, err := toSeqs([]interface{}{c})
+	if err != nil {
+		return nil, err
+	}
+	return lazy.Filter(lazyFunc(fn), seqs[0]), nil
+}
+
+var lazyRangeFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	var start, end, step interface{} = int64(0), nil, int64(1)
+	switch len(args) {
+	case 0:
+	case 1:
+		end = args[0]
+	case 2:
+		start, end = args[0], args[1]
+	case 3:
+		start, end, step = args[0], args[1], args[2]
+	default:
+		return nil, utils.ErrWrongNumberPar
+	}
+	return lazy.Range(start, end, step)
+})
+
+var iterateFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return lazy.Iterate(lazyFunc(args[0]), args[1]), nil
+}, utils.CheckArity(2))
+
+var cycleFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	s, ok := toSeq(args[0])
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return lazy.Cycle(s), nil
+}, utils.CheckArity(1))
+
+var lazySeqFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	s, ok := toSeq(args[0])
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return s, nil
+}, utils.CheckArity(1))
+
+var realizeFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	s, ok := toSeq(args[0])
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return s.Slice()
+}, utils.CheckArity(1))
+
+var isLazyFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	return isLazy(args[0])
+}, utils.CheckArity(1))
+
+var takeWhileFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	s, ok := toSeq(args[1])
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	res := lazy.TakeWhile(lazyFunc(args[0]), s)
+	if isLazy(args[1]) {
+		return res, nil
+	}
+	return res.Slice()
+}, utils.CheckArity(2))
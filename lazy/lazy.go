@@ -0,0 +1,335 @@
+// Package lazy implements lazy sequences, computing their values only
+// when they are iterated. Sequences may be infinite. The values computed
+// are kept, so the functions of a sequence are called once for each value
+// however many times the sequence is iterated.
+package lazy
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Stromberg/gel/num"
+)
+
+// Iterator returns the next value of a sequence and true, or false when
+// the sequence is done. An error ends the sequence.
+type Iterator func() (value interface{}, ok bool, err error)
+
+// Func is a function applied to the values of a sequence.
+type Func func(args ...interface{}) (interface{}, error)
+
+// Seq is a lazy sequence. It is safe for concurrent use.
+type Seq struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// iterate returns the iterator computing the values, next once it is
+	// created.
+	iterate func() Iterator
+	next    Iterator
+	// busy is set while next computes a value, without holding mu, as it
+	// may iterate s itself.
+	busy  bool
+	cells []interface{}
+	done  bool
+	err   error
+}
+
+// New returns the sequence of the values of the iterator returned by
+// iterate, which is called once, when the first value is needed.
+func New(iterate func() Iterator) *Seq {
+	s := &Seq{iterate: iterate}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Iterate returns an iterator over the values of s.
+func (s *Seq) Iterate() Iterator {
+	i := 0
+	return func() (interface{}, bool, error) {
+		v, ok, err := s.cell(i)
+		if ok {
+			i++
+		}
+		return v, ok, err
+	}
+}
+
+// cell returns the value at index i of s, computing the values up to i
+// that were not computed yet.
+func (s *Seq) cell(i int) (interface{}, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i >= len(s.cells) {
+		if s.done {
+			return nil, false, s.err
+		}
+		if s.busy {
+			s.cond.Wait()
+			continue
+		}
+		if s.next == nil {
+			s.next = s.iterate()
+		}
+		s.busy = true
+		v, ok, err := s.compute()
+		switch {
+		case err != nil:
+			s.done, s.err = true, err
+		case !ok:
+			s.done = true
+		default:
+			s.cells = append(s.cells, v)
+		}
+	}
+	return s.cells[i], true, nil
+}
+
+// compute calls next without holding mu, which is held again when it
+// returns or panics.
+func (s *Seq) compute() (interface{}, bool, error) {
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.busy = false
+		s.cond.Broadcast()
+	}()
+	return s.next()
+}
+
+// Slice realizes s. It does not return for infinite sequences.
+func (s *Seq) Slice() ([]interface{}, error) {
+	res := []interface{}{}
+	next := s.Iterate()
+	for {
+		v, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return res, nil
+		}
+		res = append(res, v)
+	}
+}
+
+// Nth returns the value at index i of s, realizing only the values up to i.
+func (s *Seq) Nth(i int) (interface{}, bool, error) {
+	if i < 0 {
+		return nil, false, nil
+	}
+	next := s.Iterate()
+	for ; ; i-- {
+		v, ok, err := next()
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		if i == 0 {
+			return v, true, nil
+		}
+	}
+}
+
+// String does not realize s, as it may be infinite.
+func (s *Seq) String() string {
+	return "#lazy-seq"
+}
+
+// FromSlice returns the sequence of items.
+func FromSlice(items []interface{}) *Seq {
+	s := New(nil)
+	s.cells, s.done = items, true
+	return s
+}
+
+// Range returns the numbers from start up to, not including, end, step
+// apart. A nil end gives an infinite sequence. The numbers may be of any
+// kind of the numeric tower.
+func Range(start, end, step interface{}) (*Seq, error) {
+	dir, err := num.Cmp(step, int64(0))
+	if err != nil {
+		return nil, err
+	}
+	if dir == 0 {
+		return nil, fmt.Errorf("range step must not be zero")
+	}
+	if end != nil {
+		if _, err := num.Cmp(start, end); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := num.Add(start, step); err != nil {
+		return nil, err
+	}
+	return New(func() Iterator {
+		v := start
+		return func() (interface{}, bool, error) {
+			if end != nil {
+				if c, _ := num.Cmp(v, end); c*dir >= 0 {
+					return nil, false, nil
+				}
+			}
+			res := v
+			v, _ = num.Add(v, step)
+			return res, true, nil
+		}
+	}), nil
+}
+
+// Iterate returns the infinite sequence x, f(x), f(f(x)), ...
+func Iterate(f Func, x interface{}) *Seq {
+	return New(func() Iterator {
+		v, started := x, false
+		return func() (interface{}, bool, error) {
+			if started {
+				var err error
+				if v, err = f(v); err != nil {
+					return nil, false, err
+				}
+			}
+			started = true
+			return v, true, nil
+		}
+	})
+}
+
+// Cycle returns the infinite repetition of s, or an empty sequence if s
+// is empty.
+func Cycle(s *Seq) *Seq {
+	return New(func() Iterator {
+		next, empty := s.Iterate(), true
+		return func() (interface{}, bool, error) {
+			v, ok, err := next()
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				empty = false
+				return v, true, nil
+			}
+			if empty {
+				return nil, false, nil
+			}
+			next = s.Iterate()
+			return next()
+		}
+	})
+}
+
+// Map returns the sequence of f applied to the values of seqs at the same
+// index. It ends with the shortest of seqs.
+func Map(f Func, seqs ...*Seq) *Seq {
+	return New(func() Iterator {
+		nexts := make([]Iterator, len(seqs))
+		for i, s := range seqs {
+			nexts[i] = s.Iterate()
+		}
+		return func() (interface{}, bool, error) {
+			args := make([]interface{}, len(nexts))
+			for i, next := range nexts {
+				v, ok, err := next()
+				if err != nil || !ok {
+					return nil, false, err
+				}
+				args[i] = v
+			}
+			v, err := f(args...)
+			if err != nil {
+				return nil, false, err
+			}
+			return v, true, nil
+		}
+	})
+}
+
+// test calls the predicate pred with v.
+func test(pred Func, v interface{}) (bool, error) {
+	r, err := pred(v)
+	if err != nil {
+		return false, err
+	}
+	b, ok := r.(bool)
+	if !ok {
+		return false, fmt.Errorf("callback must return bool")
+	}
+	return b, nil
+}
+
+// Filter returns the values of s for which pred returns true.
+func Filter(pred Func, s *Seq) *Seq {
+	return New(func() Iterator {
+		next := s.Iterate()
+		return func() (interface{}, bool, error) {
+			for {
+				v, ok, err := next()
+				if err != nil || !ok {
+					return nil, false, err
+				}
+				keep, err := test(pred, v)
+				if err != nil {
+					return nil, false, err
+				}
+				if keep {
+					return v, true, nil
+				}
+			}
+		}
+	})
+}
+
+// Take returns the first n values of s.
+func Take(n int, s *Seq) *Seq {
+	return New(func() Iterator {
+		next, i := s.Iterate(), 0
+		return func() (interface{}, bool, error) {
+			if i >= n {
+				return nil, false, nil
+			}
+			i++
+			return next()
+		}
+	})
+}
+
+// Skip returns the values of s after the first n.
+func Skip(n int, s *Seq) *Seq {
+	return New(func() Iterator {
+		next, skipped := s.Iterate(), false
+		return func() (interface{}, bool, error) {
+			if !skipped {
+				skipped = true
+				for i := 0; i < n; i++ {
+					if _, ok, err := next(); err != nil || !ok {
+						return nil, false, err
+					}
+				}
+			}
+			return next()
+		}
+	})
+}
+
+// TakeWhile returns the values of s up to the first one for which pred
+// returns false.
+func TakeWhile(pred Func, s *Seq) *Seq {
+	return New(func() Iterator {
+		next, done := s.Iterate(), false
+		return func() (interface{}, bool, error) {
+			if done {
+				return nil, false, nil
+			}
+			v, ok, err := next()
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			keep, err := test(pred, v)
+			if err != nil {
+				return nil, false, err
+			}
+			if !keep {
+				done = true
+				return nil, false, nil
+			}
+			return v, true, nil
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package lazy_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/stretchr/testify/assert"
+)
+
+func double(args ...interface{}) (interface{}, error) {
+	return 2 * args[0].(int64), nil
+}
+
+func even(args ...interface{}) (interface{}, error) {
+	return args[0].(int64)%2 == 0, nil
+}
+
+func TestRange(t *testing.T) {
+	s, err := lazy.Range(int64(0), int64(5), int64(2))
+	assert.NoError(t, err)
+	l, err := s.Slice()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(2), int64(4)}, l)
+
+	s, _ = lazy.Range(int64(3), int64(0), int64(-1))
+	l, _ = s.Slice()
+	assert.Equal(t, []interface{}{int64(3), int64(2), int64(1)}, l)
+
+	s, _ = lazy.Range(int64(0), nil, 0.5)
+	l, _ = lazy.Take(3, s).Slice()
+	assert.Equal(t, []interface{}{int64(0), 0.5, 1.0}, l)
+
+	_, err = lazy.Range(int64(0), int64(5), int64(0))
+	assert.Error(t, err)
+	_, err = lazy.Range("a", int64(5), int64(1))
+	assert.Error(t, err)
+}
+
+func TestLaziness(t *testing.T) {
+	calls := 0
+	count := func(args ...interface{}) (interface{}, error) {
+		calls++
+		return double(args...)
+	}
+	nat, _ := lazy.Range(int64(0), nil, int64(1))
+	s := lazy.Take(3, lazy.Filter(even, lazy.Map(count, nat)))
+	assert.Equal(t, 0, calls)
+	l, err := s.Slice()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(2), int64(4)}, l)
+	assert.Equal(t, 3, calls)
+
+	v, ok, err := lazy.Skip(10, nat).Nth(5)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(15), v)
+
+	// Sequences can be iterated again, without computing their values again.
+	l, _ = s.Slice()
+	assert.Equal(t, 3, len(l))
+	assert.Equal(t, 3, calls)
+}
+
+func TestConcurrentIteration(t *testing.T) {
+	var calls int64
+	s := lazy.Map(func(args ...interface{}) (interface{}, error) {
+		atomic.AddInt64(&calls, 1)
+		return double(args...)
+	}, lazy.Take(100, lazy.Iterate(func(args ...interface{}) (interface{}, error) {
+		return args[0].(int64) + 1, nil
+	}, int64(0))))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := s.Slice()
+			assert.NoError(t, err)
+			assert.Equal(t, 100, len(l))
+			assert.Equal(t, int64(198), l[99])
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(100), calls)
+}
+
+func TestIterateCycleTakeWhile(t *testing.T) {
+	l, _ := lazy.Take(4, lazy.Iterate(double, int64(1))).Slice()
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(4), int64(8)}, l)
+
+	l, _ = lazy.Take(5, lazy.Cycle(lazy.FromSlice([]interface{}{"a", "b"}))).Slice()
+	assert.Equal(t, []interface{}{"a", "b", "a", "b", "a"}, l)
+	l, _ = lazy.Cycle(lazy.FromSlice(nil)).Slice()
+	assert.Equal(t, []interface{}{}, l)
+
+	l, _ = lazy.TakeWhile(even, lazy.FromSlice([]interface{}{int64(2), int64(4), int64(5), int64(6)})).Slice()
+	assert.Equal(t, []interface{}{int64(2), int64(4)}, l)
+
+	l, _ = lazy.Map(func(args ...interface{}) (interface{}, error) {
+		return args[0].(int64) + args[1].(int64), nil
+	}, lazy.FromSlice([]interface{}{int64(1), int64(2)}), lazy.Iterate(double, int64(1))).Slice()
+	assert.Equal(t, []interface{}{int64(2), int64(4)}, l)
+}
+
+func TestErrors(t *testing.T) {
+	fail := errors.New("fail")
+	s := lazy.Map(func(args ...interface{}) (interface{}, error) {
+		if args[0].(int64) == 2 {
+			return nil, fail
+		}
+		return args[0], nil
+	}, lazy.FromSlice([]interface{}{int64(1), int64(2), int64(3)}))
+	_, err := s.Slice()
+	assert.Equal(t, fail, err)
+	v, ok, err := s.Nth(0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), v)
+
+	_, err = lazy.Filter(double, lazy.FromSlice([]interface{}{int64(1)})).Slice()
+	assert.EqualError(t, err, "callback must return bool")
+}
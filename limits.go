@@ -0,0 +1,289 @@
+package gel
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/utils"
+)
+
+var (
+	// ErrStepLimit is the error used when an evaluation exceeds Limits.MaxSteps.
+	ErrStepLimit = errors.New("step limit exceeded")
+	// ErrDepthLimit is the error used when an evaluation exceeds Limits.MaxDepth.
+	ErrDepthLimit = errors.New("call depth limit exceeded")
+	// ErrAllocLimit is the error used when a collection would exceed Limits.MaxAlloc.
+	ErrAllocLimit = errors.New("allocation limit exceeded")
+)
+
+// Limits restricts the resources an evaluation may use.
+// A zero value means no limit.
+type Limits struct {
+	// MaxSteps is the maximum number of calls and loop iterations.
+	MaxSteps int64
+	// MaxDepth is the maximum depth of nested function calls.
+	MaxDepth int
+	// MaxAlloc is the maximum number of elements in a collection created by
+	// repeat, vec-repeat, repeatedly, range, vec-range, list-rand and vec-rand,
+	// and of values computed by a lazy sequence of lazy-range, iterate or cycle.
+	MaxAlloc int64
+}
+
+// evalState is the state of a single evaluation. It is shared by all
+// scopes created during the evaluation, including those of the goroutines
+// started with go, so its counters are updated atomically. The call depth
+// is counted per goroutine, each goroutine starting at the depth of the
+// call that started it.
+type evalState struct {
+	// mu locks the scopes of the evaluation while goroutines are running.
+	mu         sync.RWMutex
+	goroutines int32
+	// running waits for the goroutines started with go and by the
+	// parallel functions.
+	running sync.WaitGroup
+	// ended is set once the evaluation has returned. Lazy values realized
+	// by the host after that are no longer limited nor cancelled.
+	ended int32
+
+	ctx    context.Context
+	done   <-chan struct{}
+	limits Limits
+	steps  int64
+	// depth is the call depth of the goroutine that started the
+	// evaluation, depths those of the goroutines started during it, by
+	// goroutine id. Without running goroutines only depth is used.
+	depth  int64
+	depths sync.Map
+	debug  bool
+	// workers is the number of goroutines of the parallel functions.
+	workers int
+	// hostNames are the names defined by the Env, which override the
+	// special forms resolved at compile time.
+	hostNames map[string]bool
+}
+
+func newEvalState(ctx context.Context, limits Limits) *evalState {
+	return &evalState{ctx: ctx, done: ctx.Done(), limits: limits}
+}
+
+// spawn accounts for a goroutine started during the evaluation and
+// returns the call depth it starts at. The goroutine must call begin with
+// it before calling gel functions, and exit when it returns.
+func (st *evalState) spawn() int64 {
+	atomic.AddInt32(&st.goroutines, 1)
+	st.running.Add(1)
+	return atomic.LoadInt64(st.depthOf())
+}
+
+// begin gives the calling goroutine a call depth of its own, starting at
+// depth. It returns the goroutine id to be passed to exit.
+func (st *evalState) begin(depth int64) int64 {
+	id := goroutineID()
+	st.depths.Store(id, &depth)
+	return id
+}
+
+func (st *evalState) exit(id int64) {
+	st.depths.Delete(id)
+	atomic.AddInt32(&st.goroutines, -1)
+	st.running.Done()
+}
+
+// depthOf returns the call depth of the calling goroutine.
+func (st *evalState) depthOf() *int64 {
+	if atomic.LoadInt32(&st.goroutines) > 0 {
+		if depth, ok := st.depths.Load(goroutineID()); ok {
+			return depth.(*int64)
+		}
+	}
+	return &st.depth
+}
+
+// goroutineID returns the id of the calling goroutine, read from the
+// header of its stack trace.
+func goroutineID() int64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// wait waits for the goroutines started during the evaluation to return.
+func (st *evalState) wait() {
+	st.running.Wait()
+}
+
+// end detaches the state from its limits and context once the evaluation
+// has returned and its goroutines are done.
+func (st *evalState) end() {
+	atomic.StoreInt32(&st.ended, 1)
+}
+
+// step accounts for one evaluation step and checks for cancellation.
+func (st *evalState) step() error {
+	if atomic.LoadInt32(&st.ended) != 0 {
+		return nil
+	}
+	steps := atomic.AddInt64(&st.steps, 1)
+	if st.limits.MaxSteps > 0 && steps > st.limits.MaxSteps {
+		return ErrStepLimit
+	}
+	if st.done != nil {
+		select {
+		case <-st.done:
+			return st.ctx.Err()
+		default:
+		}
+	}
+	return nil
+}
+
+// enter accounts for a function call in the call depth of the calling
+// goroutine. It returns that depth, to be passed to leave when the call
+// returns.
+func (st *evalState) enter() (*int64, error) {
+	d := st.depthOf()
+	depth := atomic.AddInt64(d, 1)
+	if st.limits.MaxDepth > 0 && depth > int64(st.limits.MaxDepth) {
+		atomic.AddInt64(d, -1)
+		return nil, ErrDepthLimit
+	}
+	return d, nil
+}
+
+func (st *evalState) leave(d *int64) {
+	atomic.AddInt64(d, -1)
+}
+
+// guard returns seq checking st for every value it computes, so that the
+// values count as steps and towards Limits.MaxAlloc, and are not computed
+// once the evaluation is cancelled.
+func (st *evalState) guard(seq *lazy.Seq) *lazy.Seq {
+	return lazy.New(func() lazy.Iterator {
+		next, n := seq.Iterate(), int64(0)
+		return func() (interface{}, bool, error) {
+			if err := st.step(); err != nil {
+				return nil, false, err
+			}
+			v, ok, err := next()
+			if ok {
+				n++
+				if st.limits.MaxAlloc > 0 && n > st.limits.MaxAlloc && atomic.LoadInt32(&st.ended) == 0 {
+					return nil, false, ErrAllocLimit
+				}
+			}
+			return v, ok, err
+		}
+	})
+}
+
+func (s *Scope) step() error {
+	if s.state == nil {
+		return nil
+	}
+	return s.state.step()
+}
+
+// allocSizes computes the number of elements the allocating builtins
+// create from their arguments.
+var allocSizes = map[string]func(args []interface{}) float64{
+	"repeat":     countSize,
+	"vec-repeat": countSize,
+	"repeatedly": countSize,
+	"list-rand":  countSize,
+	"vec-rand":   countSize,
+	"range":      rangeSize,
+	"vec-range":  rangeSize,
+}
+
+func countSize(args []interface{}) float64 {
+	if len(args) == 0 {
+		return 0
+	}
+	n, _ := num.ToFloat64(args[0])
+	return n
+}
+
+func rangeSize(args []interface{}) float64 {
+	if len(args) != 3 {
+		return 0
+	}
+	var v [3]float64
+	for i, arg := range args {
+		f, ok := num.ToFloat64(arg)
+		if !ok {
+			return 0
+		}
+		v[i] = f
+	}
+	start, end, step := v[0], v[1], v[2]
+	if step == 0 || (end-start)/step < 0 {
+		return 0
+	}
+	return math.Ceil((end - start) / step)
+}
+
+// limitScope shadows the builtins of s that the limits of its evaluation
+// state apply to. It is called for every scope with its own builtins: the
+// scope of an evaluation and those of eval and require.
+func limitScope(s *Scope) {
+	if s.state == nil {
+		return
+	}
+	if s.state.limits.MaxAlloc > 0 {
+		limitAllocs(s, s.state.limits.MaxAlloc)
+	}
+	guardSeqs(s)
+}
+
+// limitAllocs shadows the allocating builtins in s with versions that
+// fail with ErrAllocLimit instead of creating more than max elements.
+func limitAllocs(s *Scope, max int64) {
+	for name, size := range allocSizes {
+		fn, err := s.Get(name)
+		if err != nil {
+			continue
+		}
+		size := size
+		s.SetOrCreate(name, func(args ...interface{}) (interface{}, error) {
+			if size(args) > float64(max) {
+				return nil, ErrAllocLimit
+			}
+			return utils.Call(fn, args...)
+		})
+	}
+}
+
+// lazySources are the builtins creating lazy sequences that compute their
+// values by themselves rather than from another sequence.
+var lazySources = []string{"lazy-range", "iterate", "cycle"}
+
+// guardSeqs shadows the lazy sources in s with versions whose sequences are
+// guarded by the evaluation state of s.
+func guardSeqs(s *Scope) {
+	st := s.state
+	for _, name := range lazySources {
+		fn, err := s.Get(name)
+		if err != nil {
+			continue
+		}
+		s.SetOrCreate(name, func(args ...interface{}) (interface{}, error) {
+			v, err := utils.Call(fn, args...)
+			if seq, ok := v.(*lazy.Seq); ok && err == nil {
+				return st.guard(seq), nil
+			}
+			return v, err
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package gel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel"
+	"github.com/Stromberg/gel/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsSteps(t *testing.T) {
+	g, err := gel.New("(var x 0)\n(while true (set x (inc x)))")
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxSteps: 1000})
+
+	_, err = g.Eval(gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, gel.ErrStepLimit, e.Err)
+	assert.Equal(t, 2, e.PosInfo.Line)
+}
+
+func TestLimitsDepth(t *testing.T) {
+	g, err := gel.New("(func f [n] (f (inc n))) (f 0)")
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxDepth: 100})
+
+	_, err = g.Eval(gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, gel.ErrDepthLimit, e.Err)
+	assert.EqualError(t, err, "twik source:1:14: call depth limit exceeded")
+
+	g, err = gel.New("(var f (# (%1 %1))) (f f)")
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxDepth: 100})
+	_, err = g.Eval(gel.NewEnv())
+	e, ok = err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, gel.ErrDepthLimit, e.Err)
+
+	g, err = gel.New("(func f [n] (if (== n 0) 0 (f (dec n)))) (f 99)")
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxDepth: 100})
+	r, err := g.Eval(gel.NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), r)
+}
+
+func TestLimitsAlloc(t *testing.T) {
+	test := func(expr string, ok bool) {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		g.SetLimits(gel.Limits{MaxAlloc: 100})
+		_, err = g.Eval(gel.NewEnv())
+		if ok {
+			assert.NoError(t, err, expr)
+			return
+		}
+		e, isErr := err.(*gel.Error)
+		assert.True(t, isErr, expr)
+		if isErr {
+			assert.Equal(t, gel.ErrAllocLimit, e.Err, expr)
+		}
+	}
+
+	test("(repeat 100 1)", true)
+	test("(repeat 101 1)", false)
+	test("(vec-repeat 1000000000000 1.0)", false)
+	test("(range 0 100 1)", true)
+	test("(range 0 1000 1)", false)
+	test("(vec-range 0.0 10.0 0.01)", false)
+	test("(range 0 1000M 1M)", false)
+	test("(repeat 100000000000000000000 1)", false)
+	test("(map (# (repeat %1 0)) [1 2 1000])", false)
+}
+
+func TestEvalContext(t *testing.T) {
+	g, err := gel.New("(while true 1)")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = g.EvalContext(ctx, gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, context.DeadlineExceeded, e.Err)
+}
+
+func TestLimitsEval(t *testing.T) {
+	evalErr := func(expr string, limits gel.Limits, timeout time.Duration) error {
+		g, err := gel.New(expr)
+		assert.NoError(t, err, expr)
+		g.SetLimits(limits)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err = g.EvalContext(ctx, gel.NewEnv())
+		e, ok := err.(*gel.Error)
+		assert.True(t, ok, expr)
+		if !ok {
+			return err
+		}
+		return e.Err
+	}
+
+	for _, expr := range []string{`(eval "(while true 1)")`, `(eval '(while true 1))`} {
+		assert.Equal(t, gel.ErrStepLimit, evalErr(expr, gel.Limits{MaxSteps: 1000}, 5*time.Second), expr)
+		assert.Equal(t, context.DeadlineExceeded, evalErr(expr, gel.Limits{}, 10*time.Millisecond), expr)
+	}
+	assert.Equal(t, gel.ErrDepthLimit, evalErr(`(eval "(func f [] (f)) (f)")`, gel.Limits{MaxDepth: 100}, 5*time.Second))
+	assert.Equal(t, gel.ErrDepthLimit, evalErr(`(defmacro m [] '(m)) (m)`, gel.Limits{MaxDepth: 100}, 5*time.Second))
+	assert.Equal(t, gel.ErrDepthLimit, evalErr(`(defmacro m [] '(m)) (func f [] (m)) (f)`, gel.Limits{MaxDepth: 100}, 5*time.Second))
+	assert.Equal(t, gel.ErrAllocLimit, evalErr(`(eval "(len (range 0 100000000 1))")`, gel.Limits{MaxAlloc: 1000}, 5*time.Second))
+	assert.Equal(t, gel.ErrAllocLimit, evalErr(`(eval '(len (repeat 100000000 1)))`, gel.Limits{MaxAlloc: 1000}, 5*time.Second))
+}
+
+func TestLimitsRequire(t *testing.T) {
+	defer withFiles(t, map[string]string{
+		"ones.gel":  `(var ones (repeat 100000000 1))`,
+		"big.gel":   `(ns big) (func size [] (len (range 0 100000000 1)))`,
+		"count.gel": `(ns count) (func total [] (reduce + (take 5000 (iterate inc 0))))`,
+	})()
+
+	for _, expr := range []string{`(require "ones.gel")`, `(require "big.gel") (big/size)`, `(require "count.gel") (count/total)`} {
+		g, err := gel.New(expr)
+		assert.NoError(t, err, expr)
+		g.SetLimits(gel.Limits{MaxAlloc: 1000})
+		_, err = g.Eval(gel.NewEnv())
+		e, ok := err.(*gel.Error)
+		assert.True(t, ok, expr)
+		if ok {
+			assert.Equal(t, gel.ErrAllocLimit, e.Err, expr)
+		}
+	}
+}
+
+func TestLimitsLazy(t *testing.T) {
+	evalErr := func(expr string, limits gel.Limits, timeout time.Duration) error {
+		g, err := gel.New(expr)
+		assert.NoError(t, err, expr)
+		g.SetLimits(limits)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, err = g.EvalContext(ctx, gel.NewEnv())
+		e, ok := err.(*gel.Error)
+		assert.True(t, ok, expr)
+		if !ok {
+			return err
+		}
+		return e.Err
+	}
+
+	expr := `(len (realize (take 100000000 (lazy-range))))`
+	assert.Equal(t, gel.ErrAllocLimit, evalErr(expr, gel.Limits{MaxAlloc: 1000}, 5*time.Second))
+	assert.Equal(t, gel.ErrStepLimit, evalErr(expr, gel.Limits{MaxSteps: 1000}, 5*time.Second))
+	assert.Equal(t, context.DeadlineExceeded, evalErr(`(len (cycle [1]))`, gel.Limits{}, 10*time.Millisecond))
+	assert.Equal(t, gel.ErrAllocLimit, evalErr(`(eval '(reduce + (take 5000 (iterate inc 0))))`, gel.Limits{MaxAlloc: 1000}, 5*time.Second))
+
+	g, err := gel.New(`(len (realize (take 1000 (lazy-range))))`)
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxAlloc: 1000})
+	r, err := g.Eval(gel.NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), r)
+}
+
+func TestLazyResult(t *testing.T) {
+	for _, test := range []struct {
+		expr  string
+		value []interface{}
+	}{
+		{`(lazy-range 0 3)`, []interface{}{int64(0), int64(1), int64(2)}},
+		{`(map inc (lazy-range 0 3))`, []interface{}{int64(1), int64(2), int64(3)}},
+		{`(map (fn [x] (* x 2)) (lazy-range 0 3))`, []interface{}{int64(0), int64(2), int64(4)}},
+		{`(take 2 (cycle [1 2]))`, []interface{}{int64(1), int64(2)}},
+	} {
+		g, err := gel.New(test.expr)
+		assert.NoError(t, err, test.expr)
+		g.SetLimits(gel.Limits{MaxSteps: 1000, MaxAlloc: 1000})
+		r, err := g.Eval(gel.NewEnv())
+		assert.NoError(t, err, test.expr)
+		list, err := utils.ToList(r)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.value, list, test.expr)
+	}
+
+	g, err := gel.New(`(map str (lazy-range 0 3))`)
+	assert.NoError(t, err)
+	var names []string
+	assert.NoError(t, g.EvalInto(gel.NewEnv(), &names))
+	assert.Equal(t, []string{"0", "1", "2"}, names)
+}
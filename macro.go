@@ -0,0 +1,450 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/persistent"
+	"github.com/Stromberg/gel/utils"
+)
+
+// Symbol is a symbol used as a value. Quoting code turns the symbols
+// in it into Symbols, so that code can be handled as data.
+type Symbol string
+
+// Macro transforms code. It is called with the unevaluated arguments
+// of a call as data and returns the code that replaces the call.
+type Macro struct {
+	Name string
+	Fn   func(args ...interface{}) (interface{}, error)
+}
+
+// valueNode holds a value that has no literal syntax. It is created when
+// the data returned by a macro is turned back into code.
+type valueNode struct {
+	pos   ast.Pos
+	value interface{}
+}
+
+func (n *valueNode) Pos() ast.Pos { return n.pos }
+func (n *valueNode) End() ast.Pos { return n.pos }
+
+// nodeToData converts parsed code into data. Symbols become Symbols,
+// literals their values, calls []interface{}, list literals
+// *persistent.Vector, dictionaries *persistent.Map and sets
+// *persistent.Set, like the values of the literals.
+func nodeToData(node ast.Node) (interface{}, error) {
+	switch node := node.(type) {
+	case *ast.Symbol:
+		return Symbol(node.Name), nil
+	case *ast.Int:
+		return node.Value, nil
+	case *ast.BigInt:
+		return node.Value, nil
+	case *ast.Float:
+		return node.Value, nil
+	case *ast.Decimal:
+		return node.Value, nil
+	case *ast.String:
+		return node.Value, nil
+	case *ast.Keyword:
+		return Keyword(node.Name), nil
+	case *ast.List:
+		return nodesToData(node.Nodes)
+	case *ast.ListList:
+		list, err := nodesToData(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		return persistent.NewVector(list...), nil
+	case *ast.DictList:
+		list, err := nodesToData(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		return persistent.NewMap(list...)
+	case *ast.SetList:
+		list, err := nodesToData(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		return persistent.NewSet(list...)
+	case *valueNode:
+		return node.value, nil
+	}
+	return nil, fmt.Errorf("cannot quote %#v", node)
+}
+
+func nodesToData(nodes []ast.Node) ([]interface{}, error) {
+	res := make([]interface{}, len(nodes))
+	for i, node := range nodes {
+		v, err := nodeToData(node)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = v
+	}
+	return res, nil
+}
+
+// dataToNode converts data back into code placed at pos.
+// Lists become calls and persistent vectors list literals, so that quoted
+// code keeps its [a b] and (a b) apart. Dicts become dict literals.
+func dataToNode(v interface{}, pos ast.Pos) ast.Node {
+	switch v := v.(type) {
+	case Symbol:
+		return &ast.Symbol{Name: string(v), NamePos: pos}
+	case int64:
+		return &ast.Int{Input: strconv.FormatInt(v, 10), InputPos: pos, Value: v}
+	case float64:
+		return &ast.Float{Input: strconv.FormatFloat(v, 'g', -1, 64), InputPos: pos, Value: v}
+	case num.Decimal:
+		return &ast.Decimal{Input: v.String() + "M", InputPos: pos, Value: v}
+	case string:
+		return &ast.String{Input: strconv.Quote(v), InputPos: pos, Value: v}
+	case Keyword:
+		return &ast.Keyword{Input: ":" + string(v), InputPos: pos, Name: string(v)}
+	case []interface{}:
+		if len(v) == 0 {
+			return &valueNode{pos: pos, value: emptyList}
+		}
+		return &ast.List{LParens: pos, RParens: pos, Nodes: dataToNodes(v, pos)}
+	case *persistent.Vector:
+		return &ast.ListList{LParens: pos, RParens: pos, Nodes: dataToNodes(v.Slice(), pos)}
+	case map[interface{}]interface{}:
+		return dictToNode(v, pos)
+	case *persistent.Map:
+		return dictToNode(v.ToMap(), pos)
+	}
+	return &valueNode{pos: pos, value: v}
+}
+
+func dataToNodes(vs []interface{}, pos ast.Pos) []ast.Node {
+	nodes := make([]ast.Node, len(vs))
+	for i, v := range vs {
+		nodes[i] = dataToNode(v, pos)
+	}
+	return nodes
+}
+
+// dictToNode returns the dict literal of d, with the keys sorted so that
+// the same dict always turns into the same code.
+func dictToNode(d map[interface{}]interface{}, pos ast.Pos) ast.Node {
+	keys := make([]interface{}, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	nodes := make([]ast.Node, 0, 2*len(d))
+	for _, k := range keys {
+		nodes = append(nodes, dataToNode(k, pos), dataToNode(d[k], pos))
+	}
+	return &ast.DictList{LParens: pos, RParens: pos, Nodes: nodes}
+}
+
+// expand calls m with args as data and returns the resulting code.
+func (m *Macro) expand(node *ast.List) (ast.Node, error) {
+	args, err := nodesToData(node.Nodes[1:])
+	if err != nil {
+		return nil, err
+	}
+	v, err := m.Fn(args...)
+	if err != nil {
+		return nil, err
+	}
+	return dataToNode(v, node.Pos()), nil
+}
+
+// compileMacro compiles a call to a macro known at compile time. Nested
+// expansions count towards Limits.MaxDepth like nested calls.
+func (c *compiler) compileMacro(node *ast.List, m *Macro) code {
+	expanded, err := m.expand(node)
+	if err == nil && c.scope != nil && c.scope.state != nil {
+		var d *int64
+		if d, err = c.scope.state.enter(); err == nil {
+			defer c.scope.state.leave(d)
+		}
+	}
+	if err != nil {
+		err = c.errorAt(node.Nodes[0], err)
+		return func(s *Scope) (interface{}, error) {
+			return nil, err
+		}
+	}
+	return c.compile(expanded)
+}
+
+// expansion caches the code a call site expanded to at runtime.
+type expansion struct {
+	macro *Macro
+	code  code
+}
+
+// expandAt expands a call to a macro that was not known at compile time
+// and evaluates the result in s. The expansion is compiled once for each
+// macro seen at the call site.
+func (c *compiler) expandAt(s *Scope, node *ast.List, m *Macro, cache *atomic.Value) (interface{}, error) {
+	if st := s.state; st != nil {
+		d, err := st.enter()
+		if err != nil {
+			return nil, err
+		}
+		defer st.leave(d)
+	}
+	e, _ := cache.Load().(*expansion)
+	if e == nil || e.macro != m {
+		expanded, err := m.expand(node)
+		if err != nil {
+			return nil, err
+		}
+		e = &expansion{m, newCompiler(c.fset, s).compile(expanded)}
+		cache.Store(e)
+	}
+	return e.code(s)
+}
+
+func quoteFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 1 {
+		return nil, errors.New("quote takes one argument")
+	}
+	v, err := nodeToData(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return constant(v), nil
+}
+
+func quasiquoteFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 1 {
+		return nil, errors.New("quasiquote takes one argument")
+	}
+	return c.quasiquote(args[0])
+}
+
+// unquoted returns the argument of node if it is a (name arg) form.
+func unquoted(node ast.Node, name string) (ast.Node, bool, error) {
+	list, ok := node.(*ast.List)
+	if !ok || len(list.Nodes) == 0 {
+		return nil, false, nil
+	}
+	if symbol, ok := list.Nodes[0].(*ast.Symbol); !ok || symbol.Name != name {
+		return nil, false, nil
+	}
+	if len(list.Nodes) != 2 {
+		return nil, false, fmt.Errorf("%s takes one argument", name)
+	}
+	return list.Nodes[1], true, nil
+}
+
+func (c *compiler) quasiquote(node ast.Node) (code, error) {
+	arg, ok, err := unquoted(node, "unquote")
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return c.compile(arg), nil
+	}
+
+	switch node := node.(type) {
+	case *ast.List:
+		return c.quasiquoteList(node.Nodes)
+	case *ast.ListList:
+		list, err := c.quasiquoteList(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Scope) (interface{}, error) {
+			v, err := list(s)
+			if err != nil {
+				return nil, err
+			}
+			return persistent.NewVector(v.([]interface{})...), nil
+		}, nil
+	case *ast.DictList:
+		list, err := c.quasiquoteList(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Scope) (interface{}, error) {
+			v, err := list(s)
+			if err != nil {
+				return nil, err
+			}
+			return persistent.NewMap(v.([]interface{})...)
+		}, nil
+	case *ast.SetList:
+		list, err := c.quasiquoteList(node.Nodes)
+		if err != nil {
+			return nil, err
+		}
+		return func(s *Scope) (interface{}, error) {
+			v, err := list(s)
+			if err != nil {
+				return nil, err
+			}
+			return persistent.NewSet(v.([]interface{})...)
+		}, nil
+	}
+
+	v, err := nodeToData(node)
+	if err != nil {
+		return nil, err
+	}
+	return constant(v), nil
+}
+
+func (c *compiler) quasiquoteList(nodes []ast.Node) (code, error) {
+	codes := make([]code, len(nodes))
+	splice := make([]bool, len(nodes))
+	for i, node := range nodes {
+		arg, ok, err := unquoted(node, "unquote-splicing")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			codes[i], splice[i] = c.compile(arg), true
+			continue
+		}
+		if codes[i], err = c.quasiquote(node); err != nil {
+			return nil, err
+		}
+	}
+	return func(s *Scope) (interface{}, error) {
+		res := make([]interface{}, 0, len(codes))
+		for i, code := range codes {
+			v, err := code(s)
+			if err != nil {
+				return nil, err
+			}
+			if !splice[i] {
+				res = append(res, v)
+				continue
+			}
+			if v == nil {
+				continue
+			}
+			list, err := utils.ToList(v)
+			if err == utils.ErrParameterType {
+				return nil, errors.New("unquote-splicing requires a list")
+			} else if err != nil {
+				return nil, err
+			}
+			res = append(res, list...)
+		}
+		return res, nil
+	}, nil
+}
+
+func unquoteFn(c *compiler, args []ast.Node) (code, error) {
+	return nil, errors.New("unquote outside of quasiquote")
+}
+
+func unquoteSplicingFn(c *compiler, args []ast.Node) (code, error) {
+	return nil, errors.New("unquote-splicing outside of quasiquote")
+}
+
+func defmacroFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) < 3 {
+		return nil, errors.New("defmacro takes a name, a list of parameters and a body")
+	}
+	symbol, ok := args[0].(*ast.Symbol)
+	if !ok {
+		return nil, errors.New("defmacro takes a symbol as first argument")
+	}
+	name := symbol.Name
+	c.declare(name)
+	makeFn, err := c.compileFunc(name, args[1], args[2:])
+	if err != nil {
+		return nil, err
+	}
+
+	return func(scope *Scope) (interface{}, error) {
+		m := &Macro{Name: name, Fn: makeFn(scope)}
+		if err := scope.Create(name, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}, nil
+}
+
+// macroexpand1 expands form once if it is a call to a macro visible in scope.
+func macroexpand1(scope *Scope, form interface{}) (interface{}, bool, error) {
+	list, ok := form.([]interface{})
+	if !ok || len(list) == 0 {
+		return form, false, nil
+	}
+	symbol, ok := list[0].(Symbol)
+	if !ok {
+		return form, false, nil
+	}
+	v, err := scope.Get(string(symbol))
+	if err != nil {
+		return form, false, nil
+	}
+	m, ok := v.(*Macro)
+	if !ok {
+		return form, false, nil
+	}
+	form, err = m.Fn(list[1:]...)
+	return form, true, err
+}
+
+func macroexpand1Fn(scope *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	form, _, err := macroexpand1(scope, args[0])
+	return form, err
+}
+
+func macroexpandFn(scope *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	form := args[0]
+	for {
+		var expanded bool
+		var err error
+		form, expanded, err = macroexpand1(scope, form)
+		if err != nil || !expanded {
+			return form, err
+		}
+	}
+}
+
+var gensymCounter int64
+
+var symbolFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return Symbol(name), nil
+}, utils.CheckArity(1))
+
+var isSymbolFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(Symbol)
+	return ok
+}, utils.CheckArity(1))
+
+func gensymFn(args ...interface{}) (interface{}, error) {
+	prefix := "G"
+	if len(args) > 1 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	if len(args) == 1 {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		prefix = s
+	}
+	return Symbol(fmt.Sprintf("%s__%d", prefix, atomic.AddInt64(&gensymCounter, 1))), nil
+}
@@ -1,6 +1,10 @@
 package module
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/Stromberg/gel/utils"
+)
 
 // Func is a description of a Module function.
 type Func struct {
@@ -10,6 +14,18 @@ type Func struct {
 	F           interface{}
 }
 
+// NewFunc creates a Func from any Go function, like Env.AddFunc. The
+// signature is derived from the parameter types of fn.
+// It panics if fn is not a function.
+func NewFunc(name, description string, fn interface{}) *Func {
+	return &Func{
+		Name:        name,
+		Signature:   utils.GoFuncSignature(name, fn),
+		Description: description,
+		F:           utils.GoFunc(name, fn),
+	}
+}
+
 // LispFunc is a description of a Module function in lisp.
 type LispFunc struct {
 	Name        string
@@ -2,22 +2,86 @@ package module
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/ryanuber/go-glob"
 )
 
-var registeredModules = []*Module{}
+// Repo is a set of modules that can be loaded by an interpreter.
+// It is safe for concurrent use.
+type Repo struct {
+	mu      sync.RWMutex
+	modules []*Module
+	version int
+
+	preludeMu      sync.Mutex
+	prelude        interface{}
+	preludeVersion int
+}
+
+// DefaultRepo is the Repo modules are added to by RegisterModules.
+// It is used by interpreters that are not given a Repo of their own.
+var DefaultRepo = NewRepo()
 
 var BasePath = "."
 
-// Modules returns all registered modules
-func Modules() (res []*Module) {
-	return registeredModules
+// NewRepo creates a new Repo with the given modules.
+func NewRepo(modules ...*Module) *Repo {
+	r := &Repo{}
+	r.Register(modules...)
+	return r
 }
 
-// FindModule finds the registered Module with the given name.
-func FindModule(name string) *Module {
-	for _, m := range registeredModules {
+// Clone creates a copy of the Repo. Modules registered in the
+// copy are not visible in r and vice versa.
+func (r *Repo) Clone() *Repo {
+	return NewRepo(r.Modules()...)
+}
+
+// Register adds modules to the Repo.
+func (r *Repo) Register(modules ...*Module) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.modules = append(r.modules, modules...)
+	r.version++
+}
+
+// Modules returns all modules in the Repo.
+func (r *Repo) Modules() []*Module {
+	modules, _ := r.snapshot()
+	return modules
+}
+
+// snapshot returns the modules of r and the number of times modules have
+// been registered in r.
+func (r *Repo) snapshot() ([]*Module, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.modules[:len(r.modules):len(r.modules)], r.version
+}
+
+// Prelude returns the value built by build from the modules of r, the
+// initialized global scope of an interpreter. The value is kept in r and
+// built again only once modules have been registered since it was built.
+func (r *Repo) Prelude(build func(modules []*Module) (interface{}, error)) (interface{}, error) {
+	r.preludeMu.Lock()
+	defer r.preludeMu.Unlock()
+
+	modules, version := r.snapshot()
+	if r.prelude != nil && r.preludeVersion == version {
+		return r.prelude, nil
+	}
+	prelude, err := build(modules)
+	if err != nil {
+		return nil, err
+	}
+	r.prelude, r.preludeVersion = prelude, version
+	return prelude, nil
+}
+
+// FindModule finds the Module with the given name.
+func (r *Repo) FindModule(name string) *Module {
+	for _, m := range r.Modules() {
 		if m.Name == name {
 			return m
 		}
@@ -26,17 +90,23 @@ func FindModule(name string) *Module {
 	return nil
 }
 
-// RegisterModules registers a new Module.
-func RegisterModules(modules ...*Module) {
-	for _, m := range modules {
-		registeredModules = append(registeredModules, m)
+// Select creates a new Repo with the named modules of r.
+func (r *Repo) Select(names ...string) (*Repo, error) {
+	res := NewRepo()
+	for _, name := range names {
+		m := r.FindModule(name)
+		if m == nil {
+			return nil, fmt.Errorf("module not found: %s", name)
+		}
+		res.Register(m)
 	}
+	return res, nil
 }
 
-func AllFunctionNames() []string {
+func (r *Repo) AllFunctionNames() []string {
 	res := []string{}
 
-	for _, m := range registeredModules {
+	for _, m := range r.Modules() {
 		for _, f := range m.Funcs {
 			res = append(res, f.Name)
 		}
@@ -48,8 +118,8 @@ func AllFunctionNames() []string {
 	return res
 }
 
-func MatchingFuncNames(expr string) []string {
-	funcs := AllFunctionNames()
+func (r *Repo) MatchingFuncNames(expr string) []string {
+	funcs := r.AllFunctionNames()
 
 	res := []string{}
 	for _, f := range funcs {
@@ -61,8 +131,8 @@ func MatchingFuncNames(expr string) []string {
 	return res
 }
 
-func FunctionRepr(name string) string {
-	for _, m := range registeredModules {
+func (r *Repo) FunctionRepr(name string) string {
+	for _, m := range r.Modules() {
 		for _, f := range m.Funcs {
 			if f.Name == name {
 				return f.Repr()
@@ -77,3 +147,30 @@ func FunctionRepr(name string) string {
 
 	return fmt.Sprintf("Function \"%v\" not found", name)
 }
+
+// Modules returns all registered modules
+func Modules() (res []*Module) {
+	return DefaultRepo.Modules()
+}
+
+// FindModule finds the registered Module with the given name.
+func FindModule(name string) *Module {
+	return DefaultRepo.FindModule(name)
+}
+
+// RegisterModules registers a new Module.
+func RegisterModules(modules ...*Module) {
+	DefaultRepo.Register(modules...)
+}
+
+func AllFunctionNames() []string {
+	return DefaultRepo.AllFunctionNames()
+}
+
+func MatchingFuncNames(expr string) []string {
+	return DefaultRepo.MatchingFuncNames(expr)
+}
+
+func FunctionRepr(name string) string {
+	return DefaultRepo.FunctionRepr(name)
+}
@@ -1,6 +1,8 @@
 package gel
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/Stromberg/gel/module"
@@ -21,3 +23,128 @@ func TestFunctionRepr(t *testing.T) {
 	repr := module.FunctionRepr("sort-asc")
 	assert.NotNil(t, repr)
 }
+
+func TestRepoSelect(t *testing.T) {
+	repo, err := module.DefaultRepo.Select("globals", "f64s")
+	assert.NoError(t, err)
+
+	g, err := NewWithRepo(`(f64s/Sum (vec 1 2))`, repo)
+	assert.NoError(t, err)
+	r, err := g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, r)
+
+	g, err = NewWithRepo(`(slurp "test.gel")`, repo)
+	assert.NoError(t, err)
+	_, err = g.Eval(NewEnv())
+	assert.EqualError(t, err, "twik source:1:2: undefined symbol: slurp")
+
+	_, err = module.DefaultRepo.Select("globals", "nonexistent")
+	assert.EqualError(t, err, "module not found: nonexistent")
+}
+
+func TestRepoClone(t *testing.T) {
+	repo := module.DefaultRepo.Clone()
+	repo.Register(&module.Module{
+		Name: "throwaway",
+		Funcs: []*module.Func{
+			&module.Func{Name: "answer", F: 42,
+				Signature:   "answer",
+				Description: "The answer.",
+			},
+		},
+		LispFuncs: []*module.LispFunc{
+			&module.LispFunc{Name: "answer?", F: "(func [x] (== x answer))"},
+		},
+	})
+
+	g, err := NewWithRepo(`(answer? answer)`, repo)
+	assert.NoError(t, err)
+	r, err := g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, true, r)
+
+	g, err = NewWithRepo(`(docs "answer")`, repo)
+	assert.NoError(t, err)
+	r, err = g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, "answer\nanswer\nThe answer.", r)
+
+	g, err = New(`answer`)
+	assert.NoError(t, err)
+	_, err = g.Eval(NewEnv())
+	assert.Error(t, err)
+	assert.Nil(t, module.FindModule("throwaway"))
+
+	env := NewEnv()
+	env.SetRepo(repo)
+	r, err = g.Eval(env)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, r)
+}
+
+func TestRepoRegisterConcurrent(t *testing.T) {
+	repo, err := module.DefaultRepo.Select("globals")
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			repo.Register(&module.Module{
+				Name:  fmt.Sprintf("m%d", i),
+				Funcs: []*module.Func{&module.Func{Name: fmt.Sprintf("v%d", i), F: int64(i)}},
+			})
+		}(i)
+		go func() {
+			defer wg.Done()
+			g, err := NewWithRepo(`(+ 1 2)`, repo)
+			assert.NoError(t, err)
+			r, err := g.Eval(NewEnv())
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), r)
+			assert.NotContains(t, repo.FunctionRepr("+"), "not found")
+		}()
+	}
+	wg.Wait()
+
+	g, err := NewWithRepo(`(+ v0 v7)`, repo)
+	assert.NoError(t, err)
+	r, err := g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), r)
+
+	p1, err := preludeScope(repo)
+	assert.NoError(t, err)
+	p2, err := preludeScope(repo)
+	assert.NoError(t, err)
+	assert.True(t, p1 == p2)
+}
+
+func TestNewFunc(t *testing.T) {
+	f := module.NewFunc("clamp", "Clamps x between lo and hi.", func(x, lo, hi float64) float64 {
+		if x < lo {
+			return lo
+		}
+		if x > hi {
+			return hi
+		}
+		return x
+	})
+	assert.Equal(t, "(clamp float float float)", f.Signature)
+	assert.Equal(t, "(sum-all int list...)", module.NewFunc("sum-all", "", func(n int, xs ...[]float64) int { return n }).Signature)
+
+	repo := module.DefaultRepo.Clone()
+	repo.Register(&module.Module{Name: "typed", Funcs: []*module.Func{f}})
+	g, err := NewWithRepo(`[(clamp 5 0 1) (clamp -1 0 1)]`, repo)
+	assert.NoError(t, err)
+	r, err := g.Eval(NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1.0, 0.0}, r)
+
+	g, err = NewWithRepo(`(clamp "a" 0 1)`, repo)
+	assert.NoError(t, err)
+	_, err = g.Eval(NewEnv())
+	assert.EqualError(t, err, "twik source:1:2: argument 1 of clamp: expected float, got string")
+}
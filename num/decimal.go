@@ -0,0 +1,208 @@
+package num
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// DivScale is the minimum number of decimals kept when dividing decimals
+// whose quotient has no exact decimal representation.
+var DivScale int32 = 16
+
+// ErrDivisionByZero is returned when dividing exact numbers by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// Decimal is an exact decimal number, unscaled * 10^-scale.
+// The zero value is 0.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+var (
+	bigZero = big.NewInt(0)
+	bigOne  = big.NewInt(1)
+	bigTen  = big.NewInt(10)
+)
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+// NewDecimal returns unscaled * 10^-scale.
+func NewDecimal(unscaled *big.Int, scale int32) Decimal {
+	return Decimal{unscaled: new(big.Int).Set(unscaled), scale: scale}
+}
+
+// DecimalFromInt returns i as a decimal.
+func DecimalFromInt(i int64) Decimal {
+	return Decimal{unscaled: big.NewInt(i)}
+}
+
+// DecimalFromRat returns r as a decimal, rounded to DivScale decimals if
+// it has no exact decimal representation.
+func DecimalFromRat(r *big.Rat) Decimal {
+	d, _ := Decimal{unscaled: r.Num()}.Div(Decimal{unscaled: r.Denom()})
+	return d
+}
+
+// ParseDecimal parses a decimal like -12.50.
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.TrimPrefix(s, "-")
+	digits = strings.TrimPrefix(digits, "+")
+	intPart, frac := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intPart, frac = digits[:i], digits[i+1:]
+	}
+	if intPart+frac == "" {
+		return Decimal{}, errors.New("invalid decimal: " + s)
+	}
+	for _, c := range intPart + frac {
+		if c < '0' || c > '9' {
+			return Decimal{}, errors.New("invalid decimal: " + s)
+		}
+	}
+	unscaled, _ := new(big.Int).SetString(intPart+frac, 10)
+	if strings.HasPrefix(s, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return Decimal{unscaled: unscaled, scale: int32(len(frac))}, nil
+}
+
+func (d Decimal) coef() *big.Int {
+	if d.unscaled == nil {
+		return bigZero
+	}
+	return d.unscaled
+}
+
+// Scale returns the number of decimals of d.
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+// Sign returns -1, 0 or 1 depending on the sign of d.
+func (d Decimal) Sign() int {
+	return d.coef().Sign()
+}
+
+// rescale returns the coefficient of d with scale decimals, scale >= d.scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	if scale == d.scale {
+		return d.coef()
+	}
+	return new(big.Int).Mul(d.coef(), pow10(scale-d.scale))
+}
+
+func maxScale(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Add returns d + o.
+func (d Decimal) Add(o Decimal) Decimal {
+	s := maxScale(d.scale, o.scale)
+	return Decimal{unscaled: new(big.Int).Add(d.rescale(s), o.rescale(s)), scale: s}
+}
+
+// Sub returns d - o.
+func (d Decimal) Sub(o Decimal) Decimal {
+	s := maxScale(d.scale, o.scale)
+	return Decimal{unscaled: new(big.Int).Sub(d.rescale(s), o.rescale(s)), scale: s}
+}
+
+// Mul returns d * o.
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{unscaled: new(big.Int).Mul(d.coef(), o.coef()), scale: d.scale + o.scale}
+}
+
+// Div returns d / o. Quotients without an exact decimal representation
+// are rounded half to even to DivScale decimals, or the scale of d or o if
+// that is larger. Trailing zeros beyond the scales of d and o are dropped.
+func (d Decimal) Div(o Decimal) (Decimal, error) {
+	if o.Sign() == 0 {
+		return Decimal{}, ErrDivisionByZero
+	}
+	min := maxScale(d.scale, o.scale)
+	s := maxScale(min, DivScale)
+	n := new(big.Int).Mul(d.coef(), pow10(s+o.scale-d.scale))
+	q, r := new(big.Int).QuoRem(n, o.coef(), new(big.Int))
+	if r.Sign() != 0 {
+		half := new(big.Int).Abs(r)
+		half.Mul(half, big.NewInt(2))
+		c := half.Cmp(new(big.Int).Abs(o.coef()))
+		if c > 0 || (c == 0 && q.Bit(0) == 1) {
+			if n.Sign()*o.coef().Sign() < 0 {
+				q.Sub(q, bigOne)
+			} else {
+				q.Add(q, bigOne)
+			}
+		}
+	}
+	m := new(big.Int)
+	for s > min {
+		t, rem := new(big.Int).QuoRem(q, bigTen, m)
+		if rem.Sign() != 0 {
+			break
+		}
+		q, s = t, s-1
+	}
+	return Decimal{unscaled: q, scale: s}, nil
+}
+
+// Neg returns -d.
+func (d Decimal) Neg() Decimal {
+	return Decimal{unscaled: new(big.Int).Neg(d.coef()), scale: d.scale}
+}
+
+// Cmp compares d and o and returns -1, 0 or 1.
+func (d Decimal) Cmp(o Decimal) int {
+	s := maxScale(d.scale, o.scale)
+	return d.rescale(s).Cmp(o.rescale(s))
+}
+
+// Trunc returns the integer part of d.
+func (d Decimal) Trunc() *big.Int {
+	if d.scale <= 0 {
+		return d.rescale(0)
+	}
+	return new(big.Int).Quo(d.coef(), pow10(d.scale))
+}
+
+// Rat returns d as a rational.
+func (d Decimal) Rat() *big.Rat {
+	if d.scale <= 0 {
+		return new(big.Rat).SetInt(d.rescale(0))
+	}
+	return new(big.Rat).SetFrac(d.coef(), pow10(d.scale))
+}
+
+// Float64 returns the float64 closest to d.
+func (d Decimal) Float64() float64 {
+	f, _ := d.Rat().Float64()
+	return f
+}
+
+func (d Decimal) String() string {
+	if d.scale <= 0 {
+		return d.rescale(0).String()
+	}
+	digits := new(big.Int).Abs(d.coef()).String()
+	if n := int(d.scale) + 1 - len(digits); n > 0 {
+		digits = strings.Repeat("0", n) + digits
+	}
+	i := len(digits) - int(d.scale)
+	s := digits[:i] + "." + digits[i:]
+	if d.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalJSON encodes d as a JSON number with all its decimals.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
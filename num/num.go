@@ -0,0 +1,451 @@
+// Package num implements the numeric tower: int64, big integers, rationals,
+// decimals and float64. Operations on mixed numbers convert both to the
+// higher of the two in that order, and integers overflowing int64 are
+// promoted to big integers. Big integer and rational results that are
+// integers fitting in an int64 are returned as int64.
+package num
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+type kind int
+
+const (
+	kindNone kind = iota
+	kindInt
+	kindBig
+	kindRat
+	kindDecimal
+	kindFloat
+)
+
+func kindOf(v interface{}) kind {
+	switch v.(type) {
+	case int64:
+		return kindInt
+	case *big.Int:
+		return kindBig
+	case *big.Rat:
+		return kindRat
+	case Decimal:
+		return kindDecimal
+	case float64:
+		return kindFloat
+	}
+	return kindNone
+}
+
+// IsNumber reports whether v is a number of the tower.
+func IsNumber(v interface{}) bool {
+	return kindOf(v) != kindNone
+}
+
+// IsExtended reports whether v is a big integer, a rational or a decimal.
+func IsExtended(v interface{}) bool {
+	switch kindOf(v) {
+	case kindBig, kindRat, kindDecimal:
+		return true
+	}
+	return false
+}
+
+// AnyExtended reports whether any of vs is a big integer, a rational or a decimal.
+func AnyExtended(vs ...interface{}) bool {
+	for _, v := range vs {
+		if IsExtended(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize returns integer valued big integers and rationals that fit in
+// an int64 as int64, and other integer valued rationals as big integers.
+func Normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *big.Int:
+		if v.IsInt64() {
+			return v.Int64()
+		}
+	case *big.Rat:
+		if v.IsInt() {
+			return Normalize(new(big.Int).Set(v.Num()))
+		}
+	}
+	return v
+}
+
+func toBig(v interface{}) *big.Int {
+	switch v := v.(type) {
+	case int64:
+		return big.NewInt(v)
+	case *big.Int:
+		return v
+	}
+	return nil
+}
+
+func toRat(v interface{}) *big.Rat {
+	switch v := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(v)
+	case *big.Int:
+		return new(big.Rat).SetInt(v)
+	case *big.Rat:
+		return v
+	case Decimal:
+		return v.Rat()
+	case float64:
+		return new(big.Rat).SetFloat64(v)
+	}
+	return nil
+}
+
+func toDecimal(v interface{}) Decimal {
+	switch v := v.(type) {
+	case int64:
+		return DecimalFromInt(v)
+	case *big.Int:
+		return Decimal{unscaled: v}
+	case *big.Rat:
+		return DecimalFromRat(v)
+	case Decimal:
+		return v
+	}
+	return Decimal{}
+}
+
+// ToFloat64 converts a number to float64.
+func ToFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, true
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f, true
+	case Decimal:
+		return v.Float64(), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// ToInteger truncates a number to an integer, an int64 or a big integer.
+func ToInteger(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case *big.Int:
+		return Normalize(v), true
+	case *big.Rat:
+		return Normalize(new(big.Int).Quo(v.Num(), v.Denom())), true
+	case Decimal:
+		return Normalize(v.Trunc()), true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, false
+		}
+		if v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), true
+		}
+		i, _ := big.NewFloat(v).Int(nil)
+		return i, true
+	}
+	return nil, false
+}
+
+// ToRat converts a number to a rational, returned as an integer if it has
+// no fractional part. Floats are converted exactly.
+func ToRat(v interface{}) (interface{}, bool) {
+	r := toRat(v)
+	if r == nil {
+		return nil, false
+	}
+	return Normalize(r), true
+}
+
+// ToDecimal converts a number to a decimal. Floats are converted using
+// the shortest representation that reads back as the same float.
+func ToDecimal(v interface{}) (Decimal, bool) {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return Decimal{}, false
+		}
+		d, err := ParseDecimal(big.NewFloat(v).Text('f', -1))
+		return d, err == nil
+	case int64, *big.Int, *big.Rat, Decimal:
+		return toDecimal(v), true
+	}
+	return Decimal{}, false
+}
+
+// Rational returns the exact quotient of two integers.
+func Rational(a, b interface{}) (interface{}, error) {
+	x, y := toBig(a), toBig(b)
+	if x == nil || y == nil {
+		return nil, fmt.Errorf("cannot make a rational of %v and %v", a, b)
+	}
+	if y.Sign() == 0 {
+		return nil, ErrDivisionByZero
+	}
+	return Normalize(new(big.Rat).SetFrac(x, y)), nil
+}
+
+// anyRat reports whether a or b is a rational. Rationals mixed with
+// decimals are computed exactly before rounding the result to a decimal.
+func anyRat(a, b interface{}) bool {
+	return kindOf(a) == kindRat || kindOf(b) == kindRat
+}
+
+// operands returns the kind both a and b are converted to.
+func operands(op string, a, b interface{}) (kind, error) {
+	ka, kb := kindOf(a), kindOf(b)
+	if ka == kindNone {
+		return kindNone, fmt.Errorf("cannot %s %#v", op, a)
+	}
+	if kb == kindNone {
+		return kindNone, fmt.Errorf("cannot %s %#v", op, b)
+	}
+	if ka > kb {
+		return ka, nil
+	}
+	return kb, nil
+}
+
+// Add returns a + b.
+func Add(a, b interface{}) (interface{}, error) {
+	k, err := operands("sum", a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case kindInt:
+		x, y := a.(int64), b.(int64)
+		if r, ok := AddInt64(x, y); ok {
+			return r, nil
+		}
+		return Normalize(new(big.Int).Add(big.NewInt(x), big.NewInt(y))), nil
+	case kindBig:
+		return Normalize(new(big.Int).Add(toBig(a), toBig(b))), nil
+	case kindRat:
+		return Normalize(new(big.Rat).Add(toRat(a), toRat(b))), nil
+	case kindDecimal:
+		if anyRat(a, b) {
+			return DecimalFromRat(new(big.Rat).Add(toRat(a), toRat(b))), nil
+		}
+		return toDecimal(a).Add(toDecimal(b)), nil
+	}
+	x, _ := ToFloat64(a)
+	y, _ := ToFloat64(b)
+	return x + y, nil
+}
+
+// Sub returns a - b.
+func Sub(a, b interface{}) (interface{}, error) {
+	k, err := operands("subtract", a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case kindInt:
+		x, y := a.(int64), b.(int64)
+		if r, ok := SubInt64(x, y); ok {
+			return r, nil
+		}
+		return Normalize(new(big.Int).Sub(big.NewInt(x), big.NewInt(y))), nil
+	case kindBig:
+		return Normalize(new(big.Int).Sub(toBig(a), toBig(b))), nil
+	case kindRat:
+		return Normalize(new(big.Rat).Sub(toRat(a), toRat(b))), nil
+	case kindDecimal:
+		if anyRat(a, b) {
+			return DecimalFromRat(new(big.Rat).Sub(toRat(a), toRat(b))), nil
+		}
+		return toDecimal(a).Sub(toDecimal(b)), nil
+	}
+	x, _ := ToFloat64(a)
+	y, _ := ToFloat64(b)
+	return x - y, nil
+}
+
+// Mul returns a * b.
+func Mul(a, b interface{}) (interface{}, error) {
+	k, err := operands("multiply", a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case kindInt:
+		x, y := a.(int64), b.(int64)
+		if r, ok := MulInt64(x, y); ok {
+			return r, nil
+		}
+		return Normalize(new(big.Int).Mul(big.NewInt(x), big.NewInt(y))), nil
+	case kindBig:
+		return Normalize(new(big.Int).Mul(toBig(a), toBig(b))), nil
+	case kindRat:
+		return Normalize(new(big.Rat).Mul(toRat(a), toRat(b))), nil
+	case kindDecimal:
+		if anyRat(a, b) {
+			return DecimalFromRat(new(big.Rat).Mul(toRat(a), toRat(b))), nil
+		}
+		return toDecimal(a).Mul(toDecimal(b)), nil
+	}
+	x, _ := ToFloat64(a)
+	y, _ := ToFloat64(b)
+	return x * y, nil
+}
+
+// Div returns a / b. The quotient of integers is truncated like in Go,
+// use Rational for exact quotients.
+func Div(a, b interface{}) (interface{}, error) {
+	k, err := operands("divide with", a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case kindInt, kindBig:
+		y := toBig(b)
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return Normalize(new(big.Int).Quo(toBig(a), y)), nil
+	case kindRat:
+		y := toRat(b)
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return Normalize(new(big.Rat).Quo(toRat(a), y)), nil
+	case kindDecimal:
+		if anyRat(a, b) {
+			y := toRat(b)
+			if y.Sign() == 0 {
+				return nil, ErrDivisionByZero
+			}
+			return DecimalFromRat(new(big.Rat).Quo(toRat(a), y)), nil
+		}
+		return toDecimal(a).Div(toDecimal(b))
+	}
+	x, _ := ToFloat64(a)
+	y, _ := ToFloat64(b)
+	return x / y, nil
+}
+
+// Mod returns the remainder of a / b, with the sign of a like in Go.
+func Mod(a, b interface{}) (interface{}, error) {
+	k, err := operands("take the modulo of", a, b)
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case kindInt, kindBig:
+		y := toBig(b)
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return Normalize(new(big.Int).Rem(toBig(a), y)), nil
+	case kindRat:
+		x, y := toRat(a), toRat(b)
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		q := new(big.Rat).Quo(x, y)
+		t := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+		return Normalize(new(big.Rat).Sub(x, t.Mul(t, y))), nil
+	case kindDecimal:
+		x, y := toDecimal(a), toDecimal(b)
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		s := maxScale(x.scale, y.scale)
+		r := new(big.Int).Rem(x.rescale(s), y.rescale(s))
+		return Decimal{unscaled: r, scale: s}, nil
+	}
+	x, _ := ToFloat64(a)
+	y, _ := ToFloat64(b)
+	return math.Mod(x, y), nil
+}
+
+// Cmp compares a and b and returns -1, 0 or 1.
+func Cmp(a, b interface{}) (int, error) {
+	k, err := operands("compare", a, b)
+	if err != nil {
+		return 0, err
+	}
+	switch k {
+	case kindInt:
+		x, y := a.(int64), b.(int64)
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	case kindBig:
+		return toBig(a).Cmp(toBig(b)), nil
+	case kindRat, kindDecimal:
+		return toRat(a).Cmp(toRat(b)), nil
+	}
+	x, _ := ToFloat64(a)
+	y, _ := ToFloat64(b)
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Reduce applies op to the numbers in args from left to right.
+func Reduce(op func(a, b interface{}) (interface{}, error), args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("no numbers to reduce")
+	}
+	res := args[0]
+	if !IsNumber(res) {
+		// Let op describe the unsupported value.
+		return op(res, int64(0))
+	}
+	for _, arg := range args[1:] {
+		var err error
+		if res, err = op(res, arg); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// AddInt64 returns a + b and whether it did not overflow.
+func AddInt64(a, b int64) (int64, bool) {
+	r := a + b
+	return r, (r > a) == (b > 0)
+}
+
+// SubInt64 returns a - b and whether it did not overflow.
+func SubInt64(a, b int64) (int64, bool) {
+	r := a - b
+	return r, (r < a) == (b > 0)
+}
+
+// MulInt64 returns a * b and whether it did not overflow.
+func MulInt64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	r := a * b
+	if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return r, false
+	}
+	return r, true
+}
@@ -0,0 +1,122 @@
+package num_test
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/Stromberg/gel/num"
+	"github.com/stretchr/testify/assert"
+)
+
+func dec(t *testing.T, s string) num.Decimal {
+	d, err := num.ParseDecimal(s)
+	assert.NoError(t, err)
+	return d
+}
+
+func TestDecimal(t *testing.T) {
+	assert.Equal(t, "0.30", dec(t, "0.10").Add(dec(t, "0.20")).String())
+	assert.Equal(t, "-1.05", dec(t, "0.2").Sub(dec(t, "1.25")).String())
+	assert.Equal(t, "0.0625", dec(t, "0.25").Mul(dec(t, "0.25")).String())
+	assert.Equal(t, "-0.001", dec(t, "-.001").String())
+	assert.Equal(t, 0, dec(t, "1.50").Cmp(dec(t, "1.5")))
+
+	q, err := dec(t, "2").Div(dec(t, "3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.6666666666666667", q.String())
+	q, _ = dec(t, "-1").Div(dec(t, "8"))
+	assert.Equal(t, "-0.125", q.String())
+	q, _ = dec(t, "5.00").Div(dec(t, "2"))
+	assert.Equal(t, "2.50", q.String())
+	_, err = dec(t, "1").Div(num.Decimal{})
+	assert.Equal(t, num.ErrDivisionByZero, err)
+
+	for _, s := range []string{"", ".", "1.2.3", "1e3", "--1"} {
+		_, err := num.ParseDecimal(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestPromotion(t *testing.T) {
+	v, err := num.Add(int64(math.MaxInt64), int64(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "9223372036854775808", v.(*big.Int).String())
+	v, err = num.Sub(v, int64(1))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), v)
+
+	v, err = num.Mul(int64(math.MinInt64), int64(-1))
+	assert.NoError(t, err)
+	assert.IsType(t, &big.Int{}, v)
+
+	v, err = num.Add(mustRat(t, 1, 3), dec(t, "0.5"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.8333333333333333", v.(num.Decimal).String())
+
+	v, err = num.Add(dec(t, "0.5"), 0.25)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, v)
+
+	_, err = num.Add(int64(1), "a")
+	assert.EqualError(t, err, `cannot sum "a"`)
+}
+
+func mustRat(t *testing.T, a, b int64) interface{} {
+	r, err := num.Rational(a, b)
+	assert.NoError(t, err)
+	return r
+}
+
+func TestRational(t *testing.T) {
+	assert.Equal(t, int64(2), mustRat(t, 4, 2))
+	assert.Equal(t, "7/2", mustRat(t, 7, 2).(*big.Rat).String())
+	_, err := num.Rational(int64(1), int64(0))
+	assert.Equal(t, num.ErrDivisionByZero, err)
+
+	v, err := num.Mod(mustRat(t, 7, 2), int64(2))
+	assert.NoError(t, err)
+	assert.Equal(t, "3/2", v.(*big.Rat).String())
+
+	c, err := num.Cmp(mustRat(t, 1, 3), dec(t, "0.3333"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c)
+}
+
+func TestConversions(t *testing.T) {
+	i, ok := num.ToInteger(dec(t, "-3.9"))
+	assert.True(t, ok)
+	assert.Equal(t, int64(-3), i)
+	i, ok = num.ToInteger(1e20)
+	assert.True(t, ok)
+	assert.Equal(t, "100000000000000000000", i.(*big.Int).String())
+	_, ok = num.ToInteger(math.NaN())
+	assert.False(t, ok)
+
+	d, ok := num.ToDecimal(0.1)
+	assert.True(t, ok)
+	assert.Equal(t, "0.1", d.String())
+	f, ok := num.ToFloat64(mustRat(t, 1, 4))
+	assert.True(t, ok)
+	assert.Equal(t, 0.25, f)
+}
+
+func TestInt64Overflow(t *testing.T) {
+	_, ok := num.AddInt64(math.MaxInt64, 1)
+	assert.False(t, ok)
+	_, ok = num.AddInt64(math.MinInt64, -1)
+	assert.False(t, ok)
+	r, ok := num.AddInt64(-5, 3)
+	assert.True(t, ok)
+	assert.Equal(t, int64(-2), r)
+	_, ok = num.SubInt64(math.MinInt64, 1)
+	assert.False(t, ok)
+	r, ok = num.SubInt64(0, math.MaxInt64)
+	assert.True(t, ok)
+	assert.Equal(t, -int64(math.MaxInt64), r)
+	_, ok = num.MulInt64(math.MaxInt64/2+1, 2)
+	assert.False(t, ok)
+	r, ok = num.MulInt64(-3, 4)
+	assert.True(t, ok)
+	assert.Equal(t, int64(-12), r)
+}
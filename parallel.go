@@ -0,0 +1,265 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Stromberg/gel/utils"
+)
+
+// workers returns the number of goroutines used by the parallel
+// functions, set with Env.SetWorkers or GOMAXPROCS by default.
+func (s *Scope) workers() int {
+	if s.state != nil && s.state.workers > 0 {
+		return s.state.workers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// parallel calls f with the indexes from 0 to n-1 in the worker goroutines
+// of s. It returns the error of the lowest index that failed, the indexes
+// after it are not started once the error is known.
+func parallel(s *Scope, n int, f func(i int) error) error {
+	workers := s.workers()
+	if workers > n {
+		workers = n
+	}
+	errs := make([]error, n)
+	next, failed := int64(-1), int64(n)
+	fail := func(i int, err error) {
+		errs[i] = err
+		for {
+			cur := atomic.LoadInt64(&failed)
+			if int64(i) >= cur || atomic.CompareAndSwapInt64(&failed, cur, int64(i)) {
+				return
+			}
+		}
+	}
+	call := func(i int) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		select {
+		case <-done(s):
+			return s.state.ctx.Err()
+		default:
+		}
+		return f(i)
+	}
+
+	st := s.state
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		var depth int64
+		if st != nil {
+			depth = st.spawn()
+		}
+		go func() {
+			defer wg.Done()
+			if st != nil {
+				defer st.exit(st.begin(depth))
+			}
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(n) || i > atomic.LoadInt64(&failed) {
+					return
+				}
+				if err := call(int(i)); err != nil {
+					fail(int(i), err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if failed < int64(n) {
+		return errs[failed]
+	}
+	return nil
+}
+
+// sameLength returns the common length of lists, failing if they differ.
+func sameLength(lengths []int) (int, error) {
+	for _, l := range lengths {
+		if l != lengths[0] {
+			return 0, errors.New("Lists must be of same length")
+		}
+	}
+	return lengths[0], nil
+}
+
+func pmapFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	fn := args[0]
+	lists := make([][]interface{}, len(args)-1)
+	lengths := make([]int, len(lists))
+	for i, arg := range args[1:] {
+		list, err := utils.ToList(arg)
+		if err != nil {
+			return nil, err
+		}
+		lists[i], lengths[i] = list, len(list)
+	}
+	n, err := sameLength(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]interface{}, n)
+	err = parallel(s, n, func(i int) error {
+		fnArgs := make([]interface{}, len(lists))
+		for j, list := range lists {
+			fnArgs[j] = list[i]
+		}
+		r, err := utils.Call(fn, fnArgs...)
+		res[i] = r
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func pvecMapFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	fn := args[0]
+	lists := make([][]float64, len(args)-1)
+	lengths := make([]int, len(lists))
+	for i, arg := range args[1:] {
+		list, ok := arg.([]float64)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		lists[i], lengths[i] = list, len(list)
+	}
+	n, err := sameLength(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]float64, n)
+	err = parallel(s, n, func(i int) error {
+		fnArgs := make([]interface{}, len(lists))
+		for j, list := range lists {
+			fnArgs[j] = list[i]
+		}
+		r, err := utils.Call(fn, fnArgs...)
+		if err != nil {
+			return err
+		}
+		v, ok := r.(float64)
+		if !ok {
+			return errors.New("Expected function to return float64")
+		}
+		res[i] = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func pfilterFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.New(`pfilter takes two arguments`)
+	}
+	fn := args[0]
+	vec, isVec := args[1].([]float64)
+	list, err := utils.ToList(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make([]bool, len(list))
+	err = parallel(s, len(list), func(i int) error {
+		r, err := utils.Call(fn, list[i])
+		if err != nil {
+			return err
+		}
+		b, ok := r.(bool)
+		if !ok {
+			return errors.New("callback must return bool")
+		}
+		keep[i] = b
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if isVec {
+		res := []float64{}
+		for i, v := range vec {
+			if keep[i] {
+				res = append(res, v)
+			}
+		}
+		return res, nil
+	}
+	res := []interface{}{}
+	for i, v := range list {
+		if keep[i] {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// preduceFn reduces chunks of the list in parallel and then the results of
+// the chunks in order, starting with init if given. f must be associative.
+func preduceFn(s *Scope, args ...interface{}) (interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New(`preduce takes 2 or 3 arguments`)
+	}
+	fn := args[0]
+	list, err := utils.ToList(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := s.workers()
+	if chunks > len(list) {
+		chunks = len(list)
+	}
+	res := make([]interface{}, chunks)
+	err = parallel(s, chunks, func(i int) error {
+		chunk := list[i*len(list)/chunks : (i+1)*len(list)/chunks]
+		r := chunk[0]
+		for _, v := range chunk[1:] {
+			var err error
+			if r, err = utils.Call(fn, r, v); err != nil {
+				return err
+			}
+		}
+		res[i] = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 3 {
+		res = append([]interface{}{args[2]}, res...)
+	}
+	if len(res) == 0 {
+		return nil, nil
+	}
+	r := res[0]
+	for _, v := range res[1:] {
+		if r, err = utils.Call(fn, r, v); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,116 @@
+package gel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel"
+	"github.com/stretchr/testify/assert"
+)
+
+func evalWorkers(t *testing.T, expr string, workers int) (interface{}, error) {
+	g, err := gel.New(expr)
+	assert.NoError(t, err, expr)
+	env := gel.NewEnv()
+	env.SetWorkers(workers)
+	return g.Eval(env)
+}
+
+func TestParallel(t *testing.T) {
+	tests := []struct {
+		expr  string
+		value interface{}
+	}{
+		{"(pmap (fn [x] (* x x)) [1 2 3 4 5 6 7])", []interface{}{int64(1), int64(4), int64(9), int64(16), int64(25), int64(36), int64(49)}},
+		{"(pmap + [1 2 3] [10 20 30])", []interface{}{int64(11), int64(22), int64(33)}},
+		{"(pmap inc [])", []interface{}{}},
+		{"(pvec-map (fn [x] (* x 2.0)) (vec 1 2 3))", []float64{2, 4, 6}},
+		{"(pfilter (fn [x] (> x 2)) [1 5 2 4 3])", []interface{}{int64(5), int64(4), int64(3)}},
+		{"(pfilter (fn [x] (> x 2.0)) (vec 1 5 2 4 3))", []float64{5, 4, 3}},
+		{"(preduce + [1 2 3 4 5 6 7 8 9 10])", int64(55)},
+		{"(preduce + [1 2 3 4 5 6 7 8 9 10] 100)", int64(155)},
+		{"(preduce + [] 100)", int64(100)},
+		{"(preduce + [])", nil},
+		{"(preduce concat [[1] [2] [3] [4] [5]])", []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5)}},
+	}
+	for _, workers := range []int{1, 3, 16} {
+		for _, test := range tests {
+			r, err := evalWorkers(t, test.expr, workers)
+			assert.NoError(t, err, test.expr)
+			assert.Equal(t, test.value, r, test.expr)
+		}
+	}
+
+	_, err := evalWorkers(t, "(pmap + [1 2] [1])", 2)
+	assert.EqualError(t, err, "twik source:1:2: Lists must be of same length")
+	_, err = evalWorkers(t, "(pfilter inc [1 2])", 2)
+	assert.EqualError(t, err, "twik source:1:2: callback must return bool")
+}
+
+func TestParallelFirstError(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		_, err := evalWorkers(t, `(pmap (fn [x] (if (> x 2) (throw (sprintf "bad %v" x)) x)) [1 2 3 4 5 6 7 8])`, 4)
+		assert.EqualError(t, err, "twik source:1:28: bad 3")
+	}
+}
+
+func TestParallelWorkers(t *testing.T) {
+	// All four calls must run at the same time to get past the barrier.
+	var mu sync.Mutex
+	started := 0
+	all := make(chan struct{})
+	g, err := gel.New("(pmap barrier [1 2 3 4])")
+	assert.NoError(t, err)
+	env := gel.NewEnv()
+	env.SetWorkers(4)
+	env.AddVar("barrier", func(args ...interface{}) (interface{}, error) {
+		mu.Lock()
+		started++
+		if started == 4 {
+			close(all)
+		}
+		mu.Unlock()
+		select {
+		case <-all:
+			return args[0], nil
+		case <-time.After(5 * time.Second):
+			return nil, nil
+		}
+	})
+	r, err := g.Eval(env)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(4)}, r)
+}
+
+func TestParallelDepth(t *testing.T) {
+	// The workers wait for each other at the deepest call, so that their
+	// calls overlap.
+	g, err := gel.New(`
+(func f [n] (if (== n 0) (barrier) (f (- n 1))))
+(pmap (fn [x] (f 7)) [1 2 3 4 5 6 7 8])`)
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxDepth: 10})
+	env := gel.NewEnv()
+	env.SetWorkers(8)
+	var wg sync.WaitGroup
+	wg.Add(8)
+	env.AddVar("barrier", func(args ...interface{}) (interface{}, error) {
+		wg.Done()
+		wg.Wait()
+		return int64(0), nil
+	})
+	r, err := g.Eval(env)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0)}, r)
+
+	g, err = gel.New(`(func f [n] (if (== n 0) 0 (f (- n 1)))) (pmap (fn [x] (f 20)) [1 2])`)
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxDepth: 10})
+	_, err = g.Eval(gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, gel.ErrDepthLimit, e.Err)
+	}
+}
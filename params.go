@@ -0,0 +1,243 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/utils"
+)
+
+// params describes the parameters of a function:
+//
+//	[a b &opt c 1 d 2 :window 20 :step 1 & more]
+//
+// a and b are required, c and d are optional positional parameters with
+// default values, window and step are keyword parameters given as
+// :window 20 in calls, and more is a list with the remaining positional
+// arguments. Default values are evaluated when the function is called and
+// may refer to the parameters before them.
+//
+// Parameters may be destructuring patterns, see pattern.
+//
+// The slots of a call hold the required, optional, keyword and rest
+// parameters in that order, followed by the symbols bound by patterns.
+type params struct {
+	name     string
+	names    []string
+	patterns []*pattern
+	count    int
+	required int
+	optional int
+	keywords []string
+	rest     bool
+	defaults []ast.Node
+	codes    []code
+}
+
+// paramList returns the nodes of a list of parameters. Both [args...] and
+// (args...) are accepted, the latter is what quoted code turns into.
+func paramList(node ast.Node) ([]ast.Node, bool) {
+	switch node := node.(type) {
+	case *ast.ListList:
+		return node.Nodes, true
+	case *ast.List:
+		return node.Nodes, true
+	}
+	return nil, false
+}
+
+func (c *compiler) parseParams(name string, list ast.Node) (*params, error) {
+	nodes, ok := paramList(list)
+	if !ok {
+		return nil, errors.New(`func takes a list of parameters`)
+	}
+	p := &params{name: name}
+	optional := false
+	for i := 0; i < len(nodes); i++ {
+		node := nodes[i]
+		if keyword, ok := node.(*ast.Keyword); ok {
+			if i+1 == len(nodes) {
+				return nil, fmt.Errorf("func's keyword parameter %s takes a default value", keyword.Input)
+			}
+			name := keyword.Name
+			p.names = append(p.names, name)
+			p.patterns = append(p.patterns, nil)
+			p.keywords = append(p.keywords, name)
+			p.defaults = append(p.defaults, nodes[i+1])
+			i++
+			continue
+		}
+		symbol, _ := node.(*ast.Symbol)
+		switch {
+		case symbol != nil && symbol.Name == "&":
+			if i+2 != len(nodes) {
+				return nil, errors.New("func's & must be followed by exactly one parameter")
+			}
+			if err := p.add(nodes[i+1]); err != nil {
+				return nil, err
+			}
+			p.rest = true
+			i++
+		case symbol != nil && symbol.Name == "&opt":
+			if len(p.keywords) > 0 {
+				return nil, errors.New("func's optional parameters must come before keyword parameters")
+			}
+			optional = true
+		case len(p.keywords) > 0:
+			return nil, errors.New("func's keyword parameters must come after the positional parameters")
+		case optional:
+			if i+1 == len(nodes) {
+				return nil, fmt.Errorf("func's optional parameter %s takes a default value", c.fset.Code(node))
+			}
+			if err := p.add(node); err != nil {
+				return nil, err
+			}
+			p.defaults = append(p.defaults, nodes[i+1])
+			p.optional++
+			i++
+		default:
+			if err := p.add(node); err != nil {
+				return nil, err
+			}
+			p.required++
+		}
+	}
+	p.count = len(p.names)
+	for _, pat := range p.patterns {
+		if pat != nil {
+			p.names = append(p.names, pat.names()...)
+		}
+	}
+	if name := duplicate(p.names); name != "" {
+		return nil, fmt.Errorf("func's parameter %s is defined more than once", name)
+	}
+	return p, nil
+}
+
+// add adds a positional parameter, a symbol or a destructuring pattern.
+func (p *params) add(node ast.Node) error {
+	if symbol, ok := node.(*ast.Symbol); ok {
+		p.names = append(p.names, symbol.Name)
+		p.patterns = append(p.patterns, nil)
+		return nil
+	}
+	pat, err := parsePattern(node)
+	if err != nil {
+		return err
+	}
+	p.names = append(p.names, "")
+	p.patterns = append(p.patterns, pat)
+	return nil
+}
+
+// simple reports whether all parameters are required symbols.
+func (p *params) simple() bool {
+	return len(p.names) == p.required
+}
+
+// compileDefaults compiles the default values with the compiler of the function body.
+func (p *params) compileDefaults(fc *compiler) {
+	p.codes = fc.compileAll(p.defaults)
+}
+
+func (p *params) keyword(arg interface{}) int {
+	if len(p.keywords) == 0 {
+		return -1
+	}
+	if s, ok := arg.(Keyword); ok {
+		for i, k := range p.keywords {
+			if k == string(s) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// bind sets the slots of the function call scope s from args.
+func (p *params) bind(s *Scope, args []interface{}) error {
+	if p.simple() {
+		if len(args) != p.required {
+			return p.arityError()
+		}
+		copy(s.slots, args)
+		return nil
+	}
+
+	if len(args) < p.required {
+		return p.arityError()
+	}
+	copy(s.slots, args[:p.required])
+	given := make([]bool, len(p.defaults))
+	i := p.required
+	for j := 0; j < p.optional && i < len(args) && p.keyword(args[i]) < 0; j++ {
+		s.slots[p.required+j] = args[i]
+		given[j] = true
+		i++
+	}
+
+	start := i
+	for i < len(args) && p.keyword(args[i]) < 0 {
+		i++
+	}
+	if p.rest {
+		s.slots[p.count-1] = append([]interface{}{}, args[start:i]...)
+	} else if i > start {
+		return p.arityError()
+	}
+
+	for ; i < len(args); i += 2 {
+		k := p.keyword(args[i])
+		if k < 0 {
+			return p.arityError()
+		}
+		if i+1 == len(args) {
+			return fmt.Errorf("missing value for keyword argument :%s", p.keywords[k])
+		}
+		s.slots[p.required+p.optional+k] = args[i+1]
+		given[p.optional+k] = true
+	}
+
+	set := func(name string, v interface{}) {
+		s.slots[s.frame.index(name)] = v
+	}
+	for j := 0; j < p.count; j++ {
+		if d := j - p.required; d >= 0 && d < len(p.codes) && !given[d] {
+			v, err := p.codes[d](s)
+			if err != nil {
+				return err
+			}
+			s.slots[j] = v
+		}
+		if pat := p.patterns[j]; pat != nil {
+			if err := pat.bind(s.slots[j], set); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// arityError describes the arguments the function accepts.
+func (p *params) arityError() error {
+	nameInfo := "anonymous function"
+	if p.name != "" {
+		nameInfo = fmt.Sprintf("function %q", p.name)
+	}
+	min, max := p.required, p.required+p.optional
+	var takes string
+	switch {
+	case p.rest:
+		takes = "at least " + utils.CountArgs(min)
+	case min == max:
+		takes = utils.CountArgs(min)
+	default:
+		takes = fmt.Sprintf("%d to %d arguments", min, max)
+	}
+	if len(p.keywords) > 0 {
+		takes += " and the keyword arguments :" + strings.Join(p.keywords, ", :")
+	}
+	return fmt.Errorf("%s takes %s", nameInfo, takes)
+}
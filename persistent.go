@@ -0,0 +1,293 @@
+package gel
+
+import (
+	"errors"
+
+	"github.com/Stromberg/gel/persistent"
+	"github.com/Stromberg/gel/utils"
+)
+
+// toPersistent converts lists, vecs and dicts to persistent vectors and maps.
+// Persistent values are returned as they are.
+func toPersistent(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case *persistent.Vector, *persistent.Map, *persistent.Set:
+		return v, nil
+	case []interface{}:
+		return persistent.NewVector(v...), nil
+	case []float64:
+		return persistent.NewVector(utils.VecToList(v)...), nil
+	case map[interface{}]interface{}:
+		return persistent.FromMap(v), nil
+	}
+	return nil, utils.ErrParameterType
+}
+
+// plain converts the persistent vectors and maps in v, a value returned to
+// the host, to []interface{} and map[interface{}]interface{}. Lists and
+// dicts holding no persistent values are returned as they are.
+func plain(v interface{}) interface{} {
+	p, _ := toPlain(v)
+	return p
+}
+
+// toPlain is plain, it also reports whether v was converted.
+func toPlain(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case *persistent.Vector:
+		l := v.Slice()
+		for i, x := range l {
+			l[i], _ = toPlain(x)
+		}
+		return l, true
+	case *persistent.Map:
+		d := make(map[interface{}]interface{}, v.Len())
+		v.Range(func(k, x interface{}) bool {
+			d[k], _ = toPlain(x)
+			return true
+		})
+		return d, true
+	case []interface{}:
+		var res []interface{}
+		for i, x := range v {
+			p, converted := toPlain(x)
+			if converted && res == nil {
+				res = append([]interface{}{}, v...)
+			}
+			if res != nil {
+				res[i] = p
+			}
+		}
+		if res == nil {
+			return v, false
+		}
+		return res, true
+	case map[interface{}]interface{}:
+		var res map[interface{}]interface{}
+		for k, x := range v {
+			p, converted := toPlain(x)
+			if converted && res == nil {
+				res = make(map[interface{}]interface{}, len(v))
+				for k, x := range v {
+					res[k] = x
+				}
+			}
+			if res != nil {
+				res[k] = p
+			}
+		}
+		if res == nil {
+			return v, false
+		}
+		return res, true
+	}
+	return v, false
+}
+
+// index converts the key of a vector to an index.
+func index(k interface{}) (int, error) {
+	i, ok := k.(int64)
+	if !ok {
+		return 0, utils.ErrParameterType
+	}
+	return int(i), nil
+}
+
+// pair returns the key and value of a [k v] entry conjoined to a map.
+func pair(v interface{}) (interface{}, interface{}, error) {
+	list, err := utils.ToList(v)
+	if err != nil && err != utils.ErrParameterType {
+		return nil, nil, err
+	}
+	if err != nil || len(list) != 2 {
+		return nil, nil, errors.New("conj on a dict takes [key value] pairs")
+	}
+	return list[0], list[1], nil
+}
+
+var persistentFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return toPersistent(args[0])
+}, utils.CheckArity(1))
+
+var isPersistentFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	switch args[0].(type) {
+	case *persistent.Vector, *persistent.Map, *persistent.Set:
+		return true
+	}
+	return false
+}, utils.CheckArity(1))
+
+var vectorFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return persistent.NewVector(args...), nil
+})
+
+var hashMapFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return persistent.NewMap(args...)
+})
+
+// transient returns a transient copy of a container.
+func transient(c interface{}) (interface{}, error) {
+	c, err := toPersistent(c)
+	if err != nil {
+		return nil, err
+	}
+	switch c := c.(type) {
+	case *persistent.Vector:
+		return c.Transient(), nil
+	case *persistent.Map:
+		return c.Transient(), nil
+	}
+	return nil, utils.ErrParameterType
+}
+
+// persist returns the persistent value of a transient.
+func persist(t interface{}) (interface{}, error) {
+	switch t := t.(type) {
+	case *persistent.TransientVector:
+		return t.Persistent()
+	case *persistent.TransientMap:
+		return t.Persistent()
+	}
+	return nil, utils.ErrParameterType
+}
+
+// assocAll sets the keys and values, which alternate in kvs, in a transient.
+func assocAll(t interface{}, kvs []interface{}) error {
+	for i := 0; i+1 < len(kvs); i += 2 {
+		var err error
+		switch t := t.(type) {
+		case *persistent.TransientVector:
+			var n int
+			if n, err = index(kvs[i]); err == nil {
+				err = t.Assoc(n, kvs[i+1])
+			}
+		case *persistent.TransientMap:
+			err = t.Assoc(kvs[i], kvs[i+1])
+		default:
+			err = utils.ErrParameterType
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conjAll adds values to a transient, [key value] pairs in the case of a map.
+func conjAll(t interface{}, vs []interface{}) error {
+	for _, v := range vs {
+		var err error
+		switch t := t.(type) {
+		case *persistent.TransientVector:
+			err = t.Conj(v)
+		case *persistent.TransientMap:
+			var k interface{}
+			if k, v, err = pair(v); err == nil {
+				err = t.Assoc(k, v)
+			}
+		default:
+			err = utils.ErrParameterType
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dissocAll removes keys from a transient map.
+func dissocAll(t interface{}, keys []interface{}) error {
+	m, ok := t.(*persistent.TransientMap)
+	if !ok {
+		return utils.ErrParameterType
+	}
+	for _, k := range keys {
+		if err := m.Dissoc(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeAll sets the entries of dicts in a transient map.
+func mergeAll(t interface{}, dicts []interface{}) error {
+	m, ok := t.(*persistent.TransientMap)
+	if !ok {
+		return utils.ErrParameterType
+	}
+	for _, d := range dicts {
+		var err error
+		if !utils.RangeDict(d, func(k, v interface{}) bool {
+			err = m.Assoc(k, v)
+			return err == nil
+		}) {
+			return utils.ErrParameterType
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batch applies update to a transient copy of c and returns the new version.
+func batch(c interface{}, args []interface{}, update func(interface{}, []interface{}) error) (interface{}, error) {
+	t, err := transient(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(t, args); err != nil {
+		return nil, err
+	}
+	return persist(t)
+}
+
+var assocFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, errors.New("assoc takes a container and pairs of keys and values")
+	}
+	return batch(args[0], args[1:], assocAll)
+}, utils.CheckArityAtLeast(1))
+
+var conjFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if s, ok := args[0].(*persistent.Set); ok {
+		return s.Conj(args[1:]...)
+	}
+	return batch(args[0], args[1:], conjAll)
+}, utils.CheckArityAtLeast(1))
+
+var dissocFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return batch(args[0], args[1:], dissocAll)
+}, utils.CheckArityAtLeast(1))
+
+var transientFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return transient(args[0])
+}, utils.CheckArity(1))
+
+var persistentInPlaceFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	return persist(args[0])
+}, utils.CheckArity(1))
+
+var assocInPlaceFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if len(args)%2 != 1 {
+		return nil, errors.New("assoc! takes a transient and pairs of keys and values")
+	}
+	if err := assocAll(args[0], args[1:]); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}, utils.CheckArityAtLeast(1))
+
+var conjInPlaceFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if err := conjAll(args[0], args[1:]); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}, utils.CheckArityAtLeast(1))
+
+var dissocInPlaceFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if err := dissocAll(args[0], args[1:]); err != nil {
+		return nil, err
+	}
+	return args[0], nil
+}, utils.CheckArityAtLeast(1))
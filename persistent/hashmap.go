@@ -0,0 +1,467 @@
+package persistent
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"math/bits"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Stromberg/gel/num"
+)
+
+// ErrKeyNotComparable is returned for keys that cannot be compared with ==,
+// such as lists and dicts.
+var ErrKeyNotComparable = errors.New("key is not comparable")
+
+// hentry is either a key and its value or a child node.
+type hentry struct {
+	hash  uint32
+	key   interface{}
+	val   interface{}
+	child *hnode
+}
+
+// hnode is a node of a hash array mapped trie. The entries are ordered by
+// the bits set in bitmap. Keys with equal hashes are kept in a collision
+// node, which is a plain list of entries.
+type hnode struct {
+	owner     *owner
+	bitmap    uint32
+	entries   []hentry
+	collision bool
+}
+
+func (n *hnode) edit(o *owner) *hnode {
+	if o != nil && n.owner == o {
+		return n
+	}
+	entries := make([]hentry, len(n.entries), len(n.entries)+1)
+	copy(entries, n.entries)
+	return &hnode{owner: o, bitmap: n.bitmap, entries: entries, collision: n.collision}
+}
+
+func (n *hnode) insert(i int, e hentry) {
+	n.entries = append(n.entries, hentry{})
+	copy(n.entries[i+1:], n.entries[i:])
+	n.entries[i] = e
+}
+
+func (n *hnode) remove(i int) {
+	copy(n.entries[i:], n.entries[i+1:])
+	n.entries[len(n.entries)-1] = hentry{}
+	n.entries = n.entries[:len(n.entries)-1]
+}
+
+func bitpos(hash uint32, shift uint) uint32 {
+	return 1 << ((hash >> shift) & mask)
+}
+
+func (n *hnode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hnode) get(shift uint, hash uint32, key interface{}) (interface{}, bool) {
+	for {
+		if n.collision {
+			for _, e := range n.entries {
+				if keysEqual(e.key, key) {
+					return e.val, true
+				}
+			}
+			return nil, false
+		}
+		bit := bitpos(hash, shift)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		e := n.entries[n.index(bit)]
+		if e.child == nil {
+			if keysEqual(e.key, key) {
+				return e.val, true
+			}
+			return nil, false
+		}
+		n, shift = e.child, shift+levelBits
+	}
+}
+
+// merge returns a node holding the leaves a and b.
+func merge(o *owner, shift uint, a, b hentry) *hnode {
+	if a.hash == b.hash {
+		return &hnode{owner: o, entries: []hentry{a, b}, collision: true}
+	}
+	ia, ib := (a.hash>>shift)&mask, (b.hash>>shift)&mask
+	if ia == ib {
+		child := merge(o, shift+levelBits, a, b)
+		return &hnode{owner: o, bitmap: 1 << ia, entries: []hentry{{child: child}}}
+	}
+	if ia > ib {
+		a, b = b, a
+	}
+	return &hnode{owner: o, bitmap: 1<<ia | 1<<ib, entries: []hentry{a, b}}
+}
+
+// assoc returns the node with key set to val and whether the key was added.
+func (n *hnode) assoc(o *owner, shift uint, hash uint32, key, val interface{}) (*hnode, bool) {
+	if n.collision {
+		for i, e := range n.entries {
+			if keysEqual(e.key, key) {
+				ret := n.edit(o)
+				ret.entries[i].val = val
+				return ret, false
+			}
+		}
+		ret := n.edit(o)
+		ret.entries = append(ret.entries, hentry{hash: hash, key: key, val: val})
+		return ret, true
+	}
+
+	bit := bitpos(hash, shift)
+	i := n.index(bit)
+	if n.bitmap&bit == 0 {
+		ret := n.edit(o)
+		ret.insert(i, hentry{hash: hash, key: key, val: val})
+		ret.bitmap |= bit
+		return ret, true
+	}
+
+	e := n.entries[i]
+	if e.child != nil {
+		child, added := e.child.assoc(o, shift+levelBits, hash, key, val)
+		ret := n.edit(o)
+		ret.entries[i].child = child
+		return ret, added
+	}
+	ret := n.edit(o)
+	if keysEqual(e.key, key) {
+		ret.entries[i].val = val
+		return ret, false
+	}
+	ret.entries[i] = hentry{child: merge(o, shift+levelBits, e, hentry{hash: hash, key: key, val: val})}
+	return ret, true
+}
+
+// dissoc returns the node without key and whether the key was removed.
+func (n *hnode) dissoc(o *owner, shift uint, hash uint32, key interface{}) (*hnode, bool) {
+	if n.collision {
+		for i, e := range n.entries {
+			if keysEqual(e.key, key) {
+				ret := n.edit(o)
+				ret.remove(i)
+				return ret, true
+			}
+		}
+		return n, false
+	}
+
+	bit := bitpos(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := n.index(bit)
+	e := n.entries[i]
+	if e.child == nil {
+		if e.key != key {
+			return n, false
+		}
+		ret := n.edit(o)
+		ret.remove(i)
+		ret.bitmap &^= bit
+		return ret, true
+	}
+
+	child, removed := e.child.dissoc(o, shift+levelBits, hash, key)
+	if !removed {
+		return n, false
+	}
+	ret := n.edit(o)
+	switch {
+	case len(child.entries) == 0:
+		ret.remove(i)
+		ret.bitmap &^= bit
+	case len(child.entries) == 1 && child.entries[0].child == nil:
+		// A single leaf moves up to take the place of its node.
+		ret.entries[i] = child.entries[0]
+	default:
+		ret.entries[i].child = child
+	}
+	return ret, true
+}
+
+func (n *hnode) each(fn func(key, val interface{}) bool) bool {
+	for _, e := range n.entries {
+		if e.child != nil {
+			if !e.child.each(fn) {
+				return false
+			}
+		} else if !fn(e.key, e.val) {
+			return false
+		}
+	}
+	return true
+}
+
+func mix(x uint64) uint32 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return uint32(x) ^ uint32(x>>32)
+}
+
+func hashString(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+// hash returns the hash of a comparable key. Keys that are equal with
+// keysEqual have equal hashes.
+func hash(key interface{}) uint32 {
+	switch k := key.(type) {
+	case nil:
+		return 0
+	case string:
+		return hashString(k)
+	case num.Decimal:
+		return hashString(k.Rat().RatString())
+	case *big.Int:
+		return hashString(k.String())
+	case *big.Rat:
+		return hashString(k.RatString())
+	case int64:
+		return mix(uint64(k))
+	case float64:
+		return mix(math.Float64bits(k))
+	case bool:
+		if k {
+			return 1
+		}
+		return 2
+	}
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.String:
+		return hashString(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mix(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mix(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return mix(math.Float64bits(v.Float()))
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return mix(uint64(v.Pointer()))
+	}
+	return hashString(fmt.Sprintf("%#v", key))
+}
+
+// keysEqual reports whether the keys a and b are equal. The numbers of the
+// numeric tower that are held by pointers are compared by value, other keys
+// with ==.
+func keysEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case num.Decimal:
+		b, ok := b.(num.Decimal)
+		return ok && a.Cmp(b) == 0
+	case *big.Int:
+		b, ok := b.(*big.Int)
+		return ok && a.Cmp(b) == 0
+	case *big.Rat:
+		b, ok := b.(*big.Rat)
+		return ok && a.Cmp(b) == 0
+	}
+	return a == b
+}
+
+// checkKey rejects the keys that cannot be compared with ==. Vectors and
+// maps are values like the slices and Go maps they replace, so they are
+// rejected too rather than compared by pointer.
+func checkKey(key interface{}) error {
+	switch key.(type) {
+	case *Vector, *Map:
+		return ErrKeyNotComparable
+	}
+	if key != nil && !reflect.TypeOf(key).Comparable() {
+		return ErrKeyNotComparable
+	}
+	return nil
+}
+
+// Map is a persistent hash map.
+type Map struct {
+	cnt  int
+	root *hnode
+}
+
+// EmptyMap is the map without keys.
+var EmptyMap = &Map{root: &hnode{}}
+
+// NewMap returns a map with the given keys and values, which alternate in kvs.
+func NewMap(kvs ...interface{}) (*Map, error) {
+	if len(kvs)%2 != 0 {
+		return nil, errors.New("map requires an even number of arguments")
+	}
+	t := EmptyMap.Transient()
+	for i := 0; i < len(kvs); i += 2 {
+		if err := t.Assoc(kvs[i], kvs[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return t.Persistent()
+}
+
+// FromMap returns a map with the keys and values of d.
+func FromMap(d map[interface{}]interface{}) *Map {
+	t := EmptyMap.Transient()
+	for k, v := range d {
+		t.Assoc(k, v)
+	}
+	m, _ := t.Persistent()
+	return m
+}
+
+// Len returns the number of keys in m.
+func (m *Map) Len() int {
+	return m.cnt
+}
+
+// Get returns the value of key.
+func (m *Map) Get(key interface{}) (interface{}, bool) {
+	if checkKey(key) != nil {
+		return nil, false
+	}
+	return m.root.get(0, hash(key), key)
+}
+
+// Assoc returns m with key set to val.
+func (m *Map) Assoc(key, val interface{}) (*Map, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	root, added := m.root.assoc(nil, 0, hash(key), key, val)
+	cnt := m.cnt
+	if added {
+		cnt++
+	}
+	return &Map{cnt: cnt, root: root}, nil
+}
+
+// Dissoc returns m without key.
+func (m *Map) Dissoc(key interface{}) *Map {
+	if checkKey(key) != nil {
+		return m
+	}
+	root, removed := m.root.dissoc(nil, 0, hash(key), key)
+	if !removed {
+		return m
+	}
+	return &Map{cnt: m.cnt - 1, root: root}
+}
+
+// Range calls fn for every key and value of m until fn returns false.
+// The order of the keys is unspecified.
+func (m *Map) Range(fn func(key, val interface{}) bool) {
+	m.root.each(fn)
+}
+
+// ToMap returns the keys and values of m in a Go map.
+func (m *Map) ToMap() map[interface{}]interface{} {
+	res := make(map[interface{}]interface{}, m.cnt)
+	m.Range(func(key, val interface{}) bool {
+		res[key] = val
+		return true
+	})
+	return res
+}
+
+// String returns m as a gel literal, like {:a 1 :b 2}, with the entries
+// sorted.
+func (m *Map) String() string {
+	return m.literal(fmt.Sprint)
+}
+
+// GoString is String with strings quoted, for %#v.
+func (m *Map) GoString() string {
+	return m.literal(goString)
+}
+
+func (m *Map) literal(format func(...interface{}) string) string {
+	entries := make([]string, 0, m.cnt)
+	m.Range(func(key, val interface{}) bool {
+		entries = append(entries, format(key)+" "+format(val))
+		return true
+	})
+	sort.Strings(entries)
+	return "{" + strings.Join(entries, " ") + "}"
+}
+
+// Transient returns a transient copy of m.
+func (m *Map) Transient() *TransientMap {
+	return &TransientMap{owner: &owner{}, cnt: m.cnt, root: m.root}
+}
+
+// TransientMap is a hash map that is updated in place.
+type TransientMap struct {
+	owner *owner
+	cnt   int
+	root  *hnode
+}
+
+// Len returns the number of keys in t.
+func (t *TransientMap) Len() int {
+	return t.cnt
+}
+
+// Get returns the value of key.
+func (t *TransientMap) Get(key interface{}) (interface{}, bool) {
+	if checkKey(key) != nil {
+		return nil, false
+	}
+	return t.root.get(0, hash(key), key)
+}
+
+// Assoc sets key to val.
+func (t *TransientMap) Assoc(key, val interface{}) error {
+	if t.owner == nil {
+		return ErrTransientUsed
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	root, added := t.root.assoc(t.owner, 0, hash(key), key, val)
+	t.root = root
+	if added {
+		t.cnt++
+	}
+	return nil
+}
+
+// Dissoc removes key.
+func (t *TransientMap) Dissoc(key interface{}) error {
+	if t.owner == nil {
+		return ErrTransientUsed
+	}
+	if checkKey(key) != nil {
+		return nil
+	}
+	root, removed := t.root.dissoc(t.owner, 0, hash(key), key)
+	t.root = root
+	if removed {
+		t.cnt--
+	}
+	return nil
+}
+
+// Persistent returns the persistent map with the contents of t.
+// t may not be used afterwards.
+func (t *TransientMap) Persistent() (*Map, error) {
+	if t.owner == nil {
+		return nil, ErrTransientUsed
+	}
+	t.owner = nil
+	return &Map{cnt: t.cnt, root: t.root}, nil
+}
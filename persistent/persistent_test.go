@@ -0,0 +1,209 @@
+package persistent_test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/persistent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVector(t *testing.T) {
+	const n = 5000
+	v := persistent.EmptyVector
+	versions := make([]*persistent.Vector, 0, n)
+	for i := 0; i < n; i++ {
+		versions = append(versions, v)
+		v = v.Conj(int64(i))
+	}
+	assert.Equal(t, n, v.Len())
+	for i, old := range versions {
+		assert.Equal(t, i, old.Len())
+	}
+	for i := 0; i < n; i++ {
+		x, ok := v.Nth(i)
+		assert.True(t, ok)
+		assert.Equal(t, int64(i), x)
+	}
+	_, ok := v.Nth(n)
+	assert.False(t, ok)
+
+	w, err := v.Assoc(1234, "x")
+	assert.NoError(t, err)
+	x, _ := w.Nth(1234)
+	assert.Equal(t, "x", x)
+	x, _ = v.Nth(1234)
+	assert.Equal(t, int64(1234), x)
+	_, err = v.Assoc(n+1, "x")
+	assert.Equal(t, persistent.ErrIndexOutOfRange, err)
+
+	for i := n - 1; i >= 0; i-- {
+		v, err = v.Pop()
+		assert.NoError(t, err)
+		assert.Equal(t, i, v.Len())
+		if i > 0 {
+			x, _ := v.Nth(i - 1)
+			assert.Equal(t, int64(i-1), x)
+		}
+	}
+	_, err = v.Pop()
+	assert.Equal(t, persistent.ErrEmpty, err)
+	assert.Equal(t, 1234, len(versions[1234].Slice()))
+}
+
+func TestTransientVector(t *testing.T) {
+	v := persistent.NewVector(1, 2, 3)
+	tv := v.Transient()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, tv.Conj(i))
+	}
+	assert.NoError(t, tv.Assoc(0, "a"))
+	assert.NoError(t, tv.Assoc(500, "b"))
+	w, err := tv.Persistent()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{1, 2, 3}, v.Slice())
+	assert.Equal(t, 1003, w.Len())
+	x, _ := w.Nth(500)
+	assert.Equal(t, "b", x)
+	x, _ = w.Nth(1002)
+	assert.Equal(t, 999, x)
+
+	assert.Equal(t, persistent.ErrTransientUsed, tv.Conj(1))
+	_, err = tv.Persistent()
+	assert.Equal(t, persistent.ErrTransientUsed, err)
+}
+
+type collider string
+
+func TestMap(t *testing.T) {
+	const n = 5000
+	m := persistent.EmptyMap
+	for i := 0; i < n; i++ {
+		var err error
+		m, err = m.Assoc(fmt.Sprint("k", i), i)
+		assert.NoError(t, err)
+	}
+	old := m
+	assert.Equal(t, n, m.Len())
+	for i := 0; i < n; i++ {
+		v, ok := m.Get(fmt.Sprint("k", i))
+		assert.True(t, ok)
+		assert.Equal(t, i, v)
+	}
+
+	m, _ = m.Assoc("k1", "one")
+	assert.Equal(t, n, m.Len())
+	v, _ := m.Get("k1")
+	assert.Equal(t, "one", v)
+	v, _ = old.Get("k1")
+	assert.Equal(t, 1, v)
+
+	for i := 0; i < n; i += 2 {
+		m = m.Dissoc(fmt.Sprint("k", i))
+	}
+	assert.Equal(t, n/2, m.Len())
+	for i := 0; i < n; i++ {
+		_, ok := m.Get(fmt.Sprint("k", i))
+		assert.Equal(t, i%2 == 1, ok)
+	}
+	assert.Equal(t, n, old.Len())
+	assert.Equal(t, n/2, len(m.ToMap()))
+	assert.Equal(t, m, m.Dissoc("missing"))
+
+	_, err := m.Assoc([]interface{}{1}, 1)
+	assert.Equal(t, persistent.ErrKeyNotComparable, err)
+	_, err = m.Assoc(persistent.NewVector(1), 1)
+	assert.Equal(t, persistent.ErrKeyNotComparable, err)
+	_, ok := m.Get([]interface{}{1})
+	assert.False(t, ok)
+}
+
+func TestMapKeys(t *testing.T) {
+	m, err := persistent.NewMap("a", 1, int64(1), 2, 1.0, 3, true, 4, nil, 5, collider("a"), 6)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, m.Len())
+	for k, v := range map[interface{}]interface{}{"a": 1, int64(1): 2, 1.0: 3, true: 4, nil: 5, collider("a"): 6} {
+		got, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.Equal(t, v, got)
+	}
+	m = m.Dissoc("a")
+	v, ok := m.Get(collider("a"))
+	assert.True(t, ok)
+	assert.Equal(t, 6, v)
+
+	_, err = persistent.NewMap("a")
+	assert.Error(t, err)
+}
+
+func TestMapNumberKeys(t *testing.T) {
+	d1, _ := num.ParseDecimal("1.5")
+	d2, _ := num.ParseDecimal("1.50")
+	big1 := new(big.Int).Lsh(big.NewInt(1), 70)
+	big2 := new(big.Int).Lsh(big.NewInt(1), 70)
+	m, err := persistent.NewMap(d1, 1, big1, 2, big.NewRat(1, 3), 3)
+	assert.NoError(t, err)
+	m, err = m.Assoc(d2, 4)
+	assert.NoError(t, err)
+	m, err = m.Assoc(big2, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, m.Len())
+	for k, v := range map[interface{}]interface{}{d1: 4, big2: 5, big.NewRat(2, 6): 3} {
+		got, ok := m.Get(k)
+		assert.True(t, ok, "%v", k)
+		assert.Equal(t, v, got, "%v", k)
+	}
+	_, ok := m.Get(1.5)
+	assert.False(t, ok)
+}
+
+func TestTransientMap(t *testing.T) {
+	m, _ := persistent.NewMap("a", 1)
+	tm := m.Transient()
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, tm.Assoc(int64(i), i))
+	}
+	assert.NoError(t, tm.Dissoc("a"))
+	assert.NoError(t, tm.Dissoc(int64(3)))
+	w, err := tm.Persistent()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.Len())
+	assert.Equal(t, 999, w.Len())
+	_, ok := w.Get(int64(3))
+	assert.False(t, ok)
+	assert.Equal(t, persistent.ErrTransientUsed, tm.Assoc(1, 1))
+}
+
+func TestSet(t *testing.T) {
+	s, err := persistent.NewSet(3, 1, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, s.Len())
+	assert.True(t, s.Contains(2))
+	assert.False(t, s.Contains(4))
+	assert.Equal(t, []interface{}{1, 2, 3}, s.Slice())
+	assert.Equal(t, "#{1 2 3}", s.String())
+
+	o, _ := persistent.NewSet(2, 3, 4)
+	assert.Equal(t, []interface{}{1, 2, 3, 4}, s.Union(o).Slice())
+	assert.Equal(t, []interface{}{2, 3}, s.Intersection(o).Slice())
+	assert.Equal(t, []interface{}{1}, s.Difference(o).Slice())
+	assert.False(t, s.Subset(o))
+	assert.True(t, s.Intersection(o).Subset(o))
+	assert.Equal(t, []interface{}{1, 3}, s.Disj(2).Slice())
+	assert.Equal(t, 3, s.Len())
+
+	_, err = s.Conj([]interface{}{})
+	assert.Equal(t, persistent.ErrKeyNotComparable, err)
+}
+
+func TestString(t *testing.T) {
+	s, _ := persistent.NewSet("x")
+	m, err := persistent.NewMap("b", persistent.NewVector(int64(1), "a"), "a", s)
+	assert.NoError(t, err)
+	v := persistent.NewVector(m, 1.5, nil)
+	assert.Equal(t, `[{a #{x} b [1 a]} 1.5 <nil>]`, v.String())
+	assert.Equal(t, `[{"a" #{"x"} "b" [1 "a"]} 1.5 <nil>]`, fmt.Sprintf("%#v", v))
+	assert.Equal(t, `cannot min {"a" #{"x"} "b" [1 "a"]}`, fmt.Sprintf("cannot min %#v", m))
+}
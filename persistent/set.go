@@ -0,0 +1,168 @@
+package persistent
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Set is a persistent hash set.
+type Set struct {
+	m *Map
+}
+
+// EmptySet is the set without elements.
+var EmptySet = &Set{m: EmptyMap}
+
+// NewSet returns a set with the given elements.
+func NewSet(items ...interface{}) (*Set, error) {
+	return EmptySet.Conj(items...)
+}
+
+// Len returns the number of elements in s.
+func (s *Set) Len() int {
+	return s.m.Len()
+}
+
+// Contains reports whether x is an element of s.
+func (s *Set) Contains(x interface{}) bool {
+	_, ok := s.m.Get(x)
+	return ok
+}
+
+// Conj returns s with items added.
+func (s *Set) Conj(items ...interface{}) (*Set, error) {
+	if len(items) == 0 {
+		return s, nil
+	}
+	t := s.m.Transient()
+	for _, x := range items {
+		if err := t.Assoc(x, true); err != nil {
+			return nil, err
+		}
+	}
+	m, _ := t.Persistent()
+	return &Set{m: m}, nil
+}
+
+// Disj returns s without items.
+func (s *Set) Disj(items ...interface{}) *Set {
+	if len(items) == 0 {
+		return s
+	}
+	t := s.m.Transient()
+	for _, x := range items {
+		t.Dissoc(x)
+	}
+	m, _ := t.Persistent()
+	return &Set{m: m}
+}
+
+// Range calls fn for every element of s until fn returns false.
+func (s *Set) Range(fn func(x interface{}) bool) {
+	s.m.Range(func(key, _ interface{}) bool {
+		return fn(key)
+	})
+}
+
+// Slice returns the elements of s ordered by their printed form, so that
+// the order is the same every time.
+func (s *Set) Slice() []interface{} {
+	res := make([]interface{}, 0, s.Len())
+	s.Range(func(x interface{}) bool {
+		res = append(res, x)
+		return true
+	})
+	sort.SliceStable(res, func(i, j int) bool {
+		return fmt.Sprint(res[i]) < fmt.Sprint(res[j])
+	})
+	return res
+}
+
+// Union returns the elements of s and all others.
+func (s *Set) Union(others ...*Set) *Set {
+	t := s.m.Transient()
+	for _, o := range others {
+		o.Range(func(x interface{}) bool {
+			t.Assoc(x, true)
+			return true
+		})
+	}
+	m, _ := t.Persistent()
+	return &Set{m: m}
+}
+
+// Intersection returns the elements of s that are in all others.
+func (s *Set) Intersection(others ...*Set) *Set {
+	t := s.m.Transient()
+	s.Range(func(x interface{}) bool {
+		for _, o := range others {
+			if !o.Contains(x) {
+				t.Dissoc(x)
+				break
+			}
+		}
+		return true
+	})
+	m, _ := t.Persistent()
+	return &Set{m: m}
+}
+
+// Difference returns the elements of s that are in none of others.
+func (s *Set) Difference(others ...*Set) *Set {
+	t := s.m.Transient()
+	for _, o := range others {
+		o.Range(func(x interface{}) bool {
+			t.Dissoc(x)
+			return true
+		})
+	}
+	m, _ := t.Persistent()
+	return &Set{m: m}
+}
+
+// Subset reports whether all elements of s are in o.
+func (s *Set) Subset(o *Set) bool {
+	if s.Len() > o.Len() {
+		return false
+	}
+	res := true
+	s.Range(func(x interface{}) bool {
+		res = o.Contains(x)
+		return res
+	})
+	return res
+}
+
+// String returns s as a gel literal, like #{1 2}.
+func (s *Set) String() string {
+	return literal("#{", s.Slice(), "}", fmt.Sprint)
+}
+
+// GoString is String with strings quoted, for %#v.
+func (s *Set) GoString() string {
+	return literal("#{", s.Slice(), "}", goString)
+}
+
+// literal formats items with format, separated by spaces between open
+// and close.
+func literal(open string, items []interface{}, close string, format func(...interface{}) string) string {
+	strs := make([]string, len(items))
+	for i, x := range items {
+		strs[i] = format(x)
+	}
+	return open + strings.Join(strs, " ") + close
+}
+
+// goString formats x like fmt.Sprint, but quotes strings and uses the
+// GoString method of nested vectors, maps and sets.
+func goString(args ...interface{}) string {
+	switch x := args[0].(type) {
+	case string:
+		return strconv.Quote(x)
+	case fmt.GoStringer:
+		return x.GoString()
+	}
+	return fmt.Sprint(args...)
+}
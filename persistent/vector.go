@@ -0,0 +1,320 @@
+// Package persistent implements immutable vectors, hash maps and sets with
+// structural sharing. Updates return a new version in O(log32 n) that
+// shares most of its memory with the old one, which stays unchanged.
+//
+// Transient versions allow batches of updates to be done in place and
+// are turned back into persistent ones when the batch is done.
+package persistent
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrIndexOutOfRange is returned for indexes outside of a vector.
+	ErrIndexOutOfRange = errors.New("index out of range")
+	// ErrEmpty is returned when popping an empty vector.
+	ErrEmpty = errors.New("vector is empty")
+	// ErrTransientUsed is returned when a transient is used after
+	// Persistent has been called on it.
+	ErrTransientUsed = errors.New("transient used after persistent")
+)
+
+const (
+	levelBits = 5
+	width     = 1 << levelBits
+	mask      = width - 1
+)
+
+// owner marks the nodes a transient may update in place.
+// It is not empty, as pointers to distinct zero-size values may be equal.
+type owner struct{ _ byte }
+
+type vnode struct {
+	owner *owner
+	array [width]interface{}
+}
+
+var emptyNode = &vnode{}
+
+// edit returns n if it is owned by o, otherwise a copy of n owned by o.
+func (n *vnode) edit(o *owner) *vnode {
+	if o != nil && n.owner == o {
+		return n
+	}
+	c := *n
+	c.owner = o
+	return &c
+}
+
+// Vector is a persistent vector.
+type Vector struct {
+	cnt   int
+	shift uint
+	root  *vnode
+	tail  []interface{}
+}
+
+// EmptyVector is the vector without elements.
+var EmptyVector = &Vector{shift: levelBits, root: emptyNode}
+
+// NewVector returns a vector with the given elements.
+func NewVector(items ...interface{}) *Vector {
+	t := EmptyVector.Transient()
+	for _, item := range items {
+		t.Conj(item)
+	}
+	v, _ := t.Persistent()
+	return v
+}
+
+// Len returns the number of elements in v.
+func (v *Vector) Len() int {
+	return v.cnt
+}
+
+func tailoff(cnt int) int {
+	if cnt < width {
+		return 0
+	}
+	return ((cnt - 1) >> levelBits) << levelBits
+}
+
+func arrayFor(root *vnode, shift uint, cnt int, tail []interface{}, i int) []interface{} {
+	if i >= tailoff(cnt) {
+		return tail
+	}
+	n := root
+	for level := shift; level > 0; level -= levelBits {
+		n = n.array[(i>>level)&mask].(*vnode)
+	}
+	return n.array[:]
+}
+
+// Nth returns the element at index i.
+func (v *Vector) Nth(i int) (interface{}, bool) {
+	if i < 0 || i >= v.cnt {
+		return nil, false
+	}
+	return arrayFor(v.root, v.shift, v.cnt, v.tail, i)[i&mask], true
+}
+
+// Slice returns the elements of v in a new slice.
+func (v *Vector) Slice() []interface{} {
+	res := make([]interface{}, 0, v.cnt)
+	for i := 0; i < v.cnt; i += width {
+		a := arrayFor(v.root, v.shift, v.cnt, v.tail, i)
+		n := v.cnt - i
+		if n > width {
+			n = width
+		}
+		res = append(res, a[:n]...)
+	}
+	return res
+}
+
+// String returns v as a gel literal, like [1 2].
+func (v *Vector) String() string {
+	return literal("[", v.Slice(), "]", fmt.Sprint)
+}
+
+// GoString is String with strings quoted, for %#v.
+func (v *Vector) GoString() string {
+	return literal("[", v.Slice(), "]", goString)
+}
+
+func newPath(o *owner, level uint, n *vnode) *vnode {
+	if level == 0 {
+		return n
+	}
+	ret := &vnode{owner: o}
+	ret.array[0] = newPath(o, level-levelBits, n)
+	return ret
+}
+
+func pushTail(o *owner, cnt int, level uint, parent, tailNode *vnode) *vnode {
+	subidx := ((cnt - 1) >> level) & mask
+	ret := parent.edit(o)
+	var insert *vnode
+	if level == levelBits {
+		insert = tailNode
+	} else if child, ok := parent.array[subidx].(*vnode); ok {
+		insert = pushTail(o, cnt, level-levelBits, child, tailNode)
+	} else {
+		insert = newPath(o, level-levelBits, tailNode)
+	}
+	ret.array[subidx] = insert
+	return ret
+}
+
+// conjTail moves a full tail into the tree and returns the new root and shift.
+func conjTail(o *owner, cnt int, shift uint, root *vnode, tail []interface{}) (*vnode, uint) {
+	tailNode := &vnode{owner: o}
+	copy(tailNode.array[:], tail)
+	if (cnt >> levelBits) > (1 << shift) {
+		newRoot := &vnode{owner: o}
+		newRoot.array[0] = root
+		newRoot.array[1] = newPath(o, shift, tailNode)
+		return newRoot, shift + levelBits
+	}
+	return pushTail(o, cnt, shift, root, tailNode), shift
+}
+
+// Conj returns v with x appended.
+func (v *Vector) Conj(x interface{}) *Vector {
+	if v.cnt-tailoff(v.cnt) < width {
+		tail := make([]interface{}, len(v.tail), len(v.tail)+1)
+		copy(tail, v.tail)
+		return &Vector{cnt: v.cnt + 1, shift: v.shift, root: v.root, tail: append(tail, x)}
+	}
+	root, shift := conjTail(nil, v.cnt, v.shift, v.root, v.tail)
+	return &Vector{cnt: v.cnt + 1, shift: shift, root: root, tail: []interface{}{x}}
+}
+
+func doAssoc(o *owner, level uint, n *vnode, i int, x interface{}) *vnode {
+	ret := n.edit(o)
+	if level == 0 {
+		ret.array[i&mask] = x
+		return ret
+	}
+	subidx := (i >> level) & mask
+	ret.array[subidx] = doAssoc(o, level-levelBits, n.array[subidx].(*vnode), i, x)
+	return ret
+}
+
+// Assoc returns v with the element at index i set to x.
+// An index equal to the length of v appends x.
+func (v *Vector) Assoc(i int, x interface{}) (*Vector, error) {
+	switch {
+	case i == v.cnt:
+		return v.Conj(x), nil
+	case i < 0 || i > v.cnt:
+		return nil, ErrIndexOutOfRange
+	case i >= tailoff(v.cnt):
+		tail := make([]interface{}, len(v.tail))
+		copy(tail, v.tail)
+		tail[i&mask] = x
+		return &Vector{cnt: v.cnt, shift: v.shift, root: v.root, tail: tail}, nil
+	}
+	return &Vector{cnt: v.cnt, shift: v.shift, root: doAssoc(nil, v.shift, v.root, i, x), tail: v.tail}, nil
+}
+
+func popTail(cnt int, level uint, n *vnode) *vnode {
+	subidx := ((cnt - 2) >> level) & mask
+	if level > levelBits {
+		child := popTail(cnt, level-levelBits, n.array[subidx].(*vnode))
+		if child == nil && subidx == 0 {
+			return nil
+		}
+		ret := n.edit(nil)
+		if child == nil {
+			ret.array[subidx] = nil
+		} else {
+			ret.array[subidx] = child
+		}
+		return ret
+	}
+	if subidx == 0 {
+		return nil
+	}
+	ret := n.edit(nil)
+	ret.array[subidx] = nil
+	return ret
+}
+
+// Pop returns v without its last element.
+func (v *Vector) Pop() (*Vector, error) {
+	switch {
+	case v.cnt == 0:
+		return nil, ErrEmpty
+	case v.cnt == 1:
+		return EmptyVector, nil
+	case v.cnt-tailoff(v.cnt) > 1:
+		return &Vector{cnt: v.cnt - 1, shift: v.shift, root: v.root, tail: v.tail[:len(v.tail)-1]}, nil
+	}
+	tail := arrayFor(v.root, v.shift, v.cnt, v.tail, v.cnt-2)
+	root := popTail(v.cnt, v.shift, v.root)
+	shift := v.shift
+	if root == nil {
+		root = emptyNode
+	}
+	if shift > levelBits && root.array[1] == nil {
+		root = root.array[0].(*vnode)
+		shift -= levelBits
+	}
+	return &Vector{cnt: v.cnt - 1, shift: shift, root: root, tail: tail[:width:width]}, nil
+}
+
+// Transient returns a transient copy of v.
+func (v *Vector) Transient() *TransientVector {
+	tail := make([]interface{}, len(v.tail), width)
+	copy(tail, v.tail)
+	return &TransientVector{owner: &owner{}, cnt: v.cnt, shift: v.shift, root: v.root, tail: tail}
+}
+
+// TransientVector is a vector that is updated in place.
+type TransientVector struct {
+	owner *owner
+	cnt   int
+	shift uint
+	root  *vnode
+	tail  []interface{}
+}
+
+// Len returns the number of elements in t.
+func (t *TransientVector) Len() int {
+	return t.cnt
+}
+
+// Nth returns the element at index i.
+func (t *TransientVector) Nth(i int) (interface{}, bool) {
+	if i < 0 || i >= t.cnt {
+		return nil, false
+	}
+	return arrayFor(t.root, t.shift, t.cnt, t.tail, i)[i&mask], true
+}
+
+// Conj appends x to t.
+func (t *TransientVector) Conj(x interface{}) error {
+	if t.owner == nil {
+		return ErrTransientUsed
+	}
+	if t.cnt-tailoff(t.cnt) >= width {
+		t.root, t.shift = conjTail(t.owner, t.cnt, t.shift, t.root, t.tail)
+		t.tail = make([]interface{}, 0, width)
+	}
+	t.tail = append(t.tail, x)
+	t.cnt++
+	return nil
+}
+
+// Assoc sets the element at index i to x.
+// An index equal to the length of t appends x.
+func (t *TransientVector) Assoc(i int, x interface{}) error {
+	switch {
+	case t.owner == nil:
+		return ErrTransientUsed
+	case i == t.cnt:
+		return t.Conj(x)
+	case i < 0 || i > t.cnt:
+		return ErrIndexOutOfRange
+	case i >= tailoff(t.cnt):
+		t.tail[i&mask] = x
+		return nil
+	}
+	t.root = doAssoc(t.owner, t.shift, t.root, i, x)
+	return nil
+}
+
+// Persistent returns the persistent vector with the contents of t.
+// t may not be used afterwards.
+func (t *TransientVector) Persistent() (*Vector, error) {
+	if t.owner == nil {
+		return nil, ErrTransientUsed
+	}
+	t.owner = nil
+	tail := make([]interface{}, len(t.tail))
+	copy(tail, t.tail)
+	return &Vector{cnt: t.cnt, shift: t.shift, root: t.root, tail: tail}, nil
+}
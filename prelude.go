@@ -0,0 +1,72 @@
+package gel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Stromberg/gel/module"
+)
+
+// preludeScope returns the read-only scope with the functions and scripts
+// of the modules in repo. The scope is kept in repo and built again if
+// modules have been registered in repo since it was last built.
+func preludeScope(repo *module.Repo) (*Scope, error) {
+	prelude, err := repo.Prelude(func(modules []*module.Module) (interface{}, error) {
+		return newPrelude(repo, modules)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prelude.(*Scope), nil
+}
+
+func newPrelude(repo *module.Repo, modules []*module.Module) (*Scope, error) {
+	fset := NewFileSet()
+
+	vars := make(map[string]interface{})
+
+	for _, m := range modules {
+		for _, f := range m.Funcs {
+			vars[f.Name] = f.F
+		}
+	}
+
+	scope := &Scope{fset: fset, vars: vars, repo: repo}
+
+	for _, m := range modules {
+		for _, f := range m.LispFuncs {
+			expr := fmt.Sprintf("(var %s %s)", f.Name, f.F)
+			// (func name [args...] stmts) names the function in its
+			// errors, unlike (var name (func [args...] stmts)).
+			for _, head := range []string{"(func [", "(fn ["} {
+				if strings.HasPrefix(f.F, head) {
+					expr = fmt.Sprintf("%s%s %s", head[:len(head)-1], f.Name, f.F[len(head)-1:])
+				}
+			}
+			node, err := ParseString(fset, fmt.Sprintf("%v:%v", m.Name, f.Name), expr)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = scope.eval(node)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, s := range m.Scripts {
+			node, err := ParseString(fset, fmt.Sprintf("%v:%v", m.Name, s.Name), s.Source)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = scope.eval(node)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	scope.readOnly = true
+	return scope, nil
+}
@@ -0,0 +1,339 @@
+package re
+
+import (
+	lru "container/list"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/utils"
+)
+
+// Module holds the regular expression functions. Patterns are
+// *regexp.Regexp values using the Go syntax, and all functions taking a
+// pattern also take its source string.
+var Module = &module.Module{
+	Name: "re",
+	Funcs: []*module.Func{
+		&module.Func{
+			Name:        "re/compile",
+			Signature:   "(re/compile s)",
+			Description: "Compiles the regular expression s. Compiled patterns are cached by s.",
+			F:           utils.ErrFunc(compile, utils.CheckArity(1)),
+		},
+		&module.Func{
+			Name:        "re/pattern?",
+			Signature:   "(re/pattern? v)",
+			Description: "Checks if v is a compiled pattern.",
+			F:           utils.ErrFunc(isPattern, utils.CheckArity(1)),
+		},
+		&module.Func{
+			Name:        "re/quote",
+			Signature:   "(re/quote s)",
+			Description: "Escapes all regular expression metacharacters in s, giving a pattern matching s literally.",
+			F:           utils.ErrFunc(quote, utils.CheckArity(1)),
+		},
+		&module.Func{
+			Name:        "re/match?",
+			Signature:   "(re/match? p s)",
+			Description: "Checks if the pattern p matches anywhere in s. Use ^ and $ to match all of s.",
+			F:           utils.ErrFunc(match, utils.CheckArity(2)),
+		},
+		&module.Func{
+			Name:        "re/find",
+			Signature:   "(re/find p s)",
+			Description: "Returns the first match of p in s, or nil.",
+			F:           utils.ErrFunc(find, utils.CheckArity(2)),
+		},
+		&module.Func{
+			Name:        "re/find-all",
+			Signature:   "(re/find-all p s) or (re/find-all p s n)",
+			Description: "Returns a list of all matches of p in s, or at most n.",
+			F:           utils.ErrFunc(findAll, utils.CheckArityAtLeast(2)),
+		},
+		&module.Func{
+			Name:        "re/groups",
+			Signature:   "(re/groups p s)",
+			Description: "Returns the first match of p in s followed by its capture groups as a list, or nil. Groups that did not match are nil.",
+			F:           utils.ErrFunc(groups, utils.CheckArity(2)),
+		},
+		&module.Func{
+			Name:        "re/groups-all",
+			Signature:   "(re/groups-all p s) or (re/groups-all p s n)",
+			Description: "Returns a list with the lists of re/groups for all matches of p in s, or at most n.",
+			F:           utils.ErrFunc(groupsAll, utils.CheckArityAtLeast(2)),
+		},
+		&module.Func{
+			Name:        "re/named-groups",
+			Signature:   "(re/named-groups p s)",
+			Description: "Returns a dict from keywords of the named groups (?P<name>...) of p to what they matched in the first match in s, or nil.",
+			F:           utils.ErrFunc(namedGroups, utils.CheckArity(2)),
+		},
+		&module.Func{
+			Name:        "re/replace",
+			Signature:   "(re/replace p s r)",
+			Description: "Replaces all matches of p in s with r. A string r may refer to groups as $1 or ${name}.\nA function r is called with the match followed by its groups and returns the replacement.",
+			F:           utils.ErrFunc(replace, utils.CheckArity(3)),
+		},
+		&module.Func{
+			Name:        "re/split",
+			Signature:   "(re/split p s) or (re/split p s n)",
+			Description: "Splits s at each match of p into a list. With n at most n parts are returned, the last one unsplit.",
+			F:           utils.ErrFunc(split, utils.CheckArityAtLeast(2)),
+		},
+	},
+}
+
+// CacheSize is the number of patterns kept by Compile.
+const CacheSize = 256
+
+// cache keeps the patterns compiled last, so that patterns given as strings
+// are not compiled again at every call.
+var cache = struct {
+	sync.Mutex
+	// order holds the *cached patterns, the most recently used first.
+	order    *lru.List
+	patterns map[string]*lru.Element
+}{order: lru.New(), patterns: map[string]*lru.Element{}}
+
+type cached struct {
+	src string
+	p   *regexp.Regexp
+}
+
+// cachedPattern returns the pattern compiled for s, if it is cached.
+func cachedPattern(s string) (*regexp.Regexp, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+	e, ok := cache.patterns[s]
+	if !ok {
+		return nil, false
+	}
+	cache.order.MoveToFront(e)
+	return e.Value.(*cached).p, true
+}
+
+// Compile compiles the regular expression s, or returns the pattern
+// compiled for s before if it is one of the last CacheSize used.
+func Compile(s string) (*regexp.Regexp, error) {
+	if p, ok := cachedPattern(s); ok {
+		return p, nil
+	}
+	// Patterns are compiled without holding the lock, the same pattern may
+	// then be compiled twice at the same time.
+	p, err := regexp.Compile(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+	if e, ok := cache.patterns[s]; ok {
+		cache.order.MoveToFront(e)
+		return e.Value.(*cached).p, nil
+	}
+	cache.patterns[s] = cache.order.PushFront(&cached{src: s, p: p})
+	if cache.order.Len() > CacheSize {
+		last := cache.order.Back()
+		cache.order.Remove(last)
+		delete(cache.patterns, last.Value.(*cached).src)
+	}
+	return p, nil
+}
+
+func toPattern(v interface{}) (*regexp.Regexp, error) {
+	switch v := v.(type) {
+	case *regexp.Regexp:
+		return v, nil
+	case string:
+		return Compile(v)
+	}
+	return nil, fmt.Errorf("expected a pattern, got %#v", v)
+}
+
+// patternAndString returns the pattern and string arguments of most functions.
+func patternAndString(args []interface{}) (*regexp.Regexp, string, error) {
+	p, err := toPattern(args[0])
+	if err != nil {
+		return nil, "", err
+	}
+	s, ok := args[1].(string)
+	if !ok {
+		return nil, "", utils.ErrParameterType
+	}
+	return p, s, nil
+}
+
+// limit returns the optional maximum number of results in args[2], -1 for all.
+func limit(args []interface{}) (int, error) {
+	switch len(args) {
+	case 2:
+		return -1, nil
+	case 3:
+		if n, ok := args[2].(int64); ok {
+			return int(n), nil
+		}
+		return 0, utils.ErrParameterType
+	}
+	return 0, utils.ErrWrongNumberPar
+}
+
+func list(strs []string) []interface{} {
+	res := make([]interface{}, len(strs))
+	for i, s := range strs {
+		res[i] = s
+	}
+	return res
+}
+
+// submatches returns the match and groups at loc in s, with nil for
+// groups that did not match.
+func submatches(s string, loc []int) []interface{} {
+	res := make([]interface{}, len(loc)/2)
+	for i := range res {
+		if loc[2*i] >= 0 {
+			res[i] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return res
+}
+
+func compile(args ...interface{}) (interface{}, error) {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return Compile(s)
+}
+
+func isPattern(args ...interface{}) (interface{}, error) {
+	_, ok := args[0].(*regexp.Regexp)
+	return ok, nil
+}
+
+func quote(args ...interface{}) (interface{}, error) {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	return regexp.QuoteMeta(s), nil
+}
+
+func match(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	return p.MatchString(s), nil
+}
+
+func find(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	loc := p.FindStringIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	return s[loc[0]:loc[1]], nil
+}
+
+func findAll(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := limit(args)
+	if err != nil {
+		return nil, err
+	}
+	return list(p.FindAllString(s, n)), nil
+}
+
+func groups(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	loc := p.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	return submatches(s, loc), nil
+}
+
+func groupsAll(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := limit(args)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for _, loc := range p.FindAllStringSubmatchIndex(s, n) {
+		res = append(res, submatches(s, loc))
+	}
+	return res, nil
+}
+
+func namedGroups(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	loc := p.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, nil
+	}
+	groups := submatches(s, loc)
+	res := map[interface{}]interface{}{}
+	for i, name := range p.SubexpNames() {
+		if name != "" {
+			res[utils.Keyword(name)] = groups[i]
+		}
+	}
+	return res, nil
+}
+
+func replace(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := args[2].(string); ok {
+		return p.ReplaceAllString(s, r), nil
+	}
+
+	res := []byte{}
+	last := 0
+	for _, loc := range p.FindAllStringSubmatchIndex(s, -1) {
+		v, err := utils.Call(args[2], submatches(s, loc)...)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("replace function returned %#v, expected a string", v)
+		}
+		res = append(res, s[last:loc[0]]...)
+		res = append(res, r...)
+		last = loc[1]
+	}
+	return string(append(res, s[last:]...)), nil
+}
+
+func split(args ...interface{}) (interface{}, error) {
+	p, s, err := patternAndString(args)
+	if err != nil {
+		return nil, err
+	}
+	n, err := limit(args)
+	if err != nil {
+		return nil, err
+	}
+	return list(p.Split(s, n)), nil
+}
@@ -0,0 +1,81 @@
+package re_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Stromberg/gel"
+	"github.com/Stromberg/gel/re"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReModule(t *testing.T) {
+	test := func(expr string, expected interface{}) {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		assert.NotNil(t, g)
+		s, err := g.Eval(gel.NewEnv())
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, s, expr)
+	}
+
+	test(`(re/pattern? (re/compile "a+"))`, true)
+	test(`(re/pattern? "a+")`, false)
+	test(`[(re/match? "^[A-Z]{3}-\\d+$" "ABC-12") (re/match? (re/compile "^[A-Z]{3}-\\d+$") "AB-12")]`, []interface{}{true, false})
+	test(`[(re/find "\\d+" "ab 12 cd 34") (re/find "\\d+" "abcd")]`, []interface{}{"12", nil})
+	test(`(re/find-all "\\d+" "ab 12 cd 34")`, []interface{}{"12", "34"})
+	test(`(re/find-all "\\d+" "ab 12 cd 34" 1)`, []interface{}{"12"})
+	test(`(re/find-all "\\d+" "abcd")`, []interface{}{})
+	test(`(re/groups "(\\w+)-(\\d+)?" "id ABC-")`, []interface{}{"ABC-", "ABC", nil})
+	test(`(re/groups-all "(\\w)(\\d)" "a1 b2")`, []interface{}{[]interface{}{"a1", "a", "1"}, []interface{}{"b2", "b", "2"}})
+	test(`(:year (re/named-groups "(?P<year>\\d{4})-(?P<month>\\d{2})" "on 2020-05"))`, "2020")
+	test(`(re/named-groups "(?P<year>\\d{4})" "never")`, nil)
+	test(`(re/replace "(\\w+)@(\\w+)" "joe@home" "$2 of $1")`, "home of joe")
+	test(`(re/replace "\\d+" "a1 b22" (func [m] (str (* 2 (int m)))))`, "a2 b44")
+	test(`(re/replace "(\\w)(\\d)" "a1 b2" (func [m l d] (sprintf "%s%s" d l)))`, "1a 2b")
+	test(`(re/split "\\s*,\\s*" "a , b,c")`, []interface{}{"a", "b", "c"})
+	test(`(re/split "," "a,b,c" 2)`, []interface{}{"a", "b,c"})
+	test(`(re/match? (re/quote "a.b") "axb")`, false)
+
+	for _, expr := range []string{
+		`(re/compile "(")`,
+		`(re/find 1 "a")`,
+		`(re/find "a" 1)`,
+		`(re/replace "a" "aa" (func [m] 1))`,
+		`(re/replace "a" "aa" (func [m] (error "no")))`,
+		`(re/split "," "a,b" "x")`,
+	} {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		_, err = g.Eval(gel.NewEnv())
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCompileCache(t *testing.T) {
+	p, err := re.Compile("a+b")
+	assert.NoError(t, err)
+	q, err := re.Compile("a+b")
+	assert.NoError(t, err)
+	assert.True(t, p == q)
+	_, err = re.Compile("a(")
+	assert.Error(t, err)
+}
+
+func TestCompileCacheBound(t *testing.T) {
+	p, err := re.Compile("c+d")
+	assert.NoError(t, err)
+	for i := 0; i < re.CacheSize; i++ {
+		_, err = re.Compile(fmt.Sprintf("x%d", i))
+		assert.NoError(t, err)
+		// Used patterns stay cached.
+		q, _ := re.Compile("c+d")
+		assert.True(t, p == q)
+	}
+	for i := 0; i < re.CacheSize; i++ {
+		re.Compile(fmt.Sprintf("y%d", i))
+	}
+	q, err := re.Compile("c+d")
+	assert.NoError(t, err)
+	assert.False(t, p == q)
+}
@@ -0,0 +1,199 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/utils"
+)
+
+// namespace holds the symbols defined by a file loaded with require.
+type namespace struct {
+	name string
+	vars map[string]interface{}
+}
+
+// requireCache holds the files loaded with require during an evaluation.
+// The loaded files are shared by the scopes of the evaluation and of the
+// loaded files, loading is the chain of files being loaded by a scope.
+type requireCache struct {
+	mu      *sync.Mutex
+	loaded  map[string]*loadedFile
+	loading []string
+}
+
+// loadedFile is a file loaded with require. done is closed once the file
+// is evaluated, the scopes requiring it meanwhile wait for it.
+type loadedFile struct {
+	done chan struct{}
+	ns   *namespace
+	err  error
+}
+
+// root returns the scope s was branched from.
+func (s *Scope) root() *Scope {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// requires returns the require cache of the evaluation s belongs to.
+func (s *Scope) requires() *requireCache {
+	root := s.root()
+	defer root.unlockScopes(root.lockScopes())
+	if root.required == nil {
+		root.required = &requireCache{mu: &sync.Mutex{}, loaded: make(map[string]*loadedFile)}
+	}
+	return root.required
+}
+
+// load evaluates file, relative to module.BasePath, in a scope of its own.
+// A file is evaluated only once, later loads return the cached namespace
+// and loads during its evaluation wait for it. A file that fails to load
+// is loaded again by the next load.
+func (r *requireCache) load(scope *Scope, file string) (*namespace, error) {
+	realPath := path.Join(module.BasePath, file)
+	for _, p := range r.loading {
+		if p == realPath {
+			return nil, fmt.Errorf("require cycle: %s -> %s", strings.Join(r.loading, " -> "), realPath)
+		}
+	}
+
+	r.mu.Lock()
+	f, ok := r.loaded[realPath]
+	if !ok {
+		f = &loadedFile{done: make(chan struct{})}
+		r.loaded[realPath] = f
+	}
+	r.mu.Unlock()
+	if ok {
+		select {
+		case <-f.done:
+			return f.ns, f.err
+		case <-done(scope):
+			return nil, scope.state.ctx.Err()
+		}
+	}
+
+	f.ns, f.err = r.eval(scope, file, realPath)
+	if f.err != nil {
+		r.mu.Lock()
+		delete(r.loaded, realPath)
+		r.mu.Unlock()
+	}
+	close(f.done)
+	return f.ns, f.err
+}
+
+// eval evaluates the file at realPath and returns its namespace.
+func (r *requireCache) eval(scope *Scope, file, realPath string) (*namespace, error) {
+	data, err := ioutil.ReadFile(realPath)
+	if err != nil {
+		return nil, err
+	}
+	node, err := ParseString(scope.fset, file, string(data))
+	if err != nil {
+		return nil, err
+	}
+	// The builtins shadowed by the limits are kept in the root scope of
+	// the file, so that only the vars the file defines are exported.
+	root, err := NewScopeWithRepo(scope.fset, scope.Repo())
+	if err != nil {
+		return nil, err
+	}
+	root.state = scope.state
+	limitScope(root)
+	root.required = &requireCache{mu: r.mu, loaded: r.loaded, loading: append(r.loading[:len(r.loading):len(r.loading)], realPath)}
+	root.stdOutRedirect = scope.root().stdOutRedirect
+
+	s := root.Branch()
+	if _, err = s.eval(node); err != nil {
+		return nil, err
+	}
+
+	name := root.ns
+	if name == "" {
+		name = baseName(file)
+	}
+	return &namespace{name: name, vars: s.vars}, nil
+}
+
+// baseName returns the name of file without directory and extension, the
+// namespace of a file without ns.
+func baseName(file string) string {
+	return strings.TrimSuffix(path.Base(file), path.Ext(file))
+}
+
+// requireAlias returns the alias the symbols required by the arguments
+// of require are bound with, or "" if it is not known before evaluation.
+func requireAlias(args []ast.Node) string {
+	if len(args) == 3 {
+		if symbol, ok := args[2].(*ast.Symbol); ok {
+			return symbol.Name
+		}
+	}
+	if file, ok := args[0].(*ast.String); ok && len(args) == 1 {
+		return baseName(file.Value)
+	}
+	return ""
+}
+
+func nsFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 1 {
+		return nil, errors.New("ns takes a symbol")
+	}
+	symbol, ok := args[0].(*ast.Symbol)
+	if !ok {
+		return nil, errors.New("ns takes a symbol")
+	}
+	name := symbol.Name
+	return func(scope *Scope) (interface{}, error) {
+		scope.root().ns = name
+		return nil, nil
+	}, nil
+}
+
+func requireFn(c *compiler, args []ast.Node) (code, error) {
+	if len(args) != 1 && len(args) != 3 {
+		return nil, errors.New(`require takes a file name and an optional :as alias`)
+	}
+	var alias string
+	if len(args) == 3 {
+		symbol, ok := args[2].(*ast.Symbol)
+		if !ok || !isKey(args[1], "as") {
+			return nil, errors.New(`require takes a file name and an optional :as alias`)
+		}
+		alias = symbol.Name
+	}
+	file := c.compile(args[0])
+
+	return func(scope *Scope) (interface{}, error) {
+		r, err := file(scope)
+		if err != nil {
+			return nil, err
+		}
+		file, ok := r.(string)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		ns, err := scope.requires().load(scope, file)
+		if err != nil {
+			return nil, err
+		}
+		prefix := alias
+		if prefix == "" {
+			prefix = ns.name
+		}
+		for name, v := range ns.vars {
+			scope.SetOrCreate(prefix+"/"+name, v)
+		}
+		return nil, nil
+	}, nil
+}
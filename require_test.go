@@ -0,0 +1,96 @@
+package gel_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Stromberg/gel"
+	"github.com/Stromberg/gel/module"
+	"github.com/stretchr/testify/assert"
+)
+
+func withFiles(t *testing.T, files map[string]string) func() {
+	dir, err := ioutil.TempDir("", "gel")
+	assert.NoError(t, err)
+	for name, code := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0644))
+	}
+	basePath := module.BasePath
+	module.BasePath = dir
+	return func() {
+		module.BasePath = basePath
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	defer withFiles(t, map[string]string{
+		"util.gel":  `(ns util) (printf "loaded\n") (var scale 2) (func double [x] (* scale x))`,
+		"stats.gel": `(require "util.gel") (func quad [x] (util/double (util/double x)))`,
+	})()
+
+	g, err := gel.New(`(require "util.gel" :as u) (require "stats.gel") (require "util.gel") [(u/double 3) (stats/quad 1) util/scale]`)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	g.RedirectStdOut(&out)
+	r, err := g.Eval(gel.NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(6), int64(4), int64(2)}, r)
+	assert.Equal(t, "loaded\n", out.String())
+}
+
+func TestRequireCycle(t *testing.T) {
+	defer withFiles(t, map[string]string{
+		"a.gel": `(require "b.gel")`,
+		"b.gel": `(require "a.gel")`,
+	})()
+
+	g, err := gel.New(`(require "a.gel")`)
+	assert.NoError(t, err)
+	_, err = g.Eval(gel.NewEnv())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "require cycle: ")
+	assert.Contains(t, err.Error(), "a.gel -> ")
+	assert.Contains(t, err.Error(), "b.gel -> ")
+}
+
+func TestRequireExports(t *testing.T) {
+	defer withFiles(t, map[string]string{
+		"util.gel": `(var x 1) (var cycle 2)`,
+	})()
+
+	g, err := gel.New(`(require "util.gel" :as u) [u/x u/cycle]`)
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxAlloc: 100})
+	r, err := g.Eval(gel.NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(2)}, r)
+
+	for _, name := range []string{"u/lazy-range", "u/iterate", "u/range", "u/repeat"} {
+		g, err = gel.New(`(require "util.gel" :as u) ` + name)
+		assert.NoError(t, err)
+		g.SetLimits(gel.Limits{MaxAlloc: 100})
+		_, err = g.Eval(gel.NewEnv())
+		assert.EqualError(t, err, "twik source:1:28: undefined symbol: "+name)
+	}
+}
+
+func TestRequireConcurrent(t *testing.T) {
+	defer withFiles(t, map[string]string{
+		"util.gel": `(printf "loaded\n") (var n 0) (while (< n 10000) (set n (inc n))) (var x 1)`,
+	})()
+
+	g, err := gel.New(`
+(var chs (map (fn [i] (go (fn [] (require "util.gel") util/x))) [1 2 3 4 5 6 7 8]))
+(reduce + (map (fn [c] (take! c)) chs))`)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	g.RedirectStdOut(&out)
+	r, err := g.Eval(gel.NewEnv())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), r)
+	assert.Equal(t, "loaded\n", out.String())
+}
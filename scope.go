@@ -7,13 +7,13 @@
 package gel
 
 import (
+	"context"
 	"fmt"
 	"io"
-	"runtime/debug"
+	"strings"
 
 	"github.com/Stromberg/gel/ast"
 	"github.com/Stromberg/gel/module"
-	"github.com/Stromberg/gel/utils"
 )
 
 // Scope is an environment where twik logic may be evaluated in.
@@ -21,6 +21,14 @@ type Scope struct {
 	parent         *Scope
 	fset           *ast.FileSet
 	vars           map[string]interface{}
+	base           map[string]interface{}
+	frame          *frame
+	slots          []interface{}
+	state          *evalState
+	repo           *module.Repo
+	required       *requireCache
+	ns             string
+	readOnly       bool
 	stdOutRedirect io.Writer
 }
 
@@ -28,54 +36,94 @@ type Scope struct {
 type Error struct {
 	Err     error
 	PosInfo *ast.PosInfo
+	// Stack is the gel call stack of the error, innermost frame first.
+	// It holds at most MaxStack frames: the innermost half and the
+	// outermost ones, with Elided frames left out in between.
+	Stack  []Frame
+	Elided int
+	// GoStack is the Go stack of a recovered panic. It is only set
+	// when debugging is enabled with Gel.SetDebug.
+	GoStack string
 }
 
-func (e *Error) Error() string {
-	return fmt.Sprintf("%s %v", e.PosInfo, e.Err)
-}
+// MaxStack is the maximum number of frames in the Stack of an Error, which
+// keeps deep recursions from making errors costly.
+const MaxStack = 100
 
-// NewScope returns a new scope for evaluating logic that was parsed into fset.
-func NewScope(fset *ast.FileSet) (*Scope, error) {
-	modules := module.Modules()
-
-	vars := make(map[string]interface{})
+// Frame is an entry in the call stack of an Error.
+type Frame struct {
+	// Func is the name of the function the frame is in. It is
+	// "anonymous function" for functions without a name and
+	// empty for code outside of functions.
+	Func    string
+	PosInfo *ast.PosInfo
+}
 
-	for _, m := range modules {
-		for _, f := range m.Funcs {
-			vars[f.Name] = f.F
-		}
+func (f Frame) String() string {
+	pos := strings.TrimSuffix(f.PosInfo.String(), ":")
+	if f.Func == "" {
+		return pos
 	}
+	return fmt.Sprintf("%s in %s", pos, f.Func)
+}
 
-	scope := &Scope{fset: fset, vars: vars}
-
-	for _, m := range modules {
-		for _, f := range m.LispFuncs {
-			expr := fmt.Sprintf("(var %s %s)", f.Name, f.F)
-			node, err := ParseString(fset, fmt.Sprintf("%v:%v", m.Name, f.Name), expr)
-			if err != nil {
-				return nil, err
-			}
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %v", e.PosInfo, e.Err)
+}
 
-			_, err = scope.Eval(node)
-			if err != nil {
-				return nil, err
+// Format implements fmt.Formatter. The %+v verb formats the error
+// followed by its call stack, like a traceback:
+//
+//	twik source:2:13: undefined symbol: y
+//	    at twik source:2:13 in f
+//	    at twik source:3:2
+func (e *Error) Format(f fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && f.Flag('+'):
+		io.WriteString(f, e.Error())
+		for i, frame := range e.Stack {
+			if i == MaxStack/2 && e.Elided > 0 {
+				fmt.Fprintf(f, "\n    ... %d frames elided", e.Elided)
 			}
+			fmt.Fprintf(f, "\n    at %s", frame)
+		}
+		if e.GoStack != "" {
+			fmt.Fprintf(f, "\n\n%s", e.GoStack)
 		}
+	case verb == 'q':
+		fmt.Fprintf(f, "%q", e.Error())
+	default:
+		io.WriteString(f, e.Error())
+	}
+}
 
-		for _, s := range m.Scripts {
-			node, err := ParseString(fset, fmt.Sprintf("%v:%v", m.Name, s.Name), s.Source)
-			if err != nil {
-				return nil, err
-			}
+// NewScope returns a new scope for evaluating logic that was parsed into fset.
+// The scope contains the modules registered in module.DefaultRepo.
+func NewScope(fset *ast.FileSet) (*Scope, error) {
+	return NewScopeWithRepo(fset, module.DefaultRepo)
+}
 
-			_, err = scope.Eval(node)
-			if err != nil {
-				return nil, err
-			}
-		}
+// NewScopeWithRepo returns a new scope for evaluating logic that was parsed into fset.
+// The scope contains the modules in repo.
+//
+// The functions and scripts of the modules are evaluated once per repo into
+// a read-only prelude scope that is shared by all scopes created from it.
+func NewScopeWithRepo(fset *ast.FileSet, repo *module.Repo) (*Scope, error) {
+	prelude, err := preludeScope(repo)
+	if err != nil {
+		return nil, err
 	}
+	return &Scope{fset: fset, base: prelude.vars, repo: repo, state: newEvalState(context.Background(), Limits{})}, nil
+}
 
-	return scope, nil
+// Repo returns the module.Repo the scope was created with.
+func (s *Scope) Repo() *module.Repo {
+	for ; s != nil; s = s.parent {
+		if s.repo != nil {
+			return s.repo
+		}
+	}
+	return module.DefaultRepo
 }
 
 func (s *Scope) RedirectStdOut(writer io.Writer) {
@@ -101,9 +149,19 @@ func (s *Scope) Printf(format string, args ...interface{}) error {
 // Create defines a new symbol with the given value in the s scope.
 // It is an error to redefine an existent symbol.
 func (s *Scope) Create(symbol string, value interface{}) error {
+	defer s.unlockScopes(s.lockScopes())
+	if s.readOnly {
+		return fmt.Errorf("cannot define symbol in read-only scope: %s", symbol)
+	}
 	if _, ok := s.vars[symbol]; ok {
 		return fmt.Errorf("symbol already defined in current scope: %s", symbol)
 	}
+	if s.frame != nil && s.frame.index(symbol) >= 0 {
+		return fmt.Errorf("symbol already defined in current scope: %s", symbol)
+	}
+	if _, ok := s.base[symbol]; ok {
+		return fmt.Errorf("symbol already defined in current scope: %s", symbol)
+	}
 	if s.vars == nil {
 		s.vars = make(map[string]interface{})
 	}
@@ -119,9 +177,28 @@ func (s *Scope) SetOrCreate(symbol string, value interface{}) {
 
 // Set sets symbol to the given value in the shallowest scope it is defined in.
 // It is an error to set an undefined symbol.
+//
+// Symbols in the shared base of a scope are copied on write.
 func (s *Scope) Set(symbol string, value interface{}) error {
+	defer s.unlockScopes(s.lockScopes())
 	for s != nil {
 		if _, ok := s.vars[symbol]; ok {
+			if s.readOnly {
+				return fmt.Errorf("cannot set symbol in read-only scope: %s", symbol)
+			}
+			s.vars[symbol] = value
+			return nil
+		}
+		if s.frame != nil {
+			if i := s.frame.index(symbol); i >= 0 {
+				s.slots[i] = value
+				return nil
+			}
+		}
+		if _, ok := s.base[symbol]; ok {
+			if s.vars == nil {
+				s.vars = make(map[string]interface{})
+			}
 			s.vars[symbol] = value
 			return nil
 		}
@@ -133,10 +210,19 @@ func (s *Scope) Set(symbol string, value interface{}) error {
 // Get returns the value of symbol in the shallowest scope it is defined in.
 // It is an error to get the value of an undefined symbol.
 func (s *Scope) Get(symbol string) (value interface{}, err error) {
+	defer s.runlockScopes(s.rlockScopes())
 	for s != nil {
 		if value, ok := s.vars[symbol]; ok {
 			return value, nil
 		}
+		if s.frame != nil {
+			if i := s.frame.index(symbol); i >= 0 {
+				return s.slots[i], nil
+			}
+		}
+		if value, ok := s.base[symbol]; ok {
+			return value, nil
+		}
 		s = s.parent
 	}
 	return nil, fmt.Errorf("undefined symbol: %s", symbol)
@@ -144,108 +230,36 @@ func (s *Scope) Get(symbol string) (value interface{}, err error) {
 
 // Branch returns a new scope that has s as a parent.
 func (s *Scope) Branch() *Scope {
-	return &Scope{parent: s, fset: s.fset}
+	return &Scope{parent: s, fset: s.fset, state: s.state}
 }
 
 var emptyList = make([]interface{}, 0)
-var emptyDict = make(map[interface{}]interface{}, 0)
 
 func (s *Scope) errorAt(node ast.Node, err error) error {
-	if _, ok := err.(*Error); ok {
-		return err
-	}
-	return &Error{err, s.fset.PosInfo(node.Pos())}
+	return errorAt(s.fset, node, err)
 }
 
 func (s *Scope) Code(node ast.Node) string {
 	return s.fset.Code(node)
 }
 
-// Eval evaluates node in the s scope and returns the resulting value.
+// Eval evaluates node in the s scope and returns the resulting value,
+// converted like the value of Program.Eval.
+// The node is compiled before it is evaluated, use Compile to
+// evaluate the same node several times.
 func (s *Scope) Eval(node ast.Node) (value interface{}, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = s.errorAt(node, fmt.Errorf("%v\n%v", r, string(debug.Stack())))
-		}
-	}()
-
-	switch node := node.(type) {
-	case *ast.Symbol:
-		value, err := s.Get(node.Name)
-		if err != nil {
-			return nil, s.errorAt(node, err)
-		}
-		return value, nil
-	case *ast.Int:
-		return node.Value, nil
-	case *ast.Float:
-		return node.Value, nil
-	case *ast.String:
-		return node.Value, nil
-	case *ast.List:
-		if len(node.Nodes) == 0 {
-			return emptyList, nil
-		}
-		fn, err := s.Eval(node.Nodes[0])
-		if err != nil {
-			return nil, s.errorAt(node.Nodes[0], err)
-		}
-		value, err := s.call(fn, node.Nodes[1:])
-		if err != nil {
-			return nil, s.errorAt(node.Nodes[0], err)
-		}
-		return value, nil
-	case *ast.ListList:
-		if len(node.Nodes) == 0 {
-			return emptyList, nil
-		}
-		vargs := make([]interface{}, len(node.Nodes))
-		for i, arg := range node.Nodes {
-			value, err := s.Eval(arg)
-			if err != nil {
-				return nil, err
-			}
-			vargs[i] = value
-		}
-		return utils.NewList(vargs...)
-	case *ast.DictList:
-		if len(node.Nodes) == 0 {
-			return emptyDict, nil
-		}
-		vargs := make([]interface{}, len(node.Nodes))
-		for i, arg := range node.Nodes {
-			value, err := s.Eval(arg)
-			if err != nil {
-				return nil, err
-			}
-			vargs[i] = value
-		}
-		return utils.NewDict(vargs...)
-	case *ast.Root:
-		for _, node := range node.Nodes {
-			value, err = s.Eval(node)
-			if err != nil {
-				return nil, s.errorAt(node, err)
-			}
-		}
-		return value, nil
+	value, err = s.eval(node)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("support for %#v not yet implemeted", node)
+	return plain(value), nil
 }
 
-func (s *Scope) call(fn interface{}, args []ast.Node) (value interface{}, err error) {
-	if fn, ok := fn.(func(*Scope, []ast.Node) (interface{}, error)); ok {
-		return fn(s, args)
+// eval is Eval for code evaluated by gel code, the value is not converted.
+func (s *Scope) eval(node ast.Node) (value interface{}, err error) {
+	p, err := s.Compile(node)
+	if err != nil {
+		return nil, err
 	}
-
-	vargs := make([]interface{}, len(args))
-	for i, arg := range args {
-		value, err := s.Eval(arg)
-		if err != nil {
-			return nil, err
-		}
-		vargs[i] = value
-	}
-
-	return utils.Call(fn, vargs...)
+	return p.eval(s)
 }
@@ -0,0 +1,110 @@
+package sets
+
+import (
+	"github.com/Stromberg/gel/module"
+	"github.com/Stromberg/gel/persistent"
+	"github.com/Stromberg/gel/utils"
+)
+
+// Module holds the set functions.
+var Module = &module.Module{
+	Name: "sets",
+	Funcs: []*module.Func{
+		&module.Func{
+			Name:        "sets/union",
+			Signature:   "(sets/union s...)",
+			Description: "Returns the elements that are in any of the sets.",
+			F:           utils.ErrFunc(union, utils.CheckArityAtLeast(1)),
+		},
+		&module.Func{
+			Name:        "sets/intersection",
+			Signature:   "(sets/intersection s...)",
+			Description: "Returns the elements that are in all of the sets.",
+			F:           utils.ErrFunc(intersection, utils.CheckArityAtLeast(1)),
+		},
+		&module.Func{
+			Name:        "sets/difference",
+			Signature:   "(sets/difference s t...)",
+			Description: "Returns the elements of s that are in none of the sets t.",
+			F:           utils.ErrFunc(difference, utils.CheckArityAtLeast(1)),
+		},
+		&module.Func{
+			Name:        "sets/subset?",
+			Signature:   "(sets/subset? s t)",
+			Description: "Checks if all elements of s are in t.",
+			F:           utils.ErrFunc(subset, utils.CheckArity(2)),
+		},
+		&module.Func{
+			Name:        "sets/conj",
+			Signature:   "(sets/conj s v...)",
+			Description: "Returns s with the values v added.",
+			F:           utils.ErrFunc(conj, utils.CheckArityAtLeast(1)),
+		},
+		&module.Func{
+			Name:        "sets/disj",
+			Signature:   "(sets/disj s v...)",
+			Description: "Returns s without the values v.",
+			F:           utils.ErrFunc(disj, utils.CheckArityAtLeast(1)),
+		},
+	},
+}
+
+func toSets(args []interface{}) ([]*persistent.Set, error) {
+	res := make([]*persistent.Set, len(args))
+	for i, arg := range args {
+		s, ok := arg.(*persistent.Set)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		res[i] = s
+	}
+	return res, nil
+}
+
+func union(args ...interface{}) (interface{}, error) {
+	s, err := toSets(args)
+	if err != nil {
+		return nil, err
+	}
+	return s[0].Union(s[1:]...), nil
+}
+
+func intersection(args ...interface{}) (interface{}, error) {
+	s, err := toSets(args)
+	if err != nil {
+		return nil, err
+	}
+	return s[0].Intersection(s[1:]...), nil
+}
+
+func difference(args ...interface{}) (interface{}, error) {
+	s, err := toSets(args)
+	if err != nil {
+		return nil, err
+	}
+	return s[0].Difference(s[1:]...), nil
+}
+
+func subset(args ...interface{}) (interface{}, error) {
+	s, err := toSets(args)
+	if err != nil {
+		return nil, err
+	}
+	return s[0].Subset(s[1]), nil
+}
+
+func conj(args ...interface{}) (interface{}, error) {
+	s, err := toSets(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	return s[0].Conj(args[1:]...)
+}
+
+func disj(args ...interface{}) (interface{}, error) {
+	s, err := toSets(args[:1])
+	if err != nil {
+		return nil, err
+	}
+	return s[0].Disj(args[1:]...), nil
+}
@@ -0,0 +1,35 @@
+package sets_test
+
+import (
+	"testing"
+
+	"github.com/Stromberg/gel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetsModule(t *testing.T) {
+	test := func(expr string, expected interface{}) {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		assert.NotNil(t, g)
+		s, err := g.Eval(gel.NewEnv())
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, s, expr)
+	}
+
+	test("(json (sets/union #{1 2} #{2 3} #{4}))", "[1,2,3,4]")
+	test("(json (sets/intersection #{1 2 3} #{2 3 4} #{3 2}))", "[2,3]")
+	test("(json (sets/difference #{1 2 3} #{2} #{3}))", "[1]")
+	test("(sets/subset? #{1 2} #{1 2 3})", true)
+	test("(sets/subset? #{1 4} #{1 2 3})", false)
+	test("(sets/subset? #{} #{})", true)
+	test("(json (sets/conj #{1} 2 3))", "[1,2,3]")
+	test("(json (sets/disj #{1 2 3} 2 5))", "[1,3]")
+	test("(len (apply hash-set [1 2 2]))", int64(2))
+	test("(var s #{1}) (sets/conj s 2) (len s)", int64(1))
+
+	g, err := gel.New("(sets/union #{1} [2])")
+	assert.NoError(t, err)
+	_, err = g.Eval(gel.NewEnv())
+	assert.Error(t, err)
+}
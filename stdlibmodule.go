@@ -17,8 +17,98 @@ func init() {
 var StdLibModule = &module.Module{
 	Name: "stdlib",
 	Funcs: []*module.Func{
-		// &module.Func{Name: "strings.Join", F: utils.SimpleFunc(strings.Join, utils.CheckArity(2))},
-		// &module.Func{Name: "strings.Split", F: utils.SimpleFunc(strings.Split, utils.CheckArity(2))},
+		&module.Func{Name: "strings.Split", F: utils.ErrFunc(splitFn, utils.CheckArityAtLeast(2)),
+			Signature:   "(strings.Split s sep) or (strings.Split s sep n)",
+			Description: "Splits s at each sep into a list. With n at most n parts are returned, the last one unsplit.",
+		},
+		&module.Func{Name: "strings.Fields", F: utils.ErrFunc(fieldsFn, utils.CheckArity(1)),
+			Signature:   "(strings.Fields s)",
+			Description: "Splits s around runs of white space into a list.",
+		},
+		&module.Func{Name: "strings.Join", F: utils.ErrFunc(joinFn, utils.CheckArityAtLeast(1)),
+			Signature:   "(strings.Join l) or (strings.Join l sep)",
+			Description: "Joins the values in l with sep between them. Values that are not strings are printed like str.",
+		},
+		&module.Func{Name: "strings.Replace", F: utils.ErrFunc(replaceFn, utils.CheckArityAtLeast(3)),
+			Signature:   "(strings.Replace s old new) or (strings.Replace s old new n)",
+			Description: "Replaces all old in s with new, or the first n if n is given.",
+		},
+		&module.Func{Name: "strings.Contains", F: utils.ErrFunc(stringsPredicate(strings.Contains), utils.CheckArity(2)),
+			Signature:   "(strings.Contains s sub)",
+			Description: "Checks if sub is in s.",
+		},
+		&module.Func{Name: "strings.HasPrefix", F: utils.ErrFunc(stringsPredicate(strings.HasPrefix), utils.CheckArity(2)),
+			Signature:   "(strings.HasPrefix s prefix)",
+			Description: "Checks if s starts with prefix.",
+		},
+		&module.Func{Name: "strings.HasSuffix", F: utils.ErrFunc(stringsPredicate(strings.HasSuffix), utils.CheckArity(2)),
+			Signature:   "(strings.HasSuffix s suffix)",
+			Description: "Checks if s ends with suffix.",
+		},
+		&module.Func{Name: "strings.EqualFold", F: utils.ErrFunc(stringsPredicate(strings.EqualFold), utils.CheckArity(2)),
+			Signature:   "(strings.EqualFold s t)",
+			Description: "Checks if s and t are equal ignoring case.",
+		},
+		&module.Func{Name: "strings.Compare", F: utils.ErrFunc(compareFoldFn, utils.CheckArityAtLeast(2)),
+			Signature:   "(strings.Compare s t) or (strings.Compare s t :fold)",
+			Description: "Returns -1, 0 or 1 if s is less than, equal to or greater than t. With :fold case is ignored.",
+		},
+		&module.Func{Name: "strings.Index", F: utils.ErrFunc(indexFn(strings.Index), utils.CheckArity(2)),
+			Signature:   "(strings.Index s sub)",
+			Description: "Returns the rune index of the first sub in s, or -1.",
+		},
+		&module.Func{Name: "strings.LastIndex", F: utils.ErrFunc(indexFn(strings.LastIndex), utils.CheckArity(2)),
+			Signature:   "(strings.LastIndex s sub)",
+			Description: "Returns the rune index of the last sub in s, or -1.",
+		},
+		&module.Func{Name: "strings.Len", F: utils.ErrFunc(runeLenFn, utils.CheckArity(1)),
+			Signature:   "(strings.Len s)",
+			Description: "Returns the number of runes in s. len returns the number of bytes.",
+		},
+		&module.Func{Name: "strings.Substring", F: utils.ErrFunc(substringFn, utils.CheckArityAtLeast(2)),
+			Signature:   "(strings.Substring s start) or (strings.Substring s start end)",
+			Description: "Returns the runes of s from start up to, not including, end. Negative indexes count from the end.",
+		},
+		&module.Func{Name: "strings.PadLeft", F: utils.ErrFunc(padFn(true), utils.CheckArityAtLeast(2)),
+			Signature:   "(strings.PadLeft s n) or (strings.PadLeft s n pad)",
+			Description: "Pads s to n runes by adding pad, a space by default, to the left.",
+		},
+		&module.Func{Name: "strings.PadRight", F: utils.ErrFunc(padFn(false), utils.CheckArityAtLeast(2)),
+			Signature:   "(strings.PadRight s n) or (strings.PadRight s n pad)",
+			Description: "Pads s to n runes by adding pad, a space by default, to the right.",
+		},
+		&module.Func{Name: "strings.Repeat", F: utils.ErrFunc(stringRepeatFn, utils.CheckArity(2)),
+			Signature:   "(strings.Repeat s n)",
+			Description: "Returns s repeated n times.",
+		},
+		&module.Func{Name: "strings.Trim", F: utils.ErrFunc(trimFn(strings.Trim, strings.TrimSpace), utils.CheckArityAtLeast(1)),
+			Signature:   "(strings.Trim s) or (strings.Trim s cutset)",
+			Description: "Trims the runes in cutset, or white space, from both ends of s.",
+		},
+		&module.Func{Name: "strings.TrimLeft", F: utils.ErrFunc(trimFn(strings.TrimLeft, trimLeftSpace), utils.CheckArityAtLeast(1)),
+			Signature:   "(strings.TrimLeft s) or (strings.TrimLeft s cutset)",
+			Description: "Trims the runes in cutset, or white space, from the beginning of s.",
+		},
+		&module.Func{Name: "strings.TrimRight", F: utils.ErrFunc(trimFn(strings.TrimRight, trimRightSpace), utils.CheckArityAtLeast(1)),
+			Signature:   "(strings.TrimRight s) or (strings.TrimRight s cutset)",
+			Description: "Trims the runes in cutset, or white space, from the end of s.",
+		},
+		&module.Func{Name: "strings.TrimPrefix", F: utils.ErrFunc(stringsFunc2(strings.TrimPrefix), utils.CheckArity(2)),
+			Signature:   "(strings.TrimPrefix s prefix)",
+			Description: "Returns s without prefix, or s if it does not start with prefix.",
+		},
+		&module.Func{Name: "strings.TrimSuffix", F: utils.ErrFunc(stringsFunc2(strings.TrimSuffix), utils.CheckArity(2)),
+			Signature:   "(strings.TrimSuffix s suffix)",
+			Description: "Returns s without suffix, or s if it does not end with suffix.",
+		},
+		&module.Func{Name: "strings.Runes", F: utils.ErrFunc(runesFn, utils.CheckArity(1)),
+			Signature:   "(strings.Runes s)",
+			Description: "Returns the runes of s as a list of ints, the values of char literals like 'a'.",
+		},
+		&module.Func{Name: "strings.FromRunes", F: utils.ErrFunc(fromRunesFn, utils.CheckArityAtLeast(1)),
+			Signature:   "(strings.FromRunes r...) or (strings.FromRunes l)",
+			Description: "Returns the string of runes given as ints or as a list of ints. (strings.FromRunes 'a') => \"a\"",
+		},
 		&module.Func{Name: "strings.Title", F: utils.SimpleFunc(strings.Title, utils.CheckArity(1)),
 			Signature:   "(strings.Title cs)",
 			Description: "Title cased string.",
@@ -133,23 +223,23 @@ var transposeFn = utils.ErrFunc(func(listOfLists []interface{}) (interface{}, er
 	if numLists == 0 {
 		return listOfLists, nil
 	}
-	list, ok := listOfLists[0].([]interface{})
-	if !ok {
-		return nil, errors.New("Expected list of lists")
+	lists := make([][]interface{}, numLists)
+	for j, v := range listOfLists {
+		list, ok := utils.AsList(v)
+		if !ok {
+			return nil, errors.New("Expected list of lists")
+		}
+		if j > 0 && len(list) != len(lists[0]) {
+			return nil, errors.New("All lists must be the same length")
+		}
+		lists[j] = list
 	}
-	listLen := len(list)
+	listLen := len(lists[0])
 
 	res := make([]interface{}, listLen)
 	for i := range res {
 		res[i] = make([]interface{}, numLists)
-		for j, v := range listOfLists {
-			list, ok := v.([]interface{})
-			if !ok {
-				return nil, errors.New("Expected list of lists")
-			}
-			if len(list) != listLen {
-				return nil, errors.New("All lists must be the same length")
-			}
+		for j, list := range lists {
 			res[i].([]interface{})[j] = list[i]
 		}
 	}
@@ -26,6 +26,44 @@ func TestStdLibModuleStrings(t *testing.T) {
 	test("(sprintf \"Grr\\n\")", "Grr\n")
 	test("(sprintf \"Grr: %v\\n\" 3.14)", "Grr: 3.14\n")
 	test("(str 3.14)", "3.14")
+
+	test(`(strings.Split "a,b,c" ",")`, []interface{}{"a", "b", "c"})
+	test(`(strings.Split "a,b,c" "," 2)`, []interface{}{"a", "b,c"})
+	test(`(strings.Fields " a  b\tc ")`, []interface{}{"a", "b", "c"})
+	test(`(strings.Join ["a" "b" "c"] ", ")`, "a, b, c")
+	test(`(strings.Join ["a" 1 :b])`, "a1:b")
+	test(`(strings.Replace "aaa" "a" "b")`, "bbb")
+	test(`(strings.Replace "aaa" "a" "b" 2)`, "bba")
+	test(`[(strings.Contains "world" "orl") (strings.Contains "world" "x")]`, []interface{}{true, false})
+	test(`[(strings.HasPrefix "world" "wo") (strings.HasSuffix "world" "wo")]`, []interface{}{true, false})
+	test(`(strings.EqualFold "Gö" "gÖ")`, true)
+	test(`[(strings.Compare "a" "B") (strings.Compare "a" "B" :fold) (strings.Compare "A" "a" :fold)]`, []interface{}{int64(1), int64(-1), int64(0)})
+	test(`[(strings.Index "häll" "l") (strings.LastIndex "häll" "l") (strings.Index "häll" "x")]`, []interface{}{int64(2), int64(3), int64(-1)})
+	test(`[(strings.Len "häll") (len "häll")]`, []interface{}{int64(4), int64(5)})
+	test(`[(strings.Substring "häll" 1 3) (strings.Substring "häll" 2) (strings.Substring "häll" -2)]`, []interface{}{"äl", "ll", "ll"})
+	test(`[(strings.PadLeft "7" 3 "0") (strings.PadRight "ä" 3) (strings.PadLeft "abc" 2) (strings.PadRight "a" 4 "xy")]`, []interface{}{"007", "ä  ", "abc", "axyx"})
+	test(`(strings.Repeat "ab" 3)`, "ababab")
+	test(`[(strings.Trim " \ta ") (strings.Trim "xxaxx" "x") (strings.TrimLeft "  a ") (strings.TrimRight "  a ") (strings.TrimLeft "xxa" "x")]`,
+		[]interface{}{"a", "a", "a ", "  a", "a"})
+	test(`[(strings.TrimPrefix "prefix" "pre") (strings.TrimSuffix "prefix" "fix") (strings.TrimSuffix "prefix" "x1")]`, []interface{}{"fix", "pre", "prefix"})
+	test(`(strings.Runes "aä")`, []interface{}{int64('a'), int64('ä')})
+	test(`[(strings.FromRunes 'a' 'b') (strings.FromRunes (strings.Runes "aä")) (strings.FromRunes [])]`, []interface{}{"ab", "aä", ""})
+
+	for _, expr := range []string{
+		`(strings.Split "a" 1)`,
+		`(strings.Join "a" ",")`,
+		`(strings.Substring "abc" 2 1)`,
+		`(strings.Substring "abc" 4)`,
+		`(strings.Repeat "a" -1)`,
+		`(strings.PadLeft "a" 3 "")`,
+		`(strings.Compare "a" "b" :upper)`,
+		`(strings.FromRunes "a")`,
+	} {
+		g, err := gel.New(expr)
+		assert.NoError(t, err)
+		_, err = g.Eval(gel.NewEnv())
+		assert.Error(t, err, expr)
+	}
 }
 
 func TestStdLibModuleMath(t *testing.T) {
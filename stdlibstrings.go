@@ -0,0 +1,304 @@
+package gel
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Stromberg/gel/utils"
+)
+
+var errNotString = errors.New("Error in parameter type, expected a string")
+
+func toStrings(args ...interface{}) ([]string, error) {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return nil, errNotString
+		}
+		res[i] = s
+	}
+	return res, nil
+}
+
+func toInt(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	}
+	return 0, utils.ErrParameterType
+}
+
+func stringsList(strs []string) []interface{} {
+	res := make([]interface{}, len(strs))
+	for i, s := range strs {
+		res[i] = s
+	}
+	return res
+}
+
+func stringsPredicate(f func(s, t string) bool) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		strs, err := toStrings(args...)
+		if err != nil {
+			return nil, err
+		}
+		return f(strs[0], strs[1]), nil
+	}
+}
+
+func stringsFunc2(f func(s, t string) string) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		strs, err := toStrings(args...)
+		if err != nil {
+			return nil, err
+		}
+		return f(strs[0], strs[1]), nil
+	}
+}
+
+func splitFn(args ...interface{}) (interface{}, error) {
+	if len(args) > 3 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	strs, err := toStrings(args[:2]...)
+	if err != nil {
+		return nil, err
+	}
+	n := -1
+	if len(args) == 3 {
+		if n, err = toInt(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	return stringsList(strings.SplitN(strs[0], strs[1], n)), nil
+}
+
+func fieldsFn(args ...interface{}) (interface{}, error) {
+	strs, err := toStrings(args...)
+	if err != nil {
+		return nil, err
+	}
+	return stringsList(strings.Fields(strs[0])), nil
+}
+
+func joinFn(args ...interface{}) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	l, err := utils.ToList(args[0])
+	if err != nil {
+		return nil, err
+	}
+	sep := ""
+	if len(args) == 2 {
+		var ok bool
+		if sep, ok = args[1].(string); !ok {
+			return nil, errNotString
+		}
+	}
+	strs := make([]string, len(l))
+	for i, v := range l {
+		if s, ok := v.(string); ok {
+			strs[i] = s
+		} else {
+			strs[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(strs, sep), nil
+}
+
+func replaceFn(args ...interface{}) (interface{}, error) {
+	if len(args) > 4 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	strs, err := toStrings(args[:3]...)
+	if err != nil {
+		return nil, err
+	}
+	n := -1
+	if len(args) == 4 {
+		if n, err = toInt(args[3]); err != nil {
+			return nil, err
+		}
+	}
+	return strings.Replace(strs[0], strs[1], strs[2], n), nil
+}
+
+func compareFoldFn(args ...interface{}) (interface{}, error) {
+	if len(args) > 3 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	strs, err := toStrings(args[:2]...)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 {
+		if args[2] != utils.Keyword("fold") {
+			return nil, fmt.Errorf("unknown compare option: %v", args[2])
+		}
+		strs[0], strs[1] = strings.ToLower(strs[0]), strings.ToLower(strs[1])
+	}
+	return int64(strings.Compare(strs[0], strs[1])), nil
+}
+
+func indexFn(f func(s, sub string) int) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		strs, err := toStrings(args...)
+		if err != nil {
+			return nil, err
+		}
+		i := f(strs[0], strs[1])
+		if i < 0 {
+			return int64(-1), nil
+		}
+		return int64(utf8.RuneCountInString(strs[0][:i])), nil
+	}
+}
+
+func runeLenFn(args ...interface{}) (interface{}, error) {
+	strs, err := toStrings(args...)
+	if err != nil {
+		return nil, err
+	}
+	return int64(utf8.RuneCountInString(strs[0])), nil
+}
+
+func substringFn(args ...interface{}) (interface{}, error) {
+	if len(args) > 3 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errNotString
+	}
+	runes := []rune(s)
+	bounds := []int{0, len(runes)}
+	for i, arg := range args[1:] {
+		b, err := toInt(arg)
+		if err != nil {
+			return nil, err
+		}
+		if b < 0 {
+			b += len(runes)
+		}
+		if b < 0 || b > len(runes) {
+			return nil, fmt.Errorf("index %v out of range for string of %v runes", arg, len(runes))
+		}
+		bounds[i] = b
+	}
+	if bounds[0] > bounds[1] {
+		return nil, fmt.Errorf("start %v after end %v", bounds[0], bounds[1])
+	}
+	return string(runes[bounds[0]:bounds[1]]), nil
+}
+
+func padFn(left bool) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) > 3 {
+			return nil, utils.ErrWrongNumberPar
+		}
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, errNotString
+		}
+		n, err := toInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		pad := " "
+		if len(args) == 3 {
+			if pad, ok = args[2].(string); !ok {
+				return nil, errNotString
+			}
+			if pad == "" {
+				return nil, errors.New("pad must not be empty")
+			}
+		}
+		missing := n - utf8.RuneCountInString(s)
+		if missing <= 0 {
+			return s, nil
+		}
+		p := []rune(strings.Repeat(pad, missing))[:missing]
+		if left {
+			return string(p) + s, nil
+		}
+		return s + string(p), nil
+	}
+}
+
+func stringRepeatFn(args ...interface{}) (interface{}, error) {
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errNotString
+	}
+	n, err := toInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errors.New("negative repeat count")
+	}
+	return strings.Repeat(s, n), nil
+}
+
+func trimLeftSpace(s string) string {
+	return strings.TrimLeftFunc(s, unicode.IsSpace)
+}
+
+func trimRightSpace(s string) string {
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
+
+func trimFn(cut func(s, cutset string) string, space func(s string) string) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) > 2 {
+			return nil, utils.ErrWrongNumberPar
+		}
+		strs, err := toStrings(args...)
+		if err != nil {
+			return nil, err
+		}
+		if len(strs) == 1 {
+			return space(strs[0]), nil
+		}
+		return cut(strs[0], strs[1]), nil
+	}
+}
+
+func runesFn(args ...interface{}) (interface{}, error) {
+	strs, err := toStrings(args...)
+	if err != nil {
+		return nil, err
+	}
+	res := []interface{}{}
+	for _, r := range strs[0] {
+		res = append(res, int64(r))
+	}
+	return res, nil
+}
+
+func fromRunesFn(args ...interface{}) (interface{}, error) {
+	if len(args) == 1 {
+		l, err := utils.ToList(args[0])
+		if err == nil {
+			args = l
+		} else if err != utils.ErrParameterType {
+			return nil, err
+		}
+	}
+	runes := make([]rune, len(args))
+	for i, arg := range args {
+		r, ok := arg.(int64)
+		if !ok {
+			return nil, utils.ErrParameterType
+		}
+		runes[i] = rune(r)
+	}
+	return string(runes), nil
+}
@@ -0,0 +1,223 @@
+package gel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Stromberg/gel/ast"
+	"github.com/Stromberg/gel/utils"
+)
+
+// ErrorValue is an error as seen by gel code. It is created by throw and
+// make-error, and errors returned by functions are turned into an
+// ErrorValue when they are caught.
+type ErrorValue struct {
+	Message string
+	Data    interface{}
+	// PosInfo is the position the error was raised at.
+	PosInfo *ast.PosInfo
+	// Err is the Go error the value was created from, if any.
+	Err error
+}
+
+func (e *ErrorValue) Error() string {
+	return e.Message
+}
+
+// fatal reports whether err aborts an evaluation even inside try.
+func fatal(err error) bool {
+	switch err {
+	case ErrStepLimit, ErrDepthLimit, ErrAllocLimit, context.Canceled, context.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// caught converts an error raised while evaluating code into an ErrorValue.
+func caught(err error) *ErrorValue {
+	var pinfo *ast.PosInfo
+	if e, ok := err.(*Error); ok {
+		pinfo, err = e.PosInfo, e.Err
+	}
+	if e, ok := err.(*ErrorValue); ok {
+		if e.PosInfo == nil {
+			v := *e
+			v.PosInfo = pinfo
+			return &v
+		}
+		return e
+	}
+	return &ErrorValue{Message: err.Error(), PosInfo: pinfo, Err: err}
+}
+
+// unwrap returns the error an *Error holds.
+func unwrap(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Err
+	}
+	return err
+}
+
+// clause returns the arguments of node if it is a (name args...) form.
+func clause(node ast.Node, name string) ([]ast.Node, bool) {
+	list, ok := node.(*ast.List)
+	if !ok || len(list.Nodes) == 0 {
+		return nil, false
+	}
+	symbol, ok := list.Nodes[0].(*ast.Symbol)
+	if !ok || symbol.Name != name {
+		return nil, false
+	}
+	return list.Nodes[1:], true
+}
+
+func tryFn(c *compiler, args []ast.Node) (code, error) {
+	var catchArgs, finallyArgs []ast.Node
+	hasCatch, hasFinally := false, false
+	if n := len(args); n > 0 {
+		if finallyArgs, hasFinally = clause(args[n-1], "finally"); hasFinally {
+			args = args[:n-1]
+		}
+	}
+	if n := len(args); n > 0 {
+		if catchArgs, hasCatch = clause(args[n-1], "catch"); hasCatch {
+			args = args[:n-1]
+		}
+	}
+	if len(args) == 0 {
+		return nil, errors.New("try takes a body")
+	}
+	for _, arg := range args {
+		if _, ok := clause(arg, "catch"); ok {
+			return nil, errors.New("catch must be followed by at most a finally clause")
+		}
+		if _, ok := clause(arg, "finally"); ok {
+			return nil, errors.New("finally must be the last clause of try")
+		}
+	}
+
+	bc := c.branch()
+	body := bc.compileBody(args)
+
+	var name string
+	var handler code
+	if hasCatch {
+		if len(catchArgs) < 2 {
+			return nil, errors.New("catch takes a symbol and a body")
+		}
+		symbol, ok := catchArgs[0].(*ast.Symbol)
+		if !ok {
+			return nil, errors.New("catch takes a symbol as first argument")
+		}
+		name = symbol.Name
+		cc := c.branch()
+		cc.declare(name)
+		handler = cc.compileBody(catchArgs[1:])
+	}
+
+	var cleanup code
+	if hasFinally {
+		cleanup = c.branch().compileBody(finallyArgs)
+	}
+
+	return func(scope *Scope) (value interface{}, err error) {
+		value, err = body(scope.Branch())
+		if err != nil && handler != nil && !fatal(unwrap(err)) {
+			s := scope.Branch()
+			s.vars = map[string]interface{}{name: caught(err)}
+			value, err = handler(s)
+		}
+		if cleanup != nil {
+			if _, cerr := cleanup(scope.Branch()); cerr != nil {
+				return nil, cerr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}, nil
+}
+
+func catchFn(c *compiler, args []ast.Node) (code, error) {
+	return nil, errors.New("catch outside of try")
+}
+
+func finallyFn(c *compiler, args []ast.Node) (code, error) {
+	return nil, errors.New("finally outside of try")
+}
+
+var throwFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case *ErrorValue:
+		if v.PosInfo != nil {
+			// A rethrown error keeps the position it was first raised at.
+			return nil, &Error{Err: v, PosInfo: v.PosInfo}
+		}
+		return nil, v
+	case error:
+		return nil, v
+	case string:
+		return nil, &ErrorValue{Message: v}
+	}
+	return nil, &ErrorValue{Message: fmt.Sprint(args[0]), Data: args[0]}
+}, utils.CheckArity(1))
+
+var makeErrorFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	if len(args) > 2 {
+		return nil, utils.ErrWrongNumberPar
+	}
+	msg, ok := args[0].(string)
+	if !ok {
+		return nil, utils.ErrParameterType
+	}
+	e := &ErrorValue{Message: msg}
+	if len(args) == 2 {
+		e.Data = args[1]
+	}
+	return e, nil
+}, utils.CheckArityAtLeast(1))
+
+var isErrorFn = utils.SimpleFunc(func(args ...interface{}) interface{} {
+	_, ok := args[0].(error)
+	return ok
+}, utils.CheckArity(1))
+
+func errorValue(v interface{}) (*ErrorValue, error) {
+	switch v := v.(type) {
+	case *ErrorValue:
+		return v, nil
+	case error:
+		return caught(v), nil
+	}
+	return nil, utils.ErrParameterType
+}
+
+var errorMessageFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	e, err := errorValue(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return e.Message, nil
+}, utils.CheckArity(1))
+
+var errorDataFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	e, err := errorValue(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return e.Data, nil
+}, utils.CheckArity(1))
+
+var errorPosFn = utils.ErrFunc(func(args ...interface{}) (interface{}, error) {
+	e, err := errorValue(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if e.PosInfo == nil {
+		return nil, nil
+	}
+	return strings.TrimSuffix(e.PosInfo.String(), ":"), nil
+}, utils.CheckArity(1))
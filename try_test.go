@@ -0,0 +1,34 @@
+package gel_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Stromberg/gel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryHostError(t *testing.T) {
+	hostErr := errors.New("lookup failed")
+	g, err := gel.New(`(try (lookup "x") (catch e [(error-message e) (error-pos e)]))`)
+	assert.NoError(t, err)
+	env := gel.NewEnv()
+	env.AddVar("lookup", func(args ...interface{}) (interface{}, error) {
+		return nil, hostErr
+	})
+
+	r, err := g.Eval(env)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"lookup failed", "twik source:1:7"}, r)
+}
+
+func TestTryLimits(t *testing.T) {
+	g, err := gel.New("(var caught false) (try (while true 1) (catch e (set caught true)) (finally (set caught true)))")
+	assert.NoError(t, err)
+	g.SetLimits(gel.Limits{MaxSteps: 1000})
+
+	_, err = g.Eval(gel.NewEnv())
+	e, ok := err.(*gel.Error)
+	assert.True(t, ok)
+	assert.Equal(t, gel.ErrStepLimit, e.Err)
+}
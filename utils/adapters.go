@@ -3,6 +3,9 @@ package utils
 import (
 	"errors"
 	"strconv"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/persistent"
 )
 
 var (
@@ -10,8 +13,19 @@ var (
 	ErrParameterType  = errors.New("Error in parameter type")
 )
 
+// Adapter checks or converts the parameters of a function. The values may
+// be a slice owned by the caller, like the list given to apply, so adapters
+// converting values must convert a copy.
 type Adapter func(values ...interface{}) ([]interface{}, error)
 
+// with returns a copy of values with the value at p replaced by v.
+func with(values []interface{}, p int, v interface{}) []interface{} {
+	res := make([]interface{}, len(values))
+	copy(res, values)
+	res[p] = v
+	return res
+}
+
 //CheckArity return an function to check if the arity of function call is n
 func CheckArity(n int) Adapter {
 	return func(values ...interface{}) ([]interface{}, error) {
@@ -60,6 +74,7 @@ func ParamsToSameBaseType() Adapter {
 				return []interface{}{}, ErrParameterType
 			}
 		} else if IsAnyFloats(values...) {
+			values = append([]interface{}(nil), values...)
 			for i := range values {
 				switch values[i].(type) {
 				case int:
@@ -88,8 +103,7 @@ func ParamToFloat64(p int) Adapter {
 		switch values[p].(type) {
 		case int64:
 			v := values[p].(int64)
-			values[p] = float64(v)
-			return values, nil
+			return with(values, p, float64(v)), nil
 		case float64:
 			return values, nil
 		default:
@@ -106,13 +120,11 @@ func ParamToInt64(p int) Adapter {
 			return values, nil
 		case float64:
 			v := values[p].(float64)
-			values[p] = int64(v)
-			return values, nil
+			return with(values, p, int64(v)), nil
 		case string:
 			v := values[p].(string)
 			if n, err := strconv.Atoi(v); err == nil {
-				values[p] = int64(n)
-				return values, nil
+				return with(values, p, int64(n)), nil
 			}
 			return []interface{}{}, ErrParameterType
 		default:
@@ -129,14 +141,27 @@ func ParamToInt(p int) Adapter {
 			return values, nil
 		case int64:
 			v := values[p].(int64)
-			values[p] = int(v)
-			return values, nil
+			return with(values, p, int(v)), nil
 		case float64:
 			v := values[p].(float64)
-			values[p] = int(v)
-			return values, nil
+			return with(values, p, int(v)), nil
 		default:
 			return []interface{}{}, ErrParameterType
 		}
 	}
 }
+
+//ParamToList return an Adapter to convert the p nth param to a list if it is a persistent vector or a lazy sequence, which is realized
+func ParamToList(p int) Adapter {
+	return func(values ...interface{}) ([]interface{}, error) {
+		switch values[p].(type) {
+		case *persistent.Vector, *lazy.Seq:
+			l, err := ToList(values[p])
+			if err != nil {
+				return []interface{}{}, err
+			}
+			return with(values, p, l), nil
+		}
+		return values, nil
+	}
+}
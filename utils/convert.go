@@ -0,0 +1,457 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/persistent"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	durationType = reflect.TypeOf(time.Duration(0))
+	keywordType  = reflect.TypeOf(Keyword(""))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// timeLayouts are the layouts of the strings that can be converted to a
+// time.Time, a full timestamp or a date like the X values of data series.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+// ConvertError is the error of a value that cannot be converted to a Go
+// type. Path locates the value inside the converted one, like [3] for the
+// fourth item of a list.
+type ConvertError struct {
+	Path     string
+	Expected string
+	Got      string
+}
+
+func (e *ConvertError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("expected %s, got %s", e.Expected, e.Got)
+	}
+	return fmt.Sprintf("%s: expected %s, got %s", e.Path, e.Expected, e.Got)
+}
+
+// TypeName returns the name of the gel type of v.
+func TypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "bool"
+	case int64, *big.Int:
+		return "int"
+	case float64:
+		return "float"
+	case *big.Rat:
+		return "rational"
+	case num.Decimal:
+		return "decimal"
+	case string:
+		return "string"
+	case Keyword:
+		return "keyword"
+	case []interface{}, *persistent.Vector:
+		return "list"
+	case []float64:
+		return "vec"
+	case map[interface{}]interface{}, *persistent.Map:
+		return "dict"
+	case *persistent.Set:
+		return "set"
+	case func(...interface{}) (interface{}, error):
+		return "function"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// GoTypeName returns the name of the gel type converted to the Go type t.
+func GoTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if t == durationType {
+			return "duration"
+		}
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map:
+		return "dict"
+	case reflect.Func:
+		return "function"
+	case reflect.Struct:
+		if t == timeType {
+			return "time"
+		}
+		return "dict"
+	case reflect.Ptr:
+		return GoTypeName(t.Elem())
+	}
+	return t.String()
+}
+
+// ConvertTo converts the gel value v to the Go type t. Numbers, decimals
+// and rationals included, are converted between the numeric kinds if they
+// fit, lazy sequences are realized, lists and dicts are converted item by
+// item and gel functions are wrapped into functions of
+// type t. Dicts are converted to structs field by field, see ConvertToPath,
+// and strings to time.Time if they are RFC 3339 timestamps or dates like
+// 2019-03-31.
+func ConvertTo(v interface{}, t reflect.Type) (reflect.Value, error) {
+	return convert(v, t, "")
+}
+
+// ConvertToPath is ConvertTo with the errors located from path, the name
+// of v. The fields of a struct are taken from the dict keys, strings or
+// keywords, given by their gel tags, like `gel:"name"`, or else by the field
+// names, compared without case if there is no exact match. Fields tagged
+// `gel:"-"` and fields that are missing in the dict are left zero.
+func ConvertToPath(v interface{}, t reflect.Type, path string) (reflect.Value, error) {
+	return convert(v, t, path)
+}
+
+func convert(v interface{}, t reflect.Type, path string) (reflect.Value, error) {
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, &ConvertError{Path: path, Expected: GoTypeName(t), Got: TypeName(v)}
+	}
+	if v == nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return mismatch()
+	}
+	if seq, ok := v.(*lazy.Seq); ok {
+		l, err := seq.Slice()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v = l
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		res := reflect.New(t).Elem()
+		res.Set(rv)
+		return res, nil
+	}
+
+	res := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := wholeNumber(v)
+		if !ok {
+			return mismatch()
+		}
+		if !n.IsInt64() || res.OverflowInt(n.Int64()) {
+			return reflect.Value{}, &ConvertError{Path: path, Expected: t.String(), Got: n.String()}
+		}
+		res.SetInt(n.Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := wholeNumber(v)
+		if !ok {
+			return mismatch()
+		}
+		if n.Sign() < 0 || !n.IsUint64() || res.OverflowUint(n.Uint64()) {
+			return reflect.Value{}, &ConvertError{Path: path, Expected: t.String(), Got: n.String()}
+		}
+		res.SetUint(n.Uint64())
+	case reflect.Float32, reflect.Float64:
+		f, ok := num.ToFloat64(v)
+		if !ok {
+			return mismatch()
+		}
+		if res.OverflowFloat(f) || math.IsInf(f, 0) && num.IsExtended(v) {
+			return reflect.Value{}, &ConvertError{Path: path, Expected: t.String(), Got: fmt.Sprint(v)}
+		}
+		res.SetFloat(f)
+	case reflect.String:
+		if rv.Kind() != reflect.String {
+			return mismatch()
+		}
+		res.SetString(rv.String())
+	case reflect.Slice:
+		l, err := ToList(v)
+		if err == ErrParameterType {
+			return mismatch()
+		}
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res = reflect.MakeSlice(t, len(l), len(l))
+		for i, item := range l {
+			e, err := convert(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res.Index(i).Set(e)
+		}
+	case reflect.Array:
+		l, err := ToList(v)
+		if err == ErrParameterType {
+			return mismatch()
+		}
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if len(l) != t.Len() {
+			return reflect.Value{}, &ConvertError{Path: path,
+				Expected: fmt.Sprintf("list of length %d", t.Len()), Got: fmt.Sprintf("list of length %d", len(l))}
+		}
+		for i, item := range l {
+			e, err := convert(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res.Index(i).Set(e)
+		}
+	case reflect.Map:
+		d, ok := ToDict(v)
+		if !ok {
+			return mismatch()
+		}
+		res = reflect.MakeMapWithSize(t, len(d))
+		for k, item := range d {
+			kpath := fmt.Sprintf("%s[%v]", path, k)
+			kv, err := convert(k, t.Key(), kpath)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			e, err := convert(item, t.Elem(), kpath)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res.SetMapIndex(kv, e)
+		}
+	case reflect.Ptr:
+		e, err := convert(v, t.Elem(), path)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res = reflect.New(t.Elem())
+		res.Elem().Set(e)
+	case reflect.Struct:
+		if t == timeType {
+			return convertTime(v, path)
+		}
+		d, ok := ToDict(v)
+		if !ok {
+			return mismatch()
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := f.Tag.Get("gel")
+			if f.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			item, ok := dictField(d, name)
+			if !ok {
+				continue
+			}
+			fpath := name
+			if path != "" {
+				fpath = path + "." + name
+			}
+			e, err := convert(item, f.Type, fpath)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res.Field(i).Set(e)
+		}
+	case reflect.Func:
+		fn, ok := v.(func(...interface{}) (interface{}, error))
+		if !ok {
+			return mismatch()
+		}
+		return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+			return callGel(fn, t, args)
+		}), nil
+	default:
+		return mismatch()
+	}
+	return res, nil
+}
+
+// convertTime converts a string in one of the timeLayouts to a time.Time.
+// wholeNumber returns the number v as a big integer, if it has no
+// fractional part.
+func wholeNumber(v interface{}) (*big.Int, bool) {
+	switch v := v.(type) {
+	case int64:
+		return big.NewInt(v), true
+	case float64:
+		if math.IsInf(v, 0) || v != math.Trunc(v) {
+			return nil, false
+		}
+		n, _ := big.NewFloat(v).Int(nil)
+		return n, true
+	case *big.Int:
+		return v, true
+	case *big.Rat:
+		if !v.IsInt() {
+			return nil, false
+		}
+		return v.Num(), true
+	case num.Decimal:
+		r := v.Rat()
+		if !r.IsInt() {
+			return nil, false
+		}
+		return r.Num(), true
+	}
+	return nil, false
+}
+
+func convertTime(v interface{}, path string) (reflect.Value, error) {
+	if s, ok := v.(string); ok {
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return reflect.ValueOf(t), nil
+			}
+		}
+	}
+	got := TypeName(v)
+	if _, ok := v.(string); ok {
+		got = fmt.Sprintf("%q", v)
+	}
+	return reflect.Value{}, &ConvertError{Path: path, Expected: "time", Got: got}
+}
+
+// dictField returns the value of the field name of a struct in the dict d.
+func dictField(d map[interface{}]interface{}, name string) (interface{}, bool) {
+	if v, ok := d[name]; ok {
+		return v, true
+	}
+	if v, ok := d[Keyword(name)]; ok {
+		return v, true
+	}
+	for k, v := range d {
+		switch k := k.(type) {
+		case string:
+			if strings.EqualFold(k, name) {
+				return v, true
+			}
+		case Keyword:
+			if strings.EqualFold(string(k), name) {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// callGel calls the gel function fn with the arguments of a call to a Go
+// function of type t and returns the results of the Go function. If t does
+// not return an error, errors of fn panic.
+func callGel(fn func(...interface{}) (interface{}, error), t reflect.Type, args []reflect.Value) []reflect.Value {
+	vargs := make([]interface{}, 0, len(args))
+	for i, arg := range args {
+		if t.IsVariadic() && i == len(args)-1 {
+			for j := 0; j < arg.Len(); j++ {
+				vargs = append(vargs, FromGo(arg.Index(j)))
+			}
+			continue
+		}
+		vargs = append(vargs, FromGo(arg))
+	}
+
+	outs := make([]reflect.Value, t.NumOut())
+	for i := range outs {
+		outs[i] = reflect.Zero(t.Out(i))
+	}
+	hasErr := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	fail := func(err error) []reflect.Value {
+		if !hasErr {
+			panic(err)
+		}
+		outs[len(outs)-1] = reflect.ValueOf(&err).Elem()
+		return outs
+	}
+
+	r, err := fn(vargs...)
+	if err != nil {
+		return fail(err)
+	}
+	if len(outs) > 0 && !(hasErr && len(outs) == 1) {
+		v, err := ConvertTo(r, t.Out(0))
+		if err != nil {
+			return fail(fmt.Errorf("result: %v", err))
+		}
+		outs[0] = v
+	}
+	return outs
+}
+
+// FromGo converts the Go value v to a gel value. Integers become int64,
+// floats float64 and slices and maps become lists and dicts, except for
+// []float64 which is a vec. Other values are kept as they are.
+func FromGo(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			return time.Duration(v.Int())
+		}
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		if v.Type() == keywordType {
+			return Keyword(v.String())
+		}
+		return v.String()
+	case reflect.Slice, reflect.Array:
+		if vec, ok := v.Interface().([]float64); ok {
+			return vec
+		}
+		if l, ok := v.Interface().([]interface{}); ok {
+			return l
+		}
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			res[i] = FromGo(v.Index(i))
+		}
+		return res
+	case reflect.Map:
+		if d, ok := v.Interface().(map[interface{}]interface{}); ok {
+			return d
+		}
+		res := make(map[interface{}]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			res[FromGo(k)] = FromGo(v.MapIndex(k))
+		}
+		return res
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return FromGo(v.Elem())
+	}
+	if !v.CanInterface() {
+		return nil
+	}
+	return v.Interface()
+}
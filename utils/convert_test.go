@@ -0,0 +1,177 @@
+package utils_test
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/num"
+	"github.com/Stromberg/gel/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertTo(t *testing.T) {
+	convert := func(v interface{}, to interface{}) (interface{}, error) {
+		r, err := utils.ConvertTo(v, reflect.TypeOf(to))
+		if err != nil {
+			return nil, err
+		}
+		return r.Interface(), nil
+	}
+	tests := []struct {
+		v, to, expected interface{}
+	}{
+		{int64(3), int(0), 3},
+		{int64(3), uint8(0), uint8(3)},
+		{4.0, int32(0), int32(4)},
+		{int64(3), float32(0), float32(3)},
+		{utils.Keyword("a"), "", "a"},
+		{[]interface{}{int64(1), 2.5}, []float64{}, []float64{1, 2.5}},
+		{[]float64{1, 2}, []int{}, []int{1, 2}},
+		{map[interface{}]interface{}{"a": int64(1)}, map[string]int{}, map[string]int{"a": 1}},
+		{int64(3), new(int), func() *int { n := 3; return &n }()},
+		{time.Second, time.Duration(0), time.Second},
+		{"x", (*interface{})(nil), func() *interface{} { var v interface{} = "x"; return &v }()},
+		{num.DecimalFromInt(7), int16(0), int16(7)},
+		{big.NewRat(6, 2), uint(0), uint(3)},
+		{big.NewInt(5), int64(0), int64(5)},
+		{big.NewRat(1, 4), 0.0, 0.25},
+		{num.DecimalFromRat(big.NewRat(3, 2)), float32(0), float32(1.5)},
+		{lazy.FromSlice([]interface{}{int64(1), int64(2)}), []int{}, []int{1, 2}},
+		{lazy.FromSlice([]interface{}{"a"}), (*interface{})(nil), func() *interface{} { var v interface{} = []interface{}{"a"}; return &v }()},
+		{[]interface{}{int64(1), int64(2)}, [2]int{}, [2]int{1, 2}},
+	}
+	for _, test := range tests {
+		r, err := convert(test.v, test.to)
+		assert.NoError(t, err, "%#v", test.v)
+		assert.Equal(t, test.expected, r, "%#v", test.v)
+	}
+
+	_, err := convert("a", 0)
+	assert.EqualError(t, err, "expected int, got string")
+	_, err = convert(2.5, 0)
+	assert.EqualError(t, err, "expected int, got float")
+	_, err = convert(int64(300), uint8(0))
+	assert.EqualError(t, err, "expected uint8, got 300")
+	_, err = convert([]interface{}{int64(1), "b"}, []int{})
+	assert.EqualError(t, err, "[1]: expected int, got string")
+	_, err = convert(nil, 0)
+	assert.EqualError(t, err, "expected int, got nil")
+	_, err = convert(num.DecimalFromRat(big.NewRat(1, 2)), 0)
+	assert.EqualError(t, err, "expected int, got decimal")
+	_, err = convert(new(big.Int).Lsh(big.NewInt(1), 64), int64(0))
+	assert.EqualError(t, err, "expected int64, got 18446744073709551616")
+	_, err = convert(big.NewInt(-1), uint(0))
+	assert.EqualError(t, err, "expected uint, got -1")
+	_, err = convert(new(big.Int).Lsh(big.NewInt(1), 200), float32(0))
+	assert.EqualError(t, err, "expected float32, got 1606938044258990275541962092341162602522202993782792835301376")
+	_, err = convert([]interface{}{int64(1), int64(2)}, [3]int{})
+	assert.EqualError(t, err, "expected list of length 3, got list of length 2")
+}
+
+func TestConvertToFunc(t *testing.T) {
+	double := func(args ...interface{}) (interface{}, error) {
+		if args[0].(int64) < 0 {
+			return nil, errors.New("negative")
+		}
+		return args[0].(int64) * 2, nil
+	}
+	r, err := utils.ConvertTo(double, reflect.TypeOf(func(int) (int, error) { return 0, nil }))
+	assert.NoError(t, err)
+	f := r.Interface().(func(int) (int, error))
+	n, err := f(21)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, n)
+	_, err = f(-1)
+	assert.EqualError(t, err, "negative")
+
+	r, err = utils.ConvertTo(double, reflect.TypeOf(func(int) string { return "" }))
+	assert.NoError(t, err)
+	assert.Panics(t, func() { r.Interface().(func(int) string)(1) })
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		v, expected interface{}
+	}{
+		{3, int64(3)},
+		{uint16(3), int64(3)},
+		{float32(1.5), 1.5},
+		{"a", "a"},
+		{[]string{"a", "b"}, []interface{}{"a", "b"}},
+		{[]float64{1, 2}, []float64{1, 2}},
+		{map[string]int{"a": 1}, map[interface{}]interface{}{"a": int64(1)}},
+		{time.Second, time.Second},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, utils.FromGo(reflect.ValueOf(test.v)), "%#v", test.v)
+	}
+}
+
+func TestCallGo(t *testing.T) {
+	sum := reflect.ValueOf(func(base float64, ns ...int) (float64, error) {
+		for _, n := range ns {
+			if n < 0 {
+				return 0, errors.New("negative")
+			}
+			base += float64(n)
+		}
+		return base, nil
+	})
+	r, err := utils.CallGo("sum", sum, []interface{}{int64(1), int64(2), 3.0})
+	assert.NoError(t, err)
+	assert.Equal(t, 6.0, r)
+
+	_, err = utils.CallGo("sum", sum, []interface{}{})
+	assert.EqualError(t, err, "sum takes at least one argument, got 0")
+	_, err = utils.CallGo("sum", sum, []interface{}{1.0, "a"})
+	assert.EqualError(t, err, "argument 2 of sum: expected int, got string")
+	_, err = utils.CallGo("sum", sum, []interface{}{1.0, int64(-1)})
+	assert.EqualError(t, err, "negative")
+
+	divmod := reflect.ValueOf(func(a, b int) (int, int) { return a / b, a % b })
+	r, err = utils.CallGo("divmod", divmod, []interface{}{int64(7), int64(2)})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(3), int64(1)}, r)
+	_, err = utils.CallGo("divmod", divmod, []interface{}{int64(7)})
+	assert.EqualError(t, err, "divmod takes 2 arguments, got 1")
+}
+
+func TestGoFunc(t *testing.T) {
+	half := utils.GoFunc("half", func(n int) (float64, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return float64(n) / 2, nil
+	})
+	r, err := half(int64(3))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, r)
+	_, err = half(int64(-1))
+	assert.EqualError(t, err, "negative")
+	_, err = half("a")
+	assert.EqualError(t, err, "argument 1 of half: expected int, got string")
+
+	assert.Equal(t, "(half int)", utils.GoFuncSignature("half", func(n int) (float64, error) { return 0, nil }))
+	assert.Equal(t, "(f string function...)", utils.GoFuncSignature("f", func(string, ...func()) {}))
+	assert.Panics(t, func() { utils.GoFunc("x", "not a function") })
+}
+
+func TestConvertToStruct(t *testing.T) {
+	type point struct {
+		X, Y float64
+		Tag  string `gel:"label"`
+	}
+	r, err := utils.ConvertToPath(map[interface{}]interface{}{utils.Keyword("x"): int64(1), "Y": 2.5, "label": "p"}, reflect.TypeOf(point{}), "p")
+	assert.NoError(t, err)
+	assert.Equal(t, point{X: 1, Y: 2.5, Tag: "p"}, r.Interface())
+
+	_, err = utils.ConvertToPath([]interface{}{map[interface{}]interface{}{"X": "a"}}, reflect.TypeOf([]point{}), "ps")
+	assert.EqualError(t, err, "ps[0].X: expected float, got string")
+	_, err = utils.ConvertTo(map[interface{}]interface{}{"label": int64(1)}, reflect.TypeOf(&point{}))
+	assert.EqualError(t, err, "label: expected string, got int")
+}
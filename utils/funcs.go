@@ -3,10 +3,48 @@ package utils
 import (
 	"errors"
 	"reflect"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/persistent"
+)
+
+var (
+	listType = reflect.TypeOf([]interface{}{})
+	dictType = reflect.TypeOf(map[interface{}]interface{}{})
 )
 
+// argValues returns the values of args for a call of a function of type t.
+// Persistent vectors and maps are given as lists and dicts to the
+// parameters taking lists and dicts.
+func argValues(t reflect.Type, args []interface{}) []reflect.Value {
+	vargs := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var in reflect.Type
+		switch {
+		case t.IsVariadic() && i >= t.NumIn()-1:
+			in = t.In(t.NumIn() - 1).Elem()
+		case i < t.NumIn():
+			in = t.In(i)
+		}
+		switch v := arg.(type) {
+		case *persistent.Vector:
+			if in != nil && listType.AssignableTo(in) && !reflect.TypeOf(v).AssignableTo(in) {
+				arg = v.Slice()
+			}
+		case *persistent.Map:
+			if in != nil && dictType.AssignableTo(in) && !reflect.TypeOf(v).AssignableTo(in) {
+				arg = v.ToMap()
+			}
+		}
+		vargs[i] = reflect.ValueOf(arg)
+	}
+	return vargs
+}
+
 // SimpleFunc builds a Gel function from a function that does not return an error
 func SimpleFunc(v interface{}, adapters ...Adapter) interface{} {
+	fn := reflect.ValueOf(v)
+	direct, _ := v.(func(...interface{}) interface{})
 	return func(values ...interface{}) (interface{}, error) {
 		args := values
 		var err error
@@ -17,18 +55,21 @@ func SimpleFunc(v interface{}, adapters ...Adapter) interface{} {
 			}
 		}
 
-		vargs := []reflect.Value{}
-		for _, arg := range args {
-			vargs = append(vargs, reflect.ValueOf(arg))
+		if direct != nil {
+			return direct(args...), nil
 		}
 
-		result := reflect.ValueOf(v).Call(vargs)
+		vargs := argValues(fn.Type(), args)
+
+		result := fn.Call(vargs)
 		return result[0].Interface(), nil
 	}
 }
 
 // ErrFunc builds a Gel function from a function that returns an error
 func ErrFunc(v interface{}, adapters ...Adapter) interface{} {
+	fn := reflect.ValueOf(v)
+	direct, _ := v.(func(...interface{}) (interface{}, error))
 	return func(values ...interface{}) (interface{}, error) {
 		args := values
 		var err error
@@ -39,12 +80,13 @@ func ErrFunc(v interface{}, adapters ...Adapter) interface{} {
 			}
 		}
 
-		vargs := []reflect.Value{}
-		for _, arg := range args {
-			vargs = append(vargs, reflect.ValueOf(arg))
+		if direct != nil {
+			return direct(args...)
 		}
 
-		result := reflect.ValueOf(v).Call(vargs)
+		vargs := argValues(fn.Type(), args)
+
+		result := fn.Call(vargs)
 		err = nil
 		if result[1].Interface() != nil {
 			err = result[1].Interface().(error)
@@ -99,6 +141,57 @@ var GetFn = ErrFunc(func(args ...interface{}) (interface{}, error) {
 			return nil, errors.New("Key not found")
 		}
 		return v[i], nil
+	case *persistent.Map:
+		v, ok := arg.Get(args[1])
+		if !ok {
+			return false, nil
+		}
+		return v, nil
+	case *persistent.Set:
+		if !arg.Contains(args[1]) {
+			return false, nil
+		}
+		return args[1], nil
+	case *persistent.Vector:
+		i, ok := args[1].(int64)
+		if !ok {
+			return nil, ErrParameterType
+		}
+
+		if i < 0 {
+			i = int64(arg.Len()) + i
+		}
+
+		v, ok := arg.Nth(int(i))
+		if !ok {
+			return nil, errors.New("Key not found")
+		}
+		return v, nil
+	case *lazy.Seq:
+		i, ok := args[1].(int64)
+		if !ok {
+			return nil, ErrParameterType
+		}
+
+		if i < 0 {
+			l, err := arg.Slice()
+			if err != nil {
+				return nil, err
+			}
+			i += int64(len(l))
+			if i < 0 {
+				return nil, errors.New("Key not found")
+			}
+		}
+
+		v, ok, err := arg.Nth(int(i))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("Key not found")
+		}
+		return v, nil
 	}
 	return nil, ErrParameterType
 }, CheckArity(2))
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// goFunc is a Go function called with gel values. Its signature is
+// inspected once, when it is created.
+type goFunc struct {
+	name     string
+	fn       reflect.Value
+	params   []reflect.Type
+	variadic reflect.Type
+	hasErr   bool
+}
+
+func newGoFunc(name string, fn reflect.Value) *goFunc {
+	t := fn.Type()
+	f := &goFunc{name: name, fn: fn}
+	for i := 0; i < t.NumIn(); i++ {
+		f.params = append(f.params, t.In(i))
+	}
+	if t.IsVariadic() {
+		f.variadic = f.params[len(f.params)-1].Elem()
+		f.params = f.params[:len(f.params)-1]
+	}
+	f.hasErr = t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	return f
+}
+
+// CountArgs describes a number of arguments in an arity error, like
+// "one argument" or "3 arguments".
+func CountArgs(n int) string {
+	switch n {
+	case 0:
+		return "no arguments"
+	case 1:
+		return "one argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+func (f *goFunc) call(args []interface{}) (interface{}, error) {
+	if f.variadic != nil {
+		if len(args) < len(f.params) {
+			return nil, fmt.Errorf("%s takes at least %s, got %d", f.name, CountArgs(len(f.params)), len(args))
+		}
+	} else if len(args) != len(f.params) {
+		return nil, fmt.Errorf("%s takes %s, got %d", f.name, CountArgs(len(f.params)), len(args))
+	}
+
+	vargs := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		t := f.variadic
+		if i < len(f.params) {
+			t = f.params[i]
+		}
+		v, err := ConvertTo(arg, t)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of %s: %v", i+1, f.name, err)
+		}
+		vargs[i] = v
+	}
+
+	outs := f.fn.Call(vargs)
+	if f.hasErr {
+		if err := outs[len(outs)-1].Interface(); err != nil {
+			return nil, err.(error)
+		}
+		outs = outs[:len(outs)-1]
+	}
+	switch len(outs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return FromGo(outs[0]), nil
+	}
+	res := make([]interface{}, len(outs))
+	for i, out := range outs {
+		res[i] = FromGo(out)
+	}
+	return res, nil
+}
+
+// signature returns the gel signature of f, like (name int float...).
+func (f *goFunc) signature() string {
+	parts := []string{f.name}
+	for _, p := range f.params {
+		parts = append(parts, GoTypeName(p))
+	}
+	if f.variadic != nil {
+		parts = append(parts, GoTypeName(f.variadic)+"...")
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// CallGo calls the Go function fn, named name in errors, with the gel
+// values args converted to its parameter types. A last error result is
+// returned as the error, the other results are converted with FromGo and
+// returned in a list if there are several.
+func CallGo(name string, fn reflect.Value, args []interface{}) (interface{}, error) {
+	return newGoFunc(name, fn).call(args)
+}
+
+// GoFunc builds a Gel function named name from any Go function, like
+// CallGo. The arity, variadic parameters and conversions of the arguments
+// are derived from the signature of fn, so no adapters are needed.
+// It panics if fn is not a function.
+func GoFunc(name string, fn interface{}) func(args ...interface{}) (interface{}, error) {
+	if fn, ok := fn.(func(...interface{}) (interface{}, error)); ok {
+		return fn
+	}
+	f := newGoFunc(name, goFuncValue(name, fn))
+	return func(args ...interface{}) (interface{}, error) {
+		return f.call(args)
+	}
+}
+
+// GoFuncSignature returns the gel signature of the Go function fn named
+// name, with the types of its parameters like (name int float...).
+// It panics if fn is not a function.
+func GoFuncSignature(name string, fn interface{}) string {
+	return newGoFunc(name, goFuncValue(name, fn)).signature()
+}
+
+func goFuncValue(name string, fn interface{}) reflect.Value {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		panic(fmt.Sprintf("%s is not a function: %T", name, fn))
+	}
+	return v
+}
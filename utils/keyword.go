@@ -0,0 +1,9 @@
+package utils
+
+// Keyword is the value of a :name literal. Keywords are distinct from
+// strings, so {:a 1} and {"a" 1} are different dicts.
+type Keyword string
+
+func (k Keyword) String() string {
+	return ":" + string(k)
+}
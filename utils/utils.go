@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+
+	"github.com/Stromberg/gel/lazy"
+	"github.com/Stromberg/gel/persistent"
 )
 
 func IsAnyStrings(values ...interface{}) bool {
@@ -93,17 +96,89 @@ func ListToVec(lst []interface{}) (res []float64, err error) {
 	return
 }
 
-func ToList(data interface{}) (res []interface{}, ok bool) {
+// ToList returns the items of a list, a vec, a persistent vector or set, or
+// of a lazy sequence, which is realized. It returns ErrParameterType if data
+// is none of them, and the error of a failed realization.
+func ToList(data interface{}) ([]interface{}, error) {
 	switch arg := data.(type) {
 	case []interface{}:
-		return arg, true
+		return arg, nil
 	case []float64:
-		return VecToList(arg), true
+		return VecToList(arg), nil
+	case *persistent.Vector:
+		return arg.Slice(), nil
+	case *persistent.Set:
+		return arg.Slice(), nil
+	case *lazy.Seq:
+		return arg.Slice()
+	}
+
+	return nil, ErrParameterType
+}
+
+func ToDict(data interface{}) (res map[interface{}]interface{}, ok bool) {
+	switch arg := data.(type) {
+	case map[interface{}]interface{}:
+		return arg, true
+	case *persistent.Map:
+		return arg.ToMap(), true
 	}
 
 	return nil, false
 }
 
+// AsList returns the items of a list, a []interface{} or a persistent
+// vector. Unlike ToList, it does not convert vecs, sets and sequences.
+func AsList(data interface{}) ([]interface{}, bool) {
+	switch arg := data.(type) {
+	case []interface{}:
+		return arg, true
+	case *persistent.Vector:
+		return arg.Slice(), true
+	}
+	return nil, false
+}
+
+// IsDict reports whether data is a dict, a map or a persistent map.
+func IsDict(data interface{}) bool {
+	switch data.(type) {
+	case map[interface{}]interface{}, *persistent.Map:
+		return true
+	}
+	return false
+}
+
+// DictGet returns the value of key in the dict data, without copying a
+// persistent map like ToDict.
+func DictGet(data, key interface{}) (interface{}, bool) {
+	switch arg := data.(type) {
+	case map[interface{}]interface{}:
+		v, ok := arg[key]
+		return v, ok
+	case *persistent.Map:
+		return arg.Get(key)
+	}
+	return nil, false
+}
+
+// RangeDict calls fn for the entries of the dict data until fn returns
+// false. It returns false if data is not a dict.
+func RangeDict(data interface{}, fn func(key, val interface{}) bool) bool {
+	switch arg := data.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range arg {
+			if !fn(k, v) {
+				break
+			}
+		}
+	case *persistent.Map:
+		arg.Range(fn)
+	default:
+		return false
+	}
+	return true
+}
+
 func MapVec(f func(float64) float64, v []float64) []float64 {
 	res := make([]float64, len(v))
 	for i := range v {
@@ -140,8 +215,14 @@ func Call(fn interface{}, args ...interface{}) (value interface{}, err error) {
 			return nil, errors.New("lookup using string requires a dictionary")
 		}
 		return GetFn.(func(...interface{}) (interface{}, error))(args[0], fn)
+	// Lookup in dict based on keyword
+	case Keyword:
+		if len(args) != 1 {
+			return nil, errors.New("lookup using keyword requires a dictionary")
+		}
+		return GetFn.(func(...interface{}) (interface{}, error))(args[0], fn)
 	// Lookup on container
-	case map[interface{}]interface{}, []interface{}, []float64:
+	case map[interface{}]interface{}, []interface{}, []float64, *persistent.Vector, *persistent.Map, *persistent.Set:
 		if len(args) != 1 {
 			return nil, errors.New("lookup requires a key")
 		}